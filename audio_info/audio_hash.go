@@ -0,0 +1,87 @@
+package audio_info
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// AudioRange 返回去掉首尾标签后的音频数据区间 [start, end)，只支持 MP3 和 FLAC，
+// 修改标签不会改变该区间的内容
+func AudioRange(r io.ReadSeeker, size int64) (start, end int64, err error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	head := make([]byte, 4)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, 0, err
+	}
+	head = head[:n]
+	switch {
+	case string(head) == "fLaC":
+		start, err = FLACAudioOffset(r, 0)
+		return start, size, err
+	case len(head) >= 3 && string(head[:3]) == "ID3":
+		if start, err = id3v2Size(r); err != nil {
+			return 0, 0, err
+		}
+		if isFLACAt(r, start) {
+			start, err = FLACAudioOffset(r, start)
+			return start, size, err
+		}
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		start = 0
+	default:
+		return 0, 0, ErrUnknownFormat
+	}
+
+	// MP3 结尾可能有 ID3v1 和 APEv2 标签
+	end = size
+	if hasID3v1(r, end) {
+		end -= 128
+	}
+	if end >= 32 {
+		footer := make([]byte, 32)
+		if _, err := r.Seek(end-32, io.SeekStart); err == nil {
+			if _, err := io.ReadFull(r, footer); err == nil && string(footer[:8]) == "APETAGEX" {
+				tagSize := int64(binary.LittleEndian.Uint32(footer[12:16]))
+				if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+					tagSize += 32 // 带 APE 标签头
+				}
+				if tagSize <= end-start {
+					end -= tagSize
+				}
+			}
+		}
+	}
+	return start, end, nil
+}
+
+// AudioHash 计算去掉标签后的音频数据的 SHA-256，不支持的格式返回 ErrUnknownFormat
+func AudioHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	start, end, err := AudioRange(f, fi.Size())
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, end-start); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,120 @@
+package audio_info
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnknownFormat 无法识别的音频格式
+var ErrUnknownFormat = errors.New("无法识别的音频格式")
+
+// Info 从文件头解析出的技术参数
+type Info struct {
+	Codec      string        // mp3 / flac / aac / alac / vorbis / opus / pcm
+	Duration   time.Duration // 时长
+	Bitrate    int           // 平均码率（kbps）
+	SampleRate int           // 采样率（Hz）
+	Channels   int           // 声道数
+	BitDepth   int           // 位深，有损格式为 0
+}
+
+// ParseFile 解析本地音频文件
+func ParseFile(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(f, fi.Size())
+}
+
+// Parse 按文件头识别格式并解析，size 为文件总字节数
+func Parse(r io.ReadSeeker, size int64) (*Info, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	head := make([]byte, 12)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+	var info *Info
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		info, err = parseFLAC(r, 0, size)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		info, err = parseOgg(r, size)
+	case len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")):
+		info, err = parseMP4(r, size)
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		info, err = parseWAV(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		// ID3v2 标签之后可能是 MP3 帧，也可能是带 ID3 头的 FLAC
+		start, serr := id3v2Size(r)
+		if serr != nil {
+			return nil, serr
+		}
+		if isFLACAt(r, start) {
+			info, err = parseFLAC(r, start, size)
+		} else {
+			info, err = parseMP3(r, start, size)
+		}
+	default:
+		info, err = parseMP3(r, 0, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Bitrate == 0 && info.Duration > 0 {
+		info.Bitrate = int(float64(size) * 8 / info.Duration.Seconds() / 1000)
+	}
+	return info, nil
+}
+
+// id3v2Size 读取文件开头 ID3v2 标签的总长度（含标签头和可选的页脚）
+func id3v2Size(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	h := make([]byte, 10)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, err
+	}
+	if string(h[:3]) != "ID3" {
+		return 0, nil
+	}
+	size := int64(synchsafe(h[6:10])) + 10
+	if h[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, nil
+}
+
+// synchsafe 解码 ID3v2 的 7 位整数
+func synchsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+func isFLACAt(r io.ReadSeeker, offset int64) bool {
+	magic := make([]byte, 4)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+	_, err := io.ReadFull(r, magic)
+	return err == nil && string(magic) == "fLaC"
+}
+
+func seconds(samples uint64, rate int) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(samples) / float64(rate) * float64(time.Second))
+}
@@ -0,0 +1,61 @@
+package audio_info
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// FLAC 元数据块类型
+const (
+	FLACStreamInfo    = 0
+	FLACPadding       = 1
+	FLACVorbisComment = 4
+	FLACPicture       = 6
+)
+
+// FLACAudioOffset 返回 FLAC 音频帧的起始偏移（即所有元数据块之后），offset 为 "fLaC" 所在位置
+func FLACAudioOffset(r io.ReadSeeker, offset int64) (int64, error) {
+	pos := offset + 4
+	for {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(r, h); err != nil {
+			return 0, err
+		}
+		length := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		pos += 4 + length
+		if h[0]&0x80 != 0 {
+			return pos, nil
+		}
+	}
+}
+
+// parseFLAC 读取 STREAMINFO 块，offset 为 "fLaC" 所在位置
+func parseFLAC(r io.ReadSeeker, offset, size int64) (*Info, error) {
+	if _, err := r.Seek(offset+4, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := make([]byte, 4+34)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	if h[0]&0x7f != FLACStreamInfo {
+		return nil, ErrUnknownFormat
+	}
+	si := h[4:]
+	// 采样率 20 位 | 声道数-1 3 位 | 位深-1 5 位 | 总采样数 36 位
+	packed := binary.BigEndian.Uint64(si[10:18])
+	info := &Info{
+		Codec:      "flac",
+		SampleRate: int(packed >> 44),
+		Channels:   int(packed>>41&0x7) + 1,
+		BitDepth:   int(packed>>36&0x1f) + 1,
+	}
+	info.Duration = seconds(packed&0xfffffffff, info.SampleRate)
+	if audioStart, err := FLACAudioOffset(r, offset); err == nil && info.Duration > 0 {
+		info.Bitrate = int(float64(size-audioStart) * 8 / info.Duration.Seconds() / 1000)
+	}
+	return info, nil
+}
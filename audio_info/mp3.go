@@ -0,0 +1,178 @@
+package audio_info
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// 码率表（kbps），下标为 [MPEG1 / MPEG2、2.5][Layer I、II、III][码率索引]
+var mp3Bitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+// 采样率表，下标为 [版本位][采样率索引]，版本位 0=MPEG2.5 2=MPEG2 3=MPEG1
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},
+	{},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+type mp3Frame struct {
+	version    int // 版本位
+	layer      int // 1 / 2 / 3
+	bitrate    int // kbps
+	sampleRate int
+	padding    int
+	channels   int
+}
+
+func parseMP3Header(b []byte) (mp3Frame, bool) {
+	var f mp3Frame
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return f, false
+	}
+	f.version = int(b[1]>>3) & 3
+	layerBits := int(b[1]>>1) & 3
+	bitrateIdx := int(b[2] >> 4)
+	rateIdx := int(b[2]>>2) & 3
+	if f.version == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return f, false
+	}
+	f.layer = 4 - layerBits
+	table := 0
+	if f.version != 3 {
+		table = 1
+	}
+	f.bitrate = mp3Bitrates[table][f.layer-1][bitrateIdx]
+	f.sampleRate = mp3SampleRates[f.version][rateIdx]
+	f.padding = int(b[2]>>1) & 1
+	f.channels = 2
+	if b[3]>>6 == 3 {
+		f.channels = 1
+	}
+	return f, true
+}
+
+func (f mp3Frame) samples() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 3:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+func (f mp3Frame) length() int {
+	if f.layer == 1 {
+		return (12*f.bitrate*1000/f.sampleRate + f.padding) * 4
+	}
+	return f.samples()/8*f.bitrate*1000/f.sampleRate + f.padding
+}
+
+// xingOffset Xing / Info 头相对帧头的偏移
+func (f mp3Frame) xingOffset() int {
+	switch {
+	case f.version == 3 && f.channels == 1:
+		return 4 + 17
+	case f.version == 3:
+		return 4 + 32
+	case f.channels == 1:
+		return 4 + 9
+	default:
+		return 4 + 17
+	}
+}
+
+// parseMP3 从 start（ID3v2 标签之后）开始查找第一个有效帧，优先使用 Xing/VBRI 头计算 VBR 时长
+func parseMP3(r io.ReadSeeker, start, size int64) (*Info, error) {
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 64*1024)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		f, ok := parseMP3Header(buf[i:])
+		if !ok {
+			continue
+		}
+		// 下一帧也必须是有效帧头，避免把数据误认为同步字
+		if next := i + f.length(); next+4 <= len(buf) {
+			if _, ok := parseMP3Header(buf[next:]); !ok {
+				continue
+			}
+		}
+		return mp3Info(r, buf[i:], f, start+int64(i), size)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func mp3Info(r io.ReadSeeker, frame []byte, f mp3Frame, offset, size int64) (*Info, error) {
+	info := &Info{Codec: "mp3", SampleRate: f.sampleRate, Channels: f.channels}
+	audioBytes := size - offset
+	if hasID3v1(r, size) {
+		audioBytes -= 128
+	}
+
+	var frames, bytes uint32
+	if x := f.xingOffset(); x+16 <= len(frame) && (string(frame[x:x+4]) == "Xing" || string(frame[x:x+4]) == "Info") {
+		flags := binary.BigEndian.Uint32(frame[x+4:])
+		p := x + 8
+		if flags&1 != 0 {
+			frames = binary.BigEndian.Uint32(frame[p:])
+			p += 4
+		}
+		if flags&2 != 0 && p+4 <= len(frame) {
+			bytes = binary.BigEndian.Uint32(frame[p:])
+		}
+	} else if v := 4 + 32; v+18 <= len(frame) && string(frame[v:v+4]) == "VBRI" {
+		bytes = binary.BigEndian.Uint32(frame[v+10:])
+		frames = binary.BigEndian.Uint32(frame[v+14:])
+	}
+
+	if frames > 0 {
+		info.Duration = seconds(uint64(frames)*uint64(f.samples()), f.sampleRate)
+		if bytes == 0 {
+			bytes = uint32(audioBytes)
+		}
+		if info.Duration > 0 {
+			info.Bitrate = int(float64(bytes) * 8 / info.Duration.Seconds() / 1000)
+		}
+		return info, nil
+	}
+	// 没有 VBR 头，按固定码率估算
+	info.Bitrate = f.bitrate
+	info.Duration = time.Duration(float64(audioBytes) * 8 / float64(f.bitrate*1000) * float64(time.Second))
+	return info, nil
+}
+
+// hasID3v1 文件末尾 128 字节是否为 ID3v1 标签
+func hasID3v1(r io.ReadSeeker, size int64) bool {
+	if size < 128 {
+		return false
+	}
+	tag := make([]byte, 3)
+	if _, err := r.Seek(size-128, io.SeekStart); err != nil {
+		return false
+	}
+	_, err := io.ReadFull(r, tag)
+	return err == nil && string(tag) == "TAG"
+}
@@ -0,0 +1,163 @@
+package audio_info
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type mp4Box struct {
+	typ        string
+	start, end int64 // 整个 box 的范围
+	dataStart  int64 // box 头之后
+}
+
+// readBoxes 列出 [start, end) 范围内的同级 box
+func readBoxes(r io.ReadSeeker, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		h := make([]byte, 16)
+		if _, err := io.ReadFull(r, h[:8]); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(h[:4]))
+		header := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := io.ReadFull(r, h[8:16]); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(h[8:16]))
+			header = 16
+		}
+		if size < header || pos+size > end {
+			break
+		}
+		boxes = append(boxes, mp4Box{typ: string(h[4:8]), start: pos, end: pos + size, dataStart: pos + header})
+		pos += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []mp4Box, typ string) (mp4Box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+func readAt(r io.ReadSeeker, offset int64, n int) ([]byte, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+// parseMP4 解析 M4A：时长取音频轨道的 mdhd，编码、声道、采样率取 stsd 的第一个条目
+func parseMP4(r io.ReadSeeker, size int64) (*Info, error) {
+	top, err := readBoxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	moov, ok := findBox(top, "moov")
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	traks, err := readBoxes(r, moov.dataStart, moov.end)
+	if err != nil {
+		return nil, err
+	}
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		info, err := parseMP4Track(r, trak)
+		if err == nil {
+			return info, nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+func parseMP4Track(r io.ReadSeeker, trak mp4Box) (*Info, error) {
+	children, err := readBoxes(r, trak.dataStart, trak.end)
+	if err != nil {
+		return nil, err
+	}
+	mdia, ok := findBox(children, "mdia")
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	mdiaChildren, err := readBoxes(r, mdia.dataStart, mdia.end)
+	if err != nil {
+		return nil, err
+	}
+	hdlr, ok := findBox(mdiaChildren, "hdlr")
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	if h, err := readAt(r, hdlr.dataStart+8, 4); err != nil || string(h) != "soun" {
+		return nil, ErrUnknownFormat
+	}
+
+	info := &Info{}
+	if mdhd, ok := findBox(mdiaChildren, "mdhd"); ok {
+		v, err := readAt(r, mdhd.dataStart, 1)
+		if err != nil {
+			return nil, err
+		}
+		if v[0] == 1 {
+			b, err := readAt(r, mdhd.dataStart+4+16, 12)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = seconds(binary.BigEndian.Uint64(b[4:12]), int(binary.BigEndian.Uint32(b[:4])))
+		} else {
+			b, err := readAt(r, mdhd.dataStart+4+8, 8)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = seconds(uint64(binary.BigEndian.Uint32(b[4:8])), int(binary.BigEndian.Uint32(b[:4])))
+		}
+	}
+
+	// mdia/minf/stbl/stsd
+	box := mdia
+	for _, name := range []string{"minf", "stbl", "stsd"} {
+		list, err := readBoxes(r, box.dataStart, box.end)
+		if err != nil {
+			return nil, err
+		}
+		if box, ok = findBox(list, name); !ok {
+			return info, nil
+		}
+	}
+	// stsd: 版本和标志 4 字节、条目数 4 字节，然后是第一个条目
+	entry, err := readAt(r, box.dataStart+8, 36)
+	if err != nil {
+		return info, nil
+	}
+	switch format := string(entry[4:8]); format {
+	case "mp4a":
+		info.Codec = "aac"
+	case "alac":
+		info.Codec = "alac"
+	default:
+		info.Codec = format
+	}
+	info.Channels = int(binary.BigEndian.Uint16(entry[24:26]))
+	info.BitDepth = int(binary.BigEndian.Uint16(entry[26:28]))
+	if info.Codec != "alac" {
+		info.BitDepth = 0
+	}
+	info.SampleRate = int(binary.BigEndian.Uint32(entry[32:36]) >> 16)
+	return info, nil
+}
@@ -0,0 +1,87 @@
+package audio_info
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// parseOgg 解析 Vorbis / Opus，时长取最后一页的 granule position
+func parseOgg(r io.ReadSeeker, size int64) (*Info, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	page := make([]byte, 27+255+64)
+	n, err := io.ReadFull(r, page)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	page = page[:n]
+	if len(page) < 28 {
+		return nil, ErrUnknownFormat
+	}
+	serial := binary.LittleEndian.Uint32(page[14:18])
+	segments := int(page[26])
+	if len(page) < 27+segments {
+		return nil, ErrUnknownFormat
+	}
+	packet := page[27+segments:]
+
+	info := &Info{}
+	preSkip := uint64(0)
+	rate := 0
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 28:
+		info.Codec = "vorbis"
+		info.Channels = int(packet[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		info.Bitrate = int(int32(binary.LittleEndian.Uint32(packet[20:24]))) / 1000
+		rate = info.SampleRate
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 16:
+		info.Codec = "opus"
+		info.Channels = int(packet[9])
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		// Opus 的 granule position 固定以 48kHz 计
+		rate = 48000
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	granule, err := lastGranule(r, size, serial)
+	if err != nil {
+		return nil, err
+	}
+	if granule > preSkip {
+		info.Duration = seconds(granule-preSkip, rate)
+	}
+	if info.Bitrate <= 0 {
+		info.Bitrate = 0
+	}
+	return info, nil
+}
+
+// lastGranule 在文件末尾查找同一逻辑流最后一页的 granule position
+func lastGranule(r io.ReadSeeker, size int64, serial uint32) (uint64, error) {
+	tail := int64(64 * 1024)
+	if tail > size {
+		tail = size
+	}
+	if _, err := r.Seek(size-tail, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, tail)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+		if i+18 > len(buf) {
+			continue
+		}
+		if binary.LittleEndian.Uint32(buf[i+14:i+18]) == serial {
+			return binary.LittleEndian.Uint64(buf[i+6 : i+14]), nil
+		}
+	}
+	return 0, ErrUnknownFormat
+}
@@ -0,0 +1,415 @@
+package audio_info
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrTagsUnsupported 只支持写入 MP3 和 FLAC 的标签
+var ErrTagsUnsupported = errors.New("只支持写入 MP3 和 FLAC 的标签")
+
+// Tags 写入文件的曲目信息，空字符串和 0 表示不写该字段
+type Tags struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	Track       int
+	Disc        int
+	Year        int
+	Picture     *Picture // 封面，nil 表示去掉内嵌封面
+}
+
+// Picture 内嵌封面
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// 由 Tags 管理的 ID3v2 帧，写入时替换；TYER 为 2.3 的年份帧
+var managedID3Frames = map[string]bool{
+	"TIT2": true, "TPE1": true, "TPE2": true, "TALB": true, "TRCK": true,
+	"TPOS": true, "TDRC": true, "TYER": true, "TCON": true, "APIC": true,
+}
+
+// 只存在于 ID3v2.3、2.4 中已废弃的帧，转换时丢弃
+var id3v23OnlyFrames = map[string]bool{
+	"TDAT": true, "TIME": true, "TRDA": true, "TSIZ": true, "TORY": true, "IPLS": true, "RVAD": true, "EQUA": true,
+}
+
+// 由 Tags 管理的 Vorbis 注释字段（大写）
+var managedVorbisFields = map[string]bool{
+	"TITLE": true, "ARTIST": true, "ALBUMARTIST": true, "ALBUM ARTIST": true, "ALBUM": true,
+	"TRACKNUMBER": true, "DISCNUMBER": true, "DATE": true, "YEAR": true, "GENRE": true,
+}
+
+// WriteTags 用 t 替换 MP3（ID3v2.4）或 FLAC（Vorbis 注释 + PICTURE）文件中的曲目信息和封面，
+// 其他标签字段保留。音频数据不变，所以 AudioHash 也不变；MP3 结尾的 ID3v1 / APEv2 标签会被去掉，
+// 避免播放器读到旧的信息。先写到同目录的临时文件再替换原文件
+func WriteTags(path string, t Tags) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	start, end, err := AudioRange(f, fi.Size())
+	if errors.Is(err, ErrUnknownFormat) {
+		return ErrTagsUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	id3Size, err := id3v2Size(f)
+	if err != nil {
+		return err
+	}
+	isFLAC := isFLACAt(f, id3Size)
+	if !isFLAC && !isMPEGFrameAt(f, start) {
+		return ErrTagsUnsupported
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(path), ".tags-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	if isFLAC {
+		// FLAC 前面的 ID3v2 标签不是标准用法，直接去掉
+		err = writeFLACMetadata(w, f, id3Size, t)
+	} else {
+		err = writeID3v2(w, f, t)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, f, end-start); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
+
+func isMPEGFrameAt(r io.ReadSeeker, offset int64) bool {
+	h := make([]byte, 2)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+	_, err := io.ReadFull(r, h)
+	return err == nil && h[0] == 0xff && h[1]&0xe0 == 0xe0
+}
+
+// textFields Tags 中的文本字段，按 ID3 帧 / Vorbis 字段排列，空值不写
+func (t *Tags) textFields() [][3]string {
+	num := func(n int) string {
+		if n <= 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	fields := [][3]string{
+		{"TIT2", "TITLE", t.Title},
+		{"TPE1", "ARTIST", t.Artist},
+		{"TPE2", "ALBUMARTIST", t.AlbumArtist},
+		{"TALB", "ALBUM", t.Album},
+		{"TRCK", "TRACKNUMBER", num(t.Track)},
+		{"TPOS", "DISCNUMBER", num(t.Disc)},
+		{"TDRC", "DATE", num(t.Year)},
+		{"TCON", "GENRE", t.Genre},
+	}
+	var result [][3]string
+	for _, f := range fields {
+		if f[2] != "" {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// writeID3v2 写入 ID3v2.4 标签：原有 2.3 / 2.4 标签中不由 Tags 管理的帧保留，其余替换
+func writeID3v2(w io.Writer, r io.ReadSeeker, t Tags) error {
+	var frames bytes.Buffer
+	kept, err := keptID3Frames(r)
+	if err != nil {
+		return err
+	}
+	for _, f := range t.textFields() {
+		writeID3Frame(&frames, f[0], append([]byte{3}, f[2]...)) // 3: UTF-8
+	}
+	if t.Picture != nil {
+		var apic bytes.Buffer
+		apic.WriteByte(3)
+		apic.WriteString(t.Picture.MIMEType)
+		apic.WriteByte(0)
+		apic.WriteByte(3) // 封面（正面）
+		apic.WriteByte(0) // 空描述
+		apic.Write(t.Picture.Data)
+		writeID3Frame(&frames, "APIC", apic.Bytes())
+	}
+	frames.Write(kept)
+	if frames.Len() >= 1<<28 {
+		return errors.New("ID3v2 标签过大")
+	}
+
+	h := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 0}
+	putSynchsafe(h[6:10], frames.Len())
+	if _, err := w.Write(h); err != nil {
+		return err
+	}
+	_, err = w.Write(frames.Bytes())
+	return err
+}
+
+func writeID3Frame(b *bytes.Buffer, id string, data []byte) {
+	h := make([]byte, 10)
+	copy(h, id)
+	putSynchsafe(h[4:8], len(data))
+	b.Write(h)
+	b.Write(data)
+}
+
+// keptID3Frames 读取原有标签中需要保留的帧，转换为 2.4 格式；
+// 无法安全转换的标签（2.2、整体反同步）全部丢弃
+func keptID3Frames(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := make([]byte, 10)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	version, flags := h[3], h[5]
+	if string(h[:3]) != "ID3" || (version != 3 && version != 4) || flags&0x80 != 0 {
+		return nil, nil
+	}
+	body := make([]byte, synchsafe(h[6:10]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	pos := 0
+	if flags&0x40 != 0 && len(body) >= 4 {
+		// 扩展头：2.3 的长度不含自身 4 字节，2.4 的长度为 synchsafe 且包含自身
+		if version == 3 {
+			pos = 4 + int(binary.BigEndian.Uint32(body[:4]))
+		} else {
+			pos = int(synchsafe(body[:4]))
+		}
+	}
+	var kept bytes.Buffer
+	for pos+10 <= len(body) && body[pos] != 0 {
+		id := string(body[pos : pos+4])
+		var size int
+		if version == 4 {
+			size = int(synchsafe(body[pos+4 : pos+8]))
+		} else {
+			size = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		}
+		status, format := body[pos+8], body[pos+9]
+		data := body[pos+10:]
+		if size > len(data) {
+			break
+		}
+		data = data[:size]
+		pos += 10 + size
+
+		if managedID3Frames[id] {
+			continue
+		}
+		if version == 4 {
+			kept.Write(body[pos-10-size : pos])
+			continue
+		}
+		// 2.3 的压缩、加密、分组帧无法直接转换
+		if id3v23OnlyFrames[id] || format&0xe0 != 0 {
+			continue
+		}
+		fh := make([]byte, 10)
+		copy(fh, id)
+		putSynchsafe(fh[4:8], size)
+		fh[8] = status >> 1 & 0x70
+		kept.Write(fh)
+		kept.Write(data)
+	}
+	return kept.Bytes(), nil
+}
+
+func putSynchsafe(b []byte, n int) {
+	b[0] = byte(n >> 21 & 0x7f)
+	b[1] = byte(n >> 14 & 0x7f)
+	b[2] = byte(n >> 7 & 0x7f)
+	b[3] = byte(n & 0x7f)
+}
+
+// writeFLACMetadata 写入 "fLaC" 和元数据块：保留 STREAMINFO、SEEKTABLE 等块，
+// 替换 VORBIS_COMMENT 中由 Tags 管理的字段和全部 PICTURE，去掉 PADDING。offset 为 "fLaC" 所在位置
+func writeFLACMetadata(w io.Writer, r io.ReadSeeker, offset int64, t Tags) error {
+	type block struct {
+		typ  byte
+		data []byte
+	}
+	var blocks []block
+	vendor := "Music"
+	var comments []string
+
+	if _, err := r.Seek(offset+4, io.SeekStart); err != nil {
+		return err
+	}
+	for last := false; !last; {
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(r, h); err != nil {
+			return err
+		}
+		last = h[0]&0x80 != 0
+		typ := h[0] & 0x7f
+		data := make([]byte, int(h[1])<<16|int(h[2])<<8|int(h[3]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		switch typ {
+		case FLACVorbisComment:
+			v, c, err := parseVorbisComment(data)
+			if err != nil {
+				return err
+			}
+			vendor = v
+			for _, comment := range c {
+				name, _, _ := strings.Cut(comment, "=")
+				if !managedVorbisFields[strings.ToUpper(name)] {
+					comments = append(comments, comment)
+				}
+			}
+		case FLACPicture, FLACPadding:
+		default:
+			blocks = append(blocks, block{typ, data})
+		}
+	}
+	if len(blocks) == 0 || blocks[0].typ != FLACStreamInfo {
+		return ErrUnknownFormat
+	}
+
+	var managed []string
+	for _, f := range t.textFields() {
+		managed = append(managed, f[1]+"="+f[2])
+	}
+	blocks = append(blocks, block{FLACVorbisComment, encodeVorbisComment(vendor, append(managed, comments...))})
+	if t.Picture != nil {
+		blocks = append(blocks, block{FLACPicture, encodeFLACPicture(t.Picture)})
+	}
+
+	if _, err := w.Write([]byte("fLaC")); err != nil {
+		return err
+	}
+	for i, b := range blocks {
+		if len(b.data) >= 1<<24 {
+			return fmt.Errorf("FLAC 元数据块过大（%d 字节）", len(b.data))
+		}
+		h := []byte{b.typ, byte(len(b.data) >> 16), byte(len(b.data) >> 8), byte(len(b.data))}
+		if i == len(blocks)-1 {
+			h[0] |= 0x80
+		}
+		if _, err := w.Write(h); err != nil {
+			return err
+		}
+		if _, err := w.Write(b.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseVorbisComment(data []byte) (string, []string, error) {
+	errCorrupt := errors.New("VORBIS_COMMENT 块已损坏")
+	next := func() (string, error) {
+		if len(data) < 4 {
+			return "", errCorrupt
+		}
+		n := binary.LittleEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return "", errCorrupt
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s, nil
+	}
+	vendor, err := next()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) < 4 {
+		return "", nil, errCorrupt
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	var comments []string
+	for i := uint32(0); i < count; i++ {
+		c, err := next()
+		if err != nil {
+			return "", nil, err
+		}
+		comments = append(comments, c)
+	}
+	return vendor, comments, nil
+}
+
+func encodeVorbisComment(vendor string, comments []string) []byte {
+	var b bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+	writeString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		writeString(c)
+	}
+	return b.Bytes()
+}
+
+// encodeFLACPicture 生成 PICTURE 块，宽高等信息无法解析时写 0
+func encodeFLACPicture(p *Picture) []byte {
+	var width, height, depth uint32
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(p.Data)); err == nil {
+		width, height, depth = uint32(cfg.Width), uint32(cfg.Height), 24
+	}
+	var b bytes.Buffer
+	for _, v := range []interface{}{
+		uint32(3), // 封面（正面）
+		uint32(len(p.MIMEType)), []byte(p.MIMEType),
+		uint32(0), // 空描述
+		width, height, depth,
+		uint32(0), // 非索引色
+		uint32(len(p.Data)), p.Data,
+	} {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,41 @@
+package audio_info
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// parseWAV 读取 fmt 与 data 块
+func parseWAV(r io.ReadSeeker, size int64) (*Info, error) {
+	info := &Info{Codec: "pcm"}
+	var byteRate uint32
+	for pos := int64(12); pos+8 <= size; {
+		h, err := readAt(r, pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		length := int64(binary.LittleEndian.Uint32(h[4:8]))
+		switch string(h[:4]) {
+		case "fmt ":
+			f, err := readAt(r, pos+8, 16)
+			if err != nil {
+				return nil, err
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(f[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(f[4:8]))
+			byteRate = binary.LittleEndian.Uint32(f[8:12])
+			info.BitDepth = int(binary.LittleEndian.Uint16(f[14:16]))
+			info.Bitrate = int(byteRate) * 8 / 1000
+		case "data":
+			if byteRate == 0 {
+				return nil, ErrUnknownFormat
+			}
+			info.Duration = time.Duration(float64(length) / float64(byteRate) * float64(time.Second))
+			return info, nil
+		}
+		// 块按偶数字节对齐
+		pos += 8 + length + length%2
+	}
+	return nil, ErrUnknownFormat
+}
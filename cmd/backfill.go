@@ -0,0 +1,40 @@
+package main
+
+import (
+	"Music/my_utils"
+	"Music/services"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runBackfill 为已有记录补全时长、码率、编码、大小和哈希
+func runBackfill(args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	output := fs.String("o", "", "JSON 报告输出路径，默认输出到标准输出")
+	all := fs.Bool("all", false, "重新解析全部记录（包括补全内嵌封面），而不只是缺少参数的记录")
+	fs.Parse(args)
+
+	Prepare()
+
+	report, err := services.NewBackfillService().Backfill(context.Background(), *all)
+	if err != nil {
+		my_utils.Fatal("补全音频参数失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		my_utils.Fatal("生成报告失败: %v", err)
+	}
+	if *output == "" {
+		fmt.Println(string(data))
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		my_utils.Fatal("写入报告失败: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "处理 %d 条记录，更新 %d 条，失败 %d 条\n", report.Rows, report.Updated, len(report.Failed))
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"Music/config"
+	"Music/my_utils"
+	"Music/services"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runImport 批量导入音频，曲目信息优先取自标签，其次按 import.templates 匹配路径
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var include, exclude, templates stringList
+	fs.Var(&include, "include", "只导入匹配的文件，如 *.flac；含 / 时匹配相对路径，可重复指定")
+	fs.Var(&exclude, "exclude", "跳过匹配的文件或目录，如 Live 或 *.wav，可重复指定")
+	fs.Var(&templates, "template", "路径模板，覆盖配置中的 import.templates，可重复指定")
+	concurrency := fs.Int("j", 3, "并发数")
+	dryRun := fs.Bool("dry-run", false, "只显示将要创建的曲目，不上传")
+	journal := fs.String("journal", ".import-journal.jsonl", "导入日志路径，中断后重新运行会跳过已完成的文件；为空时不记录")
+	output := fs.String("o", "", "JSON 报告输出路径，默认输出到标准输出")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: go run ./cmd import [参数] [源目录或文件...]，默认导入 ./src/")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	Prepare()
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"./src/"}
+	}
+	if len(templates) == 0 {
+		templates = config.Config.Import.Templates
+	}
+	compiled, err := services.CompilePathTemplates(templates)
+	if err != nil {
+		my_utils.Fatal("路径模板有误: %v", err)
+	}
+
+	report, err := services.NewImportService().Import(services.ImportOptions{
+		Sources:     sources,
+		Include:     include,
+		Exclude:     exclude,
+		Concurrency: *concurrency,
+		DryRun:      *dryRun,
+		JournalPath: *journal,
+		Templates:   compiled,
+		Progress: func(e services.ImportEntry) {
+			switch e.Status {
+			case services.ImportFailed:
+				fmt.Fprintf(os.Stderr, "❌ %s: %s\n", e.Path, e.Error)
+			case services.ImportResumed:
+			default:
+				fmt.Fprintf(os.Stderr, "%s %s", e.Status, e.Path)
+				if e.DuplicateOf != 0 {
+					fmt.Fprintf(os.Stderr, " (与曲目 %d 重复)", e.DuplicateOf)
+				}
+				if e.Meta != nil {
+					fmt.Fprintf(os.Stderr, " [%s] - [%s] - [%s] (%s)", e.Meta.Artist, e.Meta.Album, e.Meta.Title, e.Meta.SourceSummary())
+				}
+				fmt.Fprintln(os.Stderr)
+			}
+		},
+	})
+	if err != nil {
+		my_utils.Fatal("导入失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		my_utils.Fatal("生成报告失败: %v", err)
+	}
+	if *output == "" {
+		fmt.Println(string(data))
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		my_utils.Fatal("写入报告失败: %v", err)
+	}
+	fmt.Fprint(os.Stderr, report.Text())
+	if report.Summary[services.ImportFailed] > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,18 +2,18 @@ package main
 
 import (
 	"Music/config"
+	"Music/migrations"
 	"Music/models"
 	"Music/my_utils"
-	"Music/services"
+	_ "Music/s3_storage"
+	"Music/storage"
+	_ "Music/tengcent_cos"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
-	"strings"
-	"sync"
 )
 
-func Prepare() {
+// prepareDatabase 初始化日志、配置和数据库连接，不检查数据库版本
+func prepareDatabase() {
 	// 初始化日志
 	logFile, err := my_utils.SetupLogFile("app.log")
 	if err != nil {
@@ -31,56 +31,45 @@ func Prepare() {
 	models.Init()
 }
 
-func main() {
-	Prepare()
-	rootDir := "./src/"
-	singer := "周杰伦"
-	service := services.NewMusicService()
-
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, 3) // 控制最大并发数为 5，可调整
-
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-
-		ext := filepath.Ext(info.Name())
-		if ext != ".flac" && ext != ".mp3" {
-			return nil
-		}
-
-		baseName := strings.TrimSuffix(info.Name(), ext)
-		album := filepath.Base(filepath.Dir(path))
-		title := strings.TrimPrefix(baseName, singer+" - ")
-
-		music := &models.MusicInfo{
-			Name:   title,
-			Album:  album,
-			Singer: singer,
-		}
-
-		wg.Add(1)
-		sem <- struct{}{} // 占用一个槽位
-
-		go func(m *models.MusicInfo, p string, name string, album string) {
-			defer wg.Done()
-			defer func() { <-sem }() // 释放槽位
+// Prepare 初始化运行子命令所需的全部依赖
+func Prepare() {
+	prepareDatabase()
+	if err := migrations.EnsureUpToDate(models.DB, config.Config.Database.AutoMigrate); err != nil {
+		my_utils.Fatal("数据库版本检查失败: %v", err)
+	}
 
-			fmt.Printf("开始上传 [%s] - [%s] - [%s]\n", album, m.Name, p)
-			if err := service.CreateMusic(m, p); err != nil {
-				log.Printf("❌ 上传失败 [%s]: %v\n", name, err)
-			} else {
-				log.Printf("✅ 上传成功 [%s]\n", name)
-			}
-		}(music, path, info.Name(), album)
+	// Init Storage
+	if err := storage.Init(); err != nil {
+		my_utils.Fatal("存储初始化失败: %v", err)
+	}
+}
 
-		return nil
-	})
+// 子命令，未指定时执行 import
+var commands = map[string]func(args []string){
+	"import":    runImport,
+	"verify":    runVerify,
+	"migrate":   runMigrate,
+	"backfill":  runBackfill,
+	"sync-tags": runSyncTags,
+	"user":      runUser,
+	"apikey":    runAPIKey,
+	"recap":     runRecap,
+}
 
-	wg.Wait()
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法: go run ./cmd [import|verify|migrate|backfill|sync-tags|user|apikey|recap] [参数]")
+	fmt.Fprintln(os.Stderr, "      go run ./cmd <子命令> -h 查看子命令参数")
+}
 
-	if err != nil {
-		log.Fatalf("遍历目录出错: %v", err)
+func main() {
+	name, args := "import", os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
 	}
+	cmd(args)
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"Music/migrations"
+	"Music/models"
+	"Music/my_utils"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// runMigrate 管理数据库迁移：up / down / status
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	to := fs.Int("to", -1, "目标版本；up 默认最新，down 默认回滚一个版本")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: go run ./cmd migrate up|down|status [-to N]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	prepareDatabase()
+
+	switch action {
+	case "up":
+		target := max(*to, 0)
+		ran, err := migrations.Up(models.DB, target)
+		for _, m := range ran {
+			fmt.Printf("up   %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			my_utils.Fatal("%v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+	case "down":
+		target := *to
+		if target < 0 {
+			current, err := migrations.Current(models.DB)
+			if err != nil {
+				my_utils.Fatal("%v", err)
+			}
+			target = max(previousVersion(current), 0)
+		}
+		ran, err := migrations.Down(models.DB, target)
+		for _, m := range ran {
+			fmt.Printf("down %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			my_utils.Fatal("%v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("没有需要回滚的迁移")
+		}
+	case "status":
+		entries, err := migrations.Status(models.DB)
+		if err != nil {
+			my_utils.Fatal("%v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, e := range entries {
+			status, at := "pending", ""
+			if e.Applied {
+				status, at = "applied", e.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if e.Unknown {
+				status = "unknown"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", e.Version, e.Name, status, at)
+		}
+		w.Flush()
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// previousVersion 已知迁移中小于 v 的最大版本
+func previousVersion(v int) int {
+	prev := 0
+	for _, m := range migrations.All() {
+		if m.Version < v {
+			prev = m.Version
+		}
+	}
+	return prev
+}
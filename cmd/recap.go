@@ -0,0 +1,190 @@
+package main
+
+import (
+	"Music/models"
+	"Music/my_utils"
+	"Music/repositories"
+	"Music/services"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+)
+
+// runRecap 生成用户的年度回顾，默认输出静态 HTML 页面
+func runRecap(args []string) {
+	fs := flag.NewFlagSet("recap", flag.ExitOnError)
+	username := fs.String("user", "", "用户名")
+	year := fs.Int("year", time.Now().Year(), "年份")
+	tz := fs.String("tz", "", "时区（IANA 名称，如 Asia/Shanghai），默认使用本机时区")
+	top := fs.Int("top", 10, "排行榜长度")
+	output := fs.String("o", "", "输出路径，默认为 recap-<用户名>-<年份>.html")
+	asJSON := fs.Bool("json", false, "输出 JSON 而不是 HTML")
+	fs.Parse(args)
+	if *username == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	Prepare()
+
+	loc, err := services.ParseTimezone(*tz)
+	if err != nil {
+		my_utils.Fatal("%v", err)
+	}
+	user, err := services.NewAuthService().GetUser(*username)
+	if err != nil {
+		my_utils.Fatal("用户 %s 不存在: %v", *username, err)
+	}
+	viewer := repositories.Viewer{UserID: user.ID, All: user.Scopes().Has(models.ScopeAdmin)}
+	review, err := services.NewStatsService().YearInReview(viewer, *year, loc, *top)
+	if err != nil {
+		my_utils.Fatal("生成年度回顾失败: %v", err)
+	}
+
+	path := *output
+	if path == "" {
+		ext := "html"
+		if *asJSON {
+			ext = "json"
+		}
+		path = fmt.Sprintf("recap-%s-%d.%s", user.Username, *year, ext)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		my_utils.Fatal("创建输出文件失败: %v", err)
+	}
+	defer f.Close()
+	if *asJSON {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(review)
+	} else {
+		err = recapTemplate.Execute(f, review)
+	}
+	if err != nil {
+		my_utils.Fatal("写入年度回顾失败: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "%s 的 %d 年度回顾：%d 次播放，已写入 %s\n", user.Username, *year, review.Plays, path)
+}
+
+// bar 柱状图的一项
+type bar struct {
+	Label   string
+	Value   int64
+	Percent float64
+}
+
+func bars(labels []string, values []int64) []bar {
+	var max int64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	result := make([]bar, len(values))
+	for i, v := range values {
+		result[i] = bar{Label: labels[i], Value: v}
+		if max > 0 {
+			result[i].Percent = float64(v) * 100 / float64(max)
+		}
+	}
+	return result
+}
+
+var recapTemplate = template.Must(template.New("recap").Funcs(template.FuncMap{
+	"duration": func(ms int64) string {
+		minutes := ms / 60000
+		if minutes < 60 {
+			return fmt.Sprintf("%d 分钟", minutes)
+		}
+		return fmt.Sprintf("%d 小时 %d 分钟", minutes/60, minutes%60)
+	},
+	"months": func(v [12]int64) []bar {
+		labels := make([]string, 12)
+		for i := range labels {
+			labels[i] = fmt.Sprintf("%d 月", i+1)
+		}
+		return bars(labels, v[:])
+	},
+	"hours": func(v [24]int64) []bar {
+		labels := make([]string, 24)
+		for i := range labels {
+			labels[i] = fmt.Sprintf("%02d", i)
+		}
+		return bars(labels, v[:])
+	},
+	"weekdays": func(v [7]int64) []bar {
+		// 从星期一开始显示
+		labels := []string{"周一", "周二", "周三", "周四", "周五", "周六", "周日"}
+		return bars(labels, append(append([]int64{}, v[1:]...), v[0]))
+	},
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Username}} 的 {{.Year}} 年度回顾</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; max-width: 860px; margin: 2em auto; padding: 0 1em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+.sub { color: #888; margin-top: 0; }
+.cards { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.card { flex: 1 1 150px; background: #f5f5f7; border-radius: 8px; padding: 1em; }
+.card b { display: block; font-size: 1.6em; }
+section { margin: 2em 0; }
+ol li { margin: 0.3em 0; }
+.muted { color: #888; }
+.chart .row { display: flex; align-items: center; margin: 2px 0; font-size: 0.9em; }
+.chart .label { width: 4em; }
+.chart .bar { background: #5b8def; height: 14px; margin-right: 0.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Username}} 的 {{.Year}} 年度回顾</h1>
+<p class="sub">时区 {{.Timezone}} · 生成于 {{date .GeneratedAt}}</p>
+
+<div class="cards">
+  <div class="card"><b>{{.Plays}}</b>次播放</div>
+  <div class="card"><b>{{duration .ListeningMs}}</b>收听时长</div>
+  <div class="card"><b>{{.Tracks}}</b>首曲目 · {{.Artists}} 位艺人 · {{.Albums}} 张专辑</div>
+  <div class="card"><b>{{.ActiveDays}}</b>天有播放，最长连续 {{.LongestStreak}} 天</div>
+</div>
+{{with .FirstPlay}}<p>这一年从 {{date .PlayedAt}} 的《{{.Name}}》{{with .Artist}}（{{.}}）{{end}}开始。</p>{{end}}
+{{with .TopDay}}<p>听得最多的一天是 {{.Date}}，播放了 {{.Plays}} 次，共 {{duration .ListeningMs}}。</p>{{end}}
+
+<section>
+<h2>最常听的曲目</h2>
+<ol>{{range .TopTracks}}<li>{{.Name}}{{with .Artist}} <span class="muted">— {{.}}</span>{{end}} <span class="muted">{{.Plays}} 次</span></li>{{else}}<p class="muted">暂无</p>{{end}}</ol>
+</section>
+<section>
+<h2>最常听的艺人</h2>
+<ol>{{range .TopArtists}}<li>{{.Name}} <span class="muted">{{.Plays}} 次 · {{duration .ListeningMs}}</span></li>{{else}}<p class="muted">暂无</p>{{end}}</ol>
+</section>
+<section>
+<h2>最常听的专辑</h2>
+<ol>{{range .TopAlbums}}<li>{{.Name}}{{with .Artist}} <span class="muted">— {{.}}</span>{{end}} <span class="muted">{{.Plays}} 次</span></li>{{else}}<p class="muted">暂无</p>{{end}}</ol>
+</section>
+<section>
+<h2>新发现</h2>
+<p>今年第一次听到 {{.NewTracks}} 首曲目、{{.NewArtists}} 位艺人。</p>
+<ol>{{range .TopNewArtists}}<li>{{.Name}} <span class="muted">{{.Plays}} 次</span></li>{{end}}</ol>
+</section>
+
+<section class="chart">
+<h2>每月播放</h2>
+{{range months .ByMonth}}<div class="row"><span class="label">{{.Label}}</span><span class="bar" style="width: {{printf "%.1f" .Percent}}%"></span>{{.Value}}</div>
+{{end}}</section>
+<section class="chart">
+<h2>一周中的播放</h2>
+{{range weekdays .ByWeekday}}<div class="row"><span class="label">{{.Label}}</span><span class="bar" style="width: {{printf "%.1f" .Percent}}%"></span>{{.Value}}</div>
+{{end}}</section>
+<section class="chart">
+<h2>一天中的播放</h2>
+{{range hours .ByHour}}<div class="row"><span class="label">{{.Label}} 时</span><span class="bar" style="width: {{printf "%.1f" .Percent}}%"></span>{{.Value}}</div>
+{{end}}</section>
+</body>
+</html>
+`))
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"Music/my_utils"
+	"Music/services"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runSyncTags 把数据库中的曲目信息和封面写回音频文件标签（只支持 MP3 / FLAC）
+func runSyncTags(args []string) {
+	fs := flag.NewFlagSet("sync-tags", flag.ExitOnError)
+	concurrency := fs.Int("j", 3, "并发数")
+	dryRun := fs.Bool("dry-run", false, "只列出标签与数据库不一致的文件，不改写")
+	output := fs.String("o", "", "JSON 报告输出路径，默认输出到标准输出")
+	fs.Parse(args)
+
+	Prepare()
+
+	report, err := services.NewTagService().SyncAll(context.Background(), *concurrency, *dryRun)
+	if err != nil {
+		my_utils.Fatal("同步标签失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		my_utils.Fatal("生成报告失败: %v", err)
+	}
+	if *output == "" {
+		fmt.Println(string(data))
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		my_utils.Fatal("写入报告失败: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "处理 %d 首曲目", len(report.Entries))
+	for _, status := range []string{services.TagsUpdated, services.TagsWouldUpdate, services.TagsUnchanged, services.TagsUnsupported, services.TagsFailed} {
+		if n := report.Summary[status]; n > 0 {
+			fmt.Fprintf(os.Stderr, "，%s %d", status, n)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	if report.Summary[services.TagsFailed] > 0 {
+		os.Exit(1)
+	}
+}
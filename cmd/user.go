@@ -0,0 +1,206 @@
+package main
+
+import (
+	"Music/my_utils"
+	"Music/services"
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runUser 管理用户：add / list / passwd / role / disable / enable / subsonic
+func runUser(args []string) {
+	fs := flag.NewFlagSet("user", flag.ExitOnError)
+	role := fs.String("role", "", "角色：admin / uploader / listener，add 时默认 listener")
+	password := fs.String("password", "", "密码，不指定时从标准输入读取")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: go run ./cmd user add <用户名> [-role uploader] [-password 密码]")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd user list")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd user passwd <用户名> [-password 密码]")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd user role <用户名> -role admin|uploader|listener")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd user disable|enable <用户名>")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd user subsonic <用户名>    生成 Subsonic 客户端使用的密码")
+		fs.PrintDefaults()
+	}
+	action, name, rest := splitAction(args, fs, "list")
+	fs.Parse(rest)
+
+	Prepare()
+	auth := services.NewAuthService()
+
+	switch action {
+	case "add":
+		user, err := auth.CreateUser(name, readPassword(*password), *role)
+		if err != nil {
+			my_utils.Fatal("创建用户失败: %v", err)
+		}
+		fmt.Printf("已创建用户 %s (id %d)，角色 %s\n", user.Username, user.ID, user.Role)
+	case "list":
+		users, err := auth.ListUsers()
+		if err != nil {
+			my_utils.Fatal("%v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tSTATUS\tCREATED AT")
+		for _, u := range users {
+			status := "active"
+			if u.Disabled {
+				status = "disabled"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", u.ID, u.Username, u.Role, status, u.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	case "passwd":
+		if err := auth.SetPassword(name, readPassword(*password)); err != nil {
+			my_utils.Fatal("修改密码失败: %v", err)
+		}
+		fmt.Println("已修改密码，已登录的会话需重新登录")
+	case "role":
+		if *role == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		user, err := auth.SetRole(name, *role)
+		if err != nil {
+			my_utils.Fatal("修改角色失败: %v", err)
+		}
+		fmt.Printf("用户 %s 的角色: %s\n", user.Username, user.Role)
+	case "disable", "enable":
+		if err := auth.SetDisabled(name, action == "disable"); err != nil {
+			my_utils.Fatal("%v", err)
+		}
+		verb := "启用"
+		if action == "disable" {
+			verb = "停用"
+		}
+		fmt.Printf("已%s用户 %s\n", verb, name)
+	case "subsonic":
+		user, err := auth.GetUser(name)
+		if err != nil {
+			my_utils.Fatal("用户 %s 不存在: %v", name, err)
+		}
+		password, err := auth.ResetSubsonicPassword(user.ID)
+		if err != nil {
+			my_utils.Fatal("生成 Subsonic 密码失败: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "已生成用户 %s 的 Subsonic 密码，原密码已失效；客户端服务器地址填写本服务的地址（接口位于 /rest）\n", user.Username)
+		fmt.Println(password)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// runAPIKey 管理用户的 API 密钥：create / list / revoke
+func runAPIKey(args []string) {
+	fs := flag.NewFlagSet("apikey", flag.ExitOnError)
+	keyName := fs.String("name", "", "密钥名称，如 musicfree")
+	scopes := fs.String("scopes", "", "权限，逗号分隔：listen / upload / admin，默认为用户角色的全部权限")
+	ttl := fs.Duration("ttl", 0, "有效期，如 720h，0 表示不过期")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: go run ./cmd apikey create <用户名> [-name 名称] [-scopes listen] [-ttl 720h]")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd apikey list <用户名>")
+		fmt.Fprintln(os.Stderr, "      go run ./cmd apikey revoke <用户名> <密钥 ID>")
+		fs.PrintDefaults()
+	}
+	action, username, rest := splitAction(args, fs)
+	var keyID uint64
+	if action == "revoke" {
+		if len(rest) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		id, err := strconv.ParseUint(rest[0], 10, 64)
+		if err != nil {
+			my_utils.Fatal("无效的密钥 ID: %s", rest[0])
+		}
+		keyID, rest = id, rest[1:]
+	}
+	fs.Parse(rest)
+
+	Prepare()
+	auth := services.NewAuthService()
+	user, err := auth.GetUser(username)
+	if err != nil {
+		my_utils.Fatal("用户 %s 不存在: %v", username, err)
+	}
+
+	switch action {
+	case "create":
+		plain, key, err := auth.CreateAPIKey(user.ID, *keyName, splitScopes(*scopes), *ttl)
+		if err != nil {
+			my_utils.Fatal("创建密钥失败: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "已创建密钥 %d，权限 %s；明文只显示这一次，请求时放在 X-API-Key 请求头或 ?key= 参数中\n", key.ID, key.Scopes)
+		fmt.Println(plain)
+	case "list":
+		keys, err := auth.ListAPIKeys(user.ID)
+		if err != nil {
+			my_utils.Fatal("%v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES AT\tLAST USED AT")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%s…\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Scopes, formatTime(k.ExpiresAt), formatTime(k.LastUsedAt))
+		}
+		w.Flush()
+	case "revoke":
+		if err := auth.RevokeAPIKey(user.ID, uint(keyID)); err != nil {
+			my_utils.Fatal("删除密钥失败: %v", err)
+		}
+		fmt.Printf("已删除密钥 %d\n", keyID)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// splitAction 拆出动作和其后的用户名，noName 中的动作不带用户名
+func splitAction(args []string, fs *flag.FlagSet, noName ...string) (action, name string, rest []string) {
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action, rest = args[0], args[1:]
+	if slices.Contains(noName, action) {
+		return action, "", rest
+	}
+	if len(rest) == 0 || strings.HasPrefix(rest[0], "-") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return action, rest[0], rest[1:]
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// readPassword 未通过参数指定密码时从标准输入读取一行
+func readPassword(password string) string {
+	if password != "" {
+		return password
+	}
+	fmt.Fprint(os.Stderr, "密码: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		my_utils.Fatal("读取密码失败: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
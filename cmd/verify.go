@@ -0,0 +1,48 @@
+package main
+
+import (
+	"Music/my_utils"
+	"Music/services"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runVerify 检查数据库与对象存储的一致性，可选修复
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	output := fs.String("o", "", "JSON 报告输出路径，默认输出到标准输出")
+	checksum := fs.Bool("checksum", false, "下载对象校验 SHA-256（较慢）")
+	deleteOrphans := fs.Bool("delete-orphans", false, "删除没有对应记录的音频对象、残留的暂存对象和无人引用的封面（一小时内写入的对象除外）")
+	sourceDir := fs.String("source", "", "从该目录查找原文件重新上传丢失或损坏的对象")
+	markBroken := fs.Bool("mark-broken", false, "把无法修复的记录标记为 broken")
+	fs.Parse(args)
+
+	Prepare()
+
+	report, err := services.NewVerifyService().Verify(context.Background(), services.VerifyOptions{
+		Checksum:      *checksum,
+		DeleteOrphans: *deleteOrphans,
+		SourceDir:     *sourceDir,
+		MarkBroken:    *markBroken,
+	})
+	if err != nil {
+		my_utils.Fatal("一致性检查失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		my_utils.Fatal("生成报告失败: %v", err)
+	}
+	if *output == "" {
+		fmt.Println(string(data))
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		my_utils.Fatal("写入报告失败: %v", err)
+	}
+	fmt.Fprint(os.Stderr, report.Text())
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"gopkg.in/yaml.v3"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 var PLAYBASEURL string = "http://localhost:8080/music/v1/play?id="
@@ -13,23 +15,115 @@ type TencentCOSConfig struct {
 	Bucket    string `yaml:"bucket"`
 	SecretID  string `yaml:"secret_id"`
 	SecretKey string `yaml:"secret_key"`
+	// 自定义访问域名，可使用 {bucket} / {region} 占位符，
+	// 默认 https://{bucket}.cos.{region}.myqcloud.com，可指向本地兼容 COS 的模拟服务
+	Endpoint        string `yaml:"endpoint"`
+	ServiceEndpoint string `yaml:"service_endpoint"`
 }
 
 type DatabaseConfig struct {
+	Driver   string `yaml:"driver"` // mysql / sqlite，默认 mysql
+	Path     string `yaml:"path"`   // sqlite 文件路径，:memory: 为内存库
+	Params   string `yaml:"params"` // mysql DSN 参数，默认 charset=utf8mb4&parseTime=True&loc=Local
 	Name     string `yaml:"name"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
+	// 启动时自动执行未执行的迁移；关闭时存在未执行的迁移会拒绝启动
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// S3Config S3 协议存储（AWS S3 / MinIO 等）
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"` // 如 127.0.0.1:9000 或 https://s3.amazonaws.com
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	PathStyle bool   `yaml:"path_style"` // MinIO 通常需要开启
+}
+
+// LocalStorageConfig 本地磁盘存储
+type LocalStorageConfig struct {
+	Root    string `yaml:"root"`     // 对象根目录，默认 data/objects
+	BaseURL string `yaml:"base_url"` // 签名地址前缀，默认 http://localhost:8080/music/v1/object/
+	Secret  string `yaml:"secret"`   // 签名密钥
+}
+
+// StorageConfig 选择对象存储后端
+type StorageConfig struct {
+	Driver string             `yaml:"driver"` // cos / s3 / local，默认 cos
+	Local  LocalStorageConfig `yaml:"local"`
+	// 逻辑桶名 -> 实际桶名，例如 artwork: music-artwork-1320864532；未配置的逻辑桶与默认桶共用
+	Buckets map[string]string `yaml:"buckets"`
+}
+
+// ServerConfig HTTP 服务
+type ServerConfig struct {
+	// 对外访问地址，用于生成封面等资源的绝对地址，默认 http://localhost:8080
+	BaseURL string `yaml:"base_url"`
+	// 单次上传请求的大小上限（MB），默认 2048
+	MaxUploadMB int64 `yaml:"max_upload_mb"`
+	// 可续传上传（tus）未完成数据的暂存目录，默认 data/tus
+	TusDir string `yaml:"tus_dir"`
+}
+
+// AuthConfig 鉴权
+type AuthConfig struct {
+	// 拥有全部权限的引导令牌，用于创建第一个用户之前或脚本调用；为空时不启用
+	AdminToken string `yaml:"admin_token"`
+	// 签发 JWT 的密钥；为空时每次启动随机生成，重启后已登录的会话全部失效
+	JWTSecret string `yaml:"jwt_secret"`
+	// 访问令牌有效期，默认 15m
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl"`
+	// 刷新令牌有效期，默认 720h
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+// ImportConfig 批量导入
+type ImportConfig struct {
+	// 标签缺失时按相对路径（不含扩展名）匹配的模板，依次尝试，
+	// 可用占位符 {artist} {albumartist} {album} {title} {track} {disc} {year} {genre}
+	Templates []string `yaml:"templates"`
+}
+
+// ScrobbleConfig 把播放记录同步到 ListenBrainz / Last.fm 兼容的服务，用户需先关联自己的账号
+type ScrobbleConfig struct {
+	// ListenBrainz 兼容服务的 API 地址，默认 https://api.listenbrainz.org
+	ListenBrainzURL string `yaml:"listenbrainz_url"`
+	// Last.fm 兼容服务的 API 地址，默认 https://ws.audioscrobbler.com/2.0/；未配置 api_key 时不能关联 Last.fm
+	LastFMURL    string `yaml:"lastfm_url"`
+	LastFMAPIKey string `yaml:"lastfm_api_key"`
+	LastFMSecret string `yaml:"lastfm_secret"`
+	// 检查待提交队列的间隔，默认 30s
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// 单条收听记录的最多提交次数，超过后丢弃，默认 50
+	MaxAttempts int `yaml:"max_attempts"`
 }
 
 type AppConfig struct {
+	Server     ServerConfig     `yaml:"server"`
+	Auth       AuthConfig       `yaml:"auth"`
 	Database   DatabaseConfig   `yaml:"database"`
 	TencentCOS TencentCOSConfig `yaml:"tencent_cos"`
+	S3         S3Config         `yaml:"s3"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Import     ImportConfig     `yaml:"import"`
+	Scrobble   ScrobbleConfig   `yaml:"scrobble"`
 }
 
 var Config AppConfig
 
+// BaseURL 对外访问地址，不带结尾的 /
+func BaseURL() string {
+	if Config.Server.BaseURL == "" {
+		return "http://localhost:8080"
+	}
+	return strings.TrimSuffix(Config.Server.BaseURL, "/")
+}
+
 func InitConfig() {
 	file, err := os.ReadFile("config/config.yaml")
 	if err != nil {
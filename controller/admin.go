@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"Music/repositories"
+	"Music/services"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+// GetTrack 读取曲目的全部字段及艺人署名
+func GetTrack(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	track, err := musicService.GetTrack(id)
+	if err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": track, "artwork": services.ArtworkURL(track.Cover)})
+}
+
+// UpdateTrack 修改曲目信息，只接受 services.TrackUpdate 中的字段；write_tags=true 时同时改写音频文件标签
+func UpdateTrack(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var update services.TrackUpdate
+	if !bindStrictJSON(c, &update) {
+		return
+	}
+	writeTags := c.Query("write_tags") == "true" || c.Query("write_tags") == "1"
+	track, tags, err := musicService.UpdateMusic(c.Request.Context(), id, update, writeTags)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": track, "tags": tags})
+}
+
+// DeleteTrack 删除曲目，同时删除不再被引用的音频对象和封面
+func DeleteTrack(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := musicService.DeleteMusic(id); err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": id})
+}
+
+// SetTrackVisibility 所有者修改自己上传的曲目的可见范围，如 {"visibility":"private"}
+func SetTrackVisibility(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	track, err := musicService.SetVisibility(viewer(c), id, req.Visibility)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": track})
+}
+
+// BulkUpdateTracks 按条件批量修改曲目，如 {"filter":{"album":"旧名"},"set":{"album":"新名"},"write_tags":true}
+func BulkUpdateTracks(c *gin.Context) {
+	var req struct {
+		Filter    repositories.TrackFilter `json:"filter"`
+		Set       services.TrackUpdate     `json:"set"`
+		WriteTags bool                     `json:"write_tags"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	result, err := musicService.BulkUpdate(c.Request.Context(), req.Filter, req.Set, req.WriteTags)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"total": len(result.Tracks), "data": result.Tracks, "tags": result.Tags})
+}
+
+// AddArtistAlias 为艺人登记别名，如 {"alias":"Jay Chou"}，之后按别名导入的曲目会归到该艺人
+func AddArtistAlias(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Alias string `json:"alias"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if err := catalogService.AddArtistAlias(id, req.Alias); err != nil {
+		writeEditError(c, err)
+		return
+	}
+	writeArtistDetail(c, id)
+}
+
+// MergeArtists 把 from 艺人合并到路径中的艺人，如 {"from":12}；from 的专辑、曲目署名和别名全部转移后删除 from
+func MergeArtists(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		From uint `json:"from"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if err := catalogService.MergeArtists(id, req.From); err != nil {
+		writeEditError(c, err)
+		return
+	}
+	writeArtistDetail(c, id)
+}
+
+func writeArtistDetail(c *gin.Context, id uint) {
+	artist, err := catalogService.GetArtist(viewer(c), id)
+	if err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": artist})
+}
+
+// bindStrictJSON 解析请求体，出现未知字段时返回 400，避免误以为修改了不可修改的字段
+func bindStrictJSON(c *gin.Context, v interface{}) bool {
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		c.JSON(400, gin.H{"error": "invalid JSON: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeEditError(c *gin.Context, err error) {
+	var fe *services.FieldError
+	switch {
+	case errors.As(err, &fe):
+		c.JSON(400, gin.H{"error": fe.Error(), "field": fe.Field})
+	case errors.Is(err, services.ErrEmptyUpdate), errors.Is(err, services.ErrEmptyFilter):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotOwner):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrArtistNameTaken):
+		c.JSON(409, gin.H{"error": err.Error()})
+	default:
+		writeLookupError(c, err)
+	}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"Music/services"
+	"Music/storage"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+var artworkService = services.NewArtworkService()
+
+// GetArtwork 按封面 ID 返回图片，内容由 ID（内容哈希）决定，可以长期缓存
+//
+// ?size=64|300|600 返回等比缩小的缩略图，?format=jpeg|png 指定缩略图格式（默认 jpeg）
+func GetArtwork(c *gin.Context) {
+	id := c.Param("id")
+	sizeParam := c.Query("size")
+	format := c.DefaultQuery("format", "jpeg")
+	etag := `"` + id + `"`
+	size := 0
+	if sizeParam != "" {
+		var err error
+		size, err = strconv.Atoi(sizeParam)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid size"})
+			return
+		}
+		etag = fmt.Sprintf(`"%s_%d.%s"`, id, size, format)
+	}
+	if c.GetHeader("If-None-Match") == etag && services.ValidArtworkID(id) {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var obj *storage.Object
+	var err error
+	if size == 0 {
+		obj, err = artworkService.Open(c.Request.Context(), id, c.GetHeader("Range"))
+	} else {
+		obj, err = artworkService.OpenVariant(c.Request.Context(), id, size, format, c.GetHeader("Range"))
+	}
+	if errors.Is(err, services.ErrInvalidVariant) {
+		c.JSON(400, gin.H{"error": err.Error(), "sizes": services.ArtworkSizes, "formats": []string{"jpeg", "png"}})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidArtwork) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeStorageError(c, err)
+		return
+	}
+	defer obj.Body.Close()
+
+	obj.Info.ETag = etag
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	writeObject(c, obj)
+}
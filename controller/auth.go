@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"Music/middleware"
+	"Music/repositories"
+	"Music/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+var authService = services.NewAuthService()
+
+// Login 用户名密码登录，返回访问令牌和刷新令牌
+func Login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	tokens, err := authService.Login(req.Username, req.Password)
+	if err != nil {
+		writeAuthError(c, err)
+		return
+	}
+	c.JSON(200, tokens)
+}
+
+// RefreshToken 用刷新令牌换取新的令牌对，旧的刷新令牌随即作废
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	tokens, err := authService.Refresh(req.RefreshToken)
+	if err != nil {
+		writeAuthError(c, err)
+		return
+	}
+	c.JSON(200, tokens)
+}
+
+// Logout 作废刷新令牌；访问令牌在有效期内仍可使用
+func Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if err := authService.Logout(req.RefreshToken); err != nil {
+		writeAuthError(c, err)
+		return
+	}
+	c.Status(204)
+}
+
+// Me 当前调用方及其权限
+func Me(c *gin.Context) {
+	c.JSON(200, gin.H{"data": middleware.CurrentPrincipal(c)})
+}
+
+// ListAPIKeys 列出当前用户的 API 密钥，不含明文
+func ListAPIKeys(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	keys, err := authService.ListAPIKeys(p.UserID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": len(keys), "data": keys})
+}
+
+// CreateAPIKey 为当前用户创建 API 密钥，明文只在响应中出现一次；
+// scopes 为空时继承用户的权限，expires_in 为有效期（秒），0 表示不过期
+func CreateAPIKey(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int64    `json:"expires_in"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if req.ExpiresIn < 0 {
+		c.JSON(400, gin.H{"error": "expires_in 不能为负数", "field": "expires_in"})
+		return
+	}
+	plain, key, err := authService.CreateAPIKey(p.UserID, req.Name, req.Scopes, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		writeAuthError(c, err)
+		return
+	}
+	c.JSON(201, gin.H{"data": key, "key": plain})
+}
+
+// RevokeAPIKey 删除当前用户的 API 密钥
+func RevokeAPIKey(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := authService.RevokeAPIKey(p.UserID, id); err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": id})
+}
+
+// ResetSubsonicPassword 为当前用户生成 Subsonic 客户端使用的密码，明文只在响应中出现一次，原密码随即失效
+func ResetSubsonicPassword(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	password, err := authService.ResetSubsonicPassword(p.UserID)
+	if err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(201, gin.H{"data": gin.H{"username": p.Username, "password": password}})
+}
+
+// ClearSubsonicPassword 删除当前用户的 Subsonic 密码
+func ClearSubsonicPassword(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	if err := authService.ClearSubsonicPassword(p.UserID); err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.Status(204)
+}
+
+// viewer 当前调用方可见的曲目范围
+func viewer(c *gin.Context) repositories.Viewer {
+	return middleware.CurrentPrincipal(c).Viewer()
+}
+
+// userPrincipal 需要登录用户的接口，引导令牌没有对应的用户
+func userPrincipal(c *gin.Context) (*services.Principal, bool) {
+	p := middleware.CurrentPrincipal(c)
+	if p == nil || p.UserID == 0 {
+		c.JSON(403, gin.H{"error": "需要以用户身份登录"})
+		return nil, false
+	}
+	return p, true
+}
+
+func writeAuthError(c *gin.Context, err error) {
+	var fe *services.FieldError
+	switch {
+	case errors.As(err, &fe):
+		c.JSON(400, gin.H{"error": fe.Error(), "field": fe.Field})
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidToken):
+		c.JSON(401, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserDisabled):
+		c.JSON(403, gin.H{"error": err.Error()})
+	default:
+		writeLookupError(c, err)
+	}
+}
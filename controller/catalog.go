@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"Music/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+var catalogService = services.NewCatalogService()
+
+// pagination 读取 offset / limit 参数，limit 默认 50，最大 500
+func pagination(c *gin.Context) (int, int) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	return offset, limit
+}
+
+// idParam 读取路径参数中的 ID
+func idParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(400, gin.H{"error": "Invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeLookupError 记录不存在时返回 404，其他错误返回 500
+func writeLookupError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(500, gin.H{"error": err.Error()})
+}
+
+func ListArtists(c *gin.Context) {
+	offset, limit := pagination(c)
+	artists, total, err := catalogService.ListArtists(viewer(c), offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "data": artists})
+}
+
+func GetArtist(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	artist, err := catalogService.GetArtist(viewer(c), id)
+	if err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": artist})
+}
+
+func ListAlbums(c *gin.Context) {
+	offset, limit := pagination(c)
+	albums, total, err := catalogService.ListAlbums(viewer(c), offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "data": albums})
+}
+
+func GetAlbum(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	album, err := catalogService.GetAlbum(viewer(c), id)
+	if err != nil {
+		writeLookupError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": album})
+}
@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"Music/models"
 	"Music/my_utils"
 	"Music/services"
-	"Music/tengcent_cos"
+	"Music/storage"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/dhowden/tag"
 	"github.com/gin-gonic/gin"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -40,7 +44,7 @@ func SearchMusic(c *gin.Context) {
 	searchType := c.DefaultQuery("type", "music")
 
 	if searchType == "music" {
-		results, err := musicService.SearchMusic(query)
+		results, err := musicService.SearchMusic(viewer(c), query)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -136,14 +140,12 @@ func extractMusicMetadata(filePath string) (MusicItem, error) {
 		Title:  metadata.Title(),
 	}
 
-	// 尝试获取专辑封面
+	// 尝试获取专辑封面；列表接口不写入存储，只返回入库时已经保存的封面地址
 	picture := metadata.Picture()
 	if picture != nil {
-		// 保存专辑封面到临时文件
-		artworkPath := filepath.Join(os.TempDir(), fmt.Sprintf("%s_artwork.jpg", musicItem.Name))
-		err = os.WriteFile(artworkPath, picture.Data, 0644)
+		id, err := artworkService.Lookup(context.Background(), &services.Artwork{Data: picture.Data, MIMEType: picture.MIMEType, Source: "embedded"})
 		if err == nil {
-			musicItem.Artwork = artworkPath
+			musicItem.Artwork = services.ArtworkURL(id)
 		}
 	}
 
@@ -211,46 +213,112 @@ func PlayMusic(c *gin.Context) {
 	}
 
 	// 查询音乐记录
-	music, err := musicService.GetByID(uint(id))
+	music, err := musicService.GetByID(viewer(c), uint(id))
 	if err != nil || music == nil || music.Location == "" {
 		c.JSON(404, gin.H{"error": "music not found"})
 		return
 	}
 
-	// 初始化 COS 客户端
-	cosClient, err := tengcent_cos.InitClient()
-	if err != nil {
-		c.JSON(500, gin.H{"error": "cos init error"})
-		return
-	}
-
 	// 从前端请求中获取 Range
 	rangeHeader := c.GetHeader("Range")
 
-	// 读取 COS 音频数据（支持 Range）
-	resp, err := cosClient.DownloadStreamWithRange(strconv.Itoa(int(music.ID)), rangeHeader)
+	// 读取存储后端中的音频数据（支持 Range）
+	obj, err := storage.Store.Get(c.Request.Context(), music.StorageKey(), rangeHeader)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "failed to stream from COS"})
-		fmt.Println(err.Error())
+		writeStorageError(c, err)
 		return
 	}
-	defer resp.Body.Close()
+	defer obj.Body.Close()
+	recordPlay(c, music, obj)
 
-	// 设置响应头
-	for k, values := range resp.Header {
-		for _, v := range values {
-			c.Writer.Header().Add(k, v)
-		}
+	writeAudioHeaders(c, music)
+	writeObject(c, obj)
+}
+
+// writeAudioHeaders 把入库时解析的技术参数放进响应头，播放器无需下载完整文件即可显示时长
+func writeAudioHeaders(c *gin.Context, music *models.MusicInfo) {
+	h := c.Writer.Header()
+	if music.Duration > 0 {
+		h.Set("X-Content-Duration", strconv.FormatFloat(float64(music.Duration)/1000, 'f', 3, 64))
+	}
+	if music.Bitrate > 0 {
+		h.Set("X-Audio-Bitrate", strconv.Itoa(music.Bitrate))
+	}
+	if music.SampleRate > 0 {
+		h.Set("X-Audio-Sample-Rate", strconv.Itoa(music.SampleRate))
+	}
+	if music.Channels > 0 {
+		h.Set("X-Audio-Channels", strconv.Itoa(music.Channels))
+	}
+	if music.Codec != "" {
+		h.Set("X-Audio-Codec", music.Codec)
+	}
+	if music.SHA256 != "" {
+		h.Set("X-Content-SHA256", music.SHA256)
+	}
+}
+
+// writeObject 设置响应头并把对象内容写给前端播放器
+func writeObject(c *gin.Context, obj *storage.Object) {
+	h := c.Writer.Header()
+	h.Set("Content-Type", obj.Info.ContentType)
+	h.Set("Content-Length", strconv.FormatInt(obj.ContentLength(), 10))
+	h.Set("Accept-Ranges", "bytes")
+	if obj.Info.ETag != "" {
+		h.Set("ETag", obj.Info.ETag)
+	}
+	if !obj.Info.LastModified.IsZero() {
+		h.Set("Last-Modified", obj.Info.LastModified.UTC().Format(http.TimeFormat))
 	}
-	c.Status(resp.StatusCode)
+	status := http.StatusOK
+	if obj.Partial {
+		h.Set("Content-Range", obj.ContentRange())
+		status = http.StatusPartialContent
+	}
+	c.Status(status)
 
-	// 将响应体写给前端播放器
-	_, err = io.Copy(c.Writer, resp.Body)
+	_, err := io.Copy(c.Writer, obj.Body)
 	if err != nil {
 		log.Println("streaming failed:", err)
 	}
 }
 
+// writeStorageError 把存储后端的错误转换为 HTTP 状态码
+func writeStorageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(404, gin.H{"error": "music not found"})
+	case errors.Is(err, storage.ErrInvalidRange):
+		c.JSON(416, gin.H{"error": "invalid range"})
+	default:
+		my_utils.Error("读取存储失败: %v", err)
+		c.JSON(500, gin.H{"error": "failed to read from storage"})
+	}
+}
+
+// ServeLocalObject 提供本地存储签名地址的下载
+func ServeLocalObject(c *gin.Context) {
+	s, _ := storage.BucketByName(c.Query("bucket"))
+	local, ok := s.(*storage.LocalStorage)
+	if !ok {
+		c.JSON(404, gin.H{"error": "not found"})
+		return
+	}
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !local.VerifySignature(key, c.Query("expires"), c.Query("sig")) {
+		c.JSON(403, gin.H{"error": "invalid signature"})
+		return
+	}
+	obj, err := local.Get(c.Request.Context(), key, c.GetHeader("Range"))
+	if err != nil {
+		writeStorageError(c, err)
+		return
+	}
+	defer obj.Body.Close()
+
+	writeObject(c, obj)
+}
+
 // findMusicFileWithVariants 尝试查找文件的多种变体
 func findMusicFileWithVariants(musicRoot, id string) string {
 	// 提取可能的歌曲名
@@ -421,23 +489,3 @@ type MusicInfo struct {
 	Cover    string
 	Location string
 }
-
-// upload music, temp
-//func UploadMusic(c *gin.Context) {
-//	cosClient, err := tengcent_cos.InitClient()
-//	if err != nil {
-//		fmt.Println("error")
-//	}
-//	// upload music file
-//	cosClient.Upload("")
-//	// fill meat data
-//	musicInfo := MusicInfo{
-//		Singer:   "",
-//		Album:    "",
-//		Name:     "",
-//		Cover:    "",
-//		Location: "",
-//	}
-//
-//	// save in database
-//}
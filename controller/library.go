@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"Music/middleware"
+	"Music/models"
+	"Music/my_utils"
+	"Music/services"
+	"Music/storage"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+var libraryService = services.NewLibraryService()
+
+// playProbeBytes 从头开始但不超过该长度的 Range 请求视为播放器探测（如 Safari 的 bytes=0-1），不算一次播放
+const playProbeBytes = 1024
+
+// recordPlay 记录当前用户的播放；从头读取的请求算一次播放，拖动进度和续传的 Range 请求记为 partial。
+// 记录失败只打日志，不影响播放
+func recordPlay(c *gin.Context, music *models.MusicInfo, obj *storage.Object) {
+	p := middleware.CurrentPrincipal(c)
+	if p == nil || p.UserID == 0 {
+		return
+	}
+	partial := obj.Partial && (obj.Start > 0 || obj.ContentLength() < playProbeBytes)
+	client := c.Query("client")
+	if client == "" {
+		client = c.GetHeader("User-Agent")
+	}
+	if err := libraryService.RecordPlay(p.UserID, music, client, partial); err != nil {
+		my_utils.Warn("记录播放失败: %v", err)
+	}
+}
+
+// GetTrackFeedback 当前用户对曲目的收藏状态和评分
+func GetTrackFeedback(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	feedback, err := libraryService.Feedback(p.Viewer(), id)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": feedback})
+}
+
+func LikeTrack(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	feedback, err := libraryService.Like(p.Viewer(), id)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": feedback})
+}
+
+func UnlikeTrack(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	feedback, err := libraryService.Unlike(p.Viewer(), id)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": feedback})
+}
+
+// RateTrack 评分，如 {"rating":4}
+func RateTrack(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Rating int `json:"rating"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	feedback, err := libraryService.Rate(p.Viewer(), id, req.Rating)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": feedback})
+}
+
+func UnrateTrack(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	feedback, err := libraryService.Unrate(p.Viewer(), id)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": feedback})
+}
+
+// ListFavorites 收藏的曲目，支持 offset / limit 分页
+func ListFavorites(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	offset, limit := pagination(c)
+	items, total, err := libraryService.Favorites(p.Viewer(), offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "data": items})
+}
+
+// ListRecentPlays 最近播放，partial=1 时包含拖动进度等 Range 请求
+func ListRecentPlays(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	offset, limit := pagination(c)
+	includePartial, _ := strconv.ParseBool(c.DefaultQuery("partial", "false"))
+	items, total, err := libraryService.RecentPlays(p.Viewer(), includePartial, offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "data": items})
+}
+
+// ListMostPlayed 播放最多的曲目，days 限定最近若干天，不传时统计全部
+func ListMostPlayed(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	offset, limit := pagination(c)
+	days, err := strconv.Atoi(c.DefaultQuery("days", "0"))
+	if err != nil || days < 0 {
+		c.JSON(400, gin.H{"error": "invalid days", "field": "days"})
+		return
+	}
+	items, total, err := libraryService.MostPlayed(p.Viewer(), days, offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "data": items})
+}
@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"Music/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+var playlistService = services.NewPlaylistService()
+
+// ListPlaylists 当前用户拥有或参与协作的歌单
+func ListPlaylists(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	offset, limit := pagination(c)
+	playlists, total, err := playlistService.List(p.Viewer(), offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "data": playlists})
+}
+
+// CreatePlaylist 创建歌单，如 {"name":"跑步","description":""}
+func CreatePlaylist(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	playlist, err := playlistService.Create(p.Viewer(), req.Name, req.Description)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(201, gin.H{"data": playlist})
+}
+
+func GetPlaylist(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	playlist, err := playlistService.Get(viewer(c), id)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// GetSharedPlaylist 通过分享链接读取歌单，不需要登录
+func GetSharedPlaylist(c *gin.Context) {
+	playlist, err := playlistService.GetShared(c.Param("token"))
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// UpdatePlaylist 修改名称或描述，如 {"revision":3,"name":"新名字"}
+func UpdatePlaylist(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Revision    *int    `json:"revision"`
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	if !bindPlaylistEdit(c, &req, &req.Revision) {
+		return
+	}
+	playlist, err := playlistService.Update(viewer(c), id, *req.Revision, req.Name, req.Description)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+func DeletePlaylist(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := playlistService.Delete(viewer(c), id); err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": id})
+}
+
+// AddPlaylistTracks 添加曲目，如 {"revision":3,"track_ids":[1,2],"position":0}，不指定 position 时加在末尾
+func AddPlaylistTracks(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Revision *int   `json:"revision"`
+		TrackIDs []uint `json:"track_ids"`
+		Position *int   `json:"position"`
+	}
+	if !bindPlaylistEdit(c, &req, &req.Revision) {
+		return
+	}
+	playlist, err := playlistService.AddTracks(viewer(c), id, *req.Revision, req.TrackIDs, req.Position)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// RemovePlaylistTracks 删除歌单项，如 {"revision":4,"entry_ids":[10,11]}
+func RemovePlaylistTracks(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Revision *int   `json:"revision"`
+		EntryIDs []uint `json:"entry_ids"`
+	}
+	if !bindPlaylistEdit(c, &req, &req.Revision) {
+		return
+	}
+	playlist, err := playlistService.RemoveTracks(viewer(c), id, *req.Revision, req.EntryIDs)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// ReorderPlaylistTracks 按新顺序列出全部歌单项，如 {"revision":5,"entry_ids":[11,10,12]}
+func ReorderPlaylistTracks(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Revision *int   `json:"revision"`
+		EntryIDs []uint `json:"entry_ids"`
+	}
+	if !bindPlaylistEdit(c, &req, &req.Revision) {
+		return
+	}
+	playlist, err := playlistService.Reorder(viewer(c), id, *req.Revision, req.EntryIDs)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// DuplicatePlaylist 复制为当前用户的新歌单，请求体可选 {"name":"..."}
+func DuplicatePlaylist(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if c.Request.ContentLength != 0 && !bindStrictJSON(c, &req) {
+		return
+	}
+	playlist, err := playlistService.Duplicate(p.Viewer(), id, req.Name)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(201, gin.H{"data": playlist})
+}
+
+// SharePlaylist 生成公开分享链接，链接中只包含共享的曲目
+func SharePlaylist(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	playlist, err := playlistService.Share(viewer(c), id)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist, "share_url": playlist.ShareURL})
+}
+
+func UnsharePlaylist(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	playlist, err := playlistService.Unshare(viewer(c), id)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// AddPlaylistCollaborator 邀请用户共同编辑，如 {"username":"bob"}
+func AddPlaylistCollaborator(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Username string `json:"username"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	playlist, err := playlistService.AddCollaborator(viewer(c), id, req.Username)
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": playlist})
+}
+
+// RemovePlaylistCollaborator 移除协作者，协作者可以移除自己
+func RemovePlaylistCollaborator(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := idParam(c, "user_id")
+	if !ok {
+		return
+	}
+	if err := playlistService.RemoveCollaborator(viewer(c), id, userID); err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": userID})
+}
+
+// bindPlaylistEdit 解析修改歌单的请求体，revision 必填
+func bindPlaylistEdit(c *gin.Context, req interface{}, revision **int) bool {
+	if !bindStrictJSON(c, req) {
+		return false
+	}
+	if *revision == nil {
+		c.JSON(400, gin.H{"error": "缺少 revision", "field": "revision"})
+		return false
+	}
+	return true
+}
+
+func writePlaylistError(c *gin.Context, err error) {
+	var conflict *services.RevisionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(409, gin.H{"error": conflict.Error(), "revision": conflict.Current})
+	case errors.Is(err, services.ErrPlaylistForbidden):
+		c.JSON(403, gin.H{"error": err.Error()})
+	default:
+		writeEditError(c, err)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"Music/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var scrobbleService = services.NewScrobbleService()
+
+// ListScrobbleAccounts 当前用户关联的 scrobble 账号及待提交的记录数
+func ListScrobbleAccounts(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	accounts, err := scrobbleService.Accounts(p.UserID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"data": accounts})
+}
+
+// LinkScrobbleAccount 关联账号：/scrobble/accounts/listenbrainz {"token":"..."}，
+// /scrobble/accounts/lastfm {"username":"...","password":"..."}
+func LinkScrobbleAccount(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	cred := services.ScrobbleCredentials{Token: req.Token, Username: req.Username, Password: req.Password}
+	account, err := scrobbleService.Link(c.Request.Context(), p.UserID, c.Param("service"), cred)
+	if err != nil {
+		var fe *services.FieldError
+		switch {
+		case errors.As(err, &fe):
+			c.JSON(400, gin.H{"error": fe.Error(), "field": fe.Field})
+		case errors.Is(err, services.ErrScrobbleAuth):
+			c.JSON(400, gin.H{"error": err.Error()})
+		default:
+			c.JSON(502, gin.H{"error": "无法连接 scrobble 服务: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(200, gin.H{"data": account})
+}
+
+// UnlinkScrobbleAccount 取消关联，未提交的记录一并丢弃
+func UnlinkScrobbleAccount(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	if err := scrobbleService.Unlink(p.UserID, c.Param("service")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(204)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"Music/services"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+var statsService = services.NewStatsService()
+
+// GetStats 收听统计：?period=week|month|year|all，或 ?from=YYYY-MM-DD&to=YYYY-MM-DD；
+// tz 为计算小时和星期使用的时区，top 为排行榜长度
+func GetStats(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	loc, err := services.ParseTimezone(c.Query("tz"))
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	from, to, err := services.StatsRange(c.Query("period"), c.Query("from"), c.Query("to"), time.Now(), loc)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	top, _ := strconv.Atoi(c.Query("top"))
+	stats, err := statsService.Stats(p.Viewer(), from, to, loc, top)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"data": stats})
+}
+
+// GetYearInReview 年度回顾，如 /stats/recap/2024?tz=Asia/Shanghai
+func GetYearInReview(c *gin.Context) {
+	p, ok := userPrincipal(c)
+	if !ok {
+		return
+	}
+	year, err := strconv.Atoi(c.Param("year"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid year", "field": "year"})
+		return
+	}
+	loc, err := services.ParseTimezone(c.Query("tz"))
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	top, _ := strconv.Atoi(c.Query("top"))
+	review, err := statsService.YearInReview(p.Viewer(), year, loc, top)
+	if err != nil {
+		writeEditError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"data": review})
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"Music/middleware"
+	"Music/models"
+	"Music/services"
+	"encoding/xml"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+// Subsonic 接口（/rest）的协议版本，见 http://www.subsonic.org/pages/api.jsp 和 https://opensubsonic.netlify.app
+const (
+	subsonicAPIVersion    = "1.16.1"
+	subsonicServerName    = "music"
+	subsonicServerVersion = "1.0"
+)
+
+// Subsonic 错误码
+const (
+	subsonicErrGeneric      = 0
+	subsonicErrMissingParam = 10
+	subsonicErrAuth         = 40
+	subsonicErrAuthConflict = 43
+	subsonicErrAPIKey       = 44
+	subsonicErrForbidden    = 50
+	subsonicErrNotFound     = 70
+)
+
+// subsonicResponse 响应的根元素；XML 中字段为属性或子元素，JSON 中包在 subsonic-response 里
+type subsonicResponse struct {
+	XMLName       xml.Name `xml:"http://subsonic.org/restapi subsonic-response" json:"-"`
+	Status        string   `xml:"status,attr" json:"status"`
+	Version       string   `xml:"version,attr" json:"version"`
+	Type          string   `xml:"type,attr" json:"type"`
+	ServerVersion string   `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic  bool     `xml:"openSubsonic,attr" json:"openSubsonic"`
+
+	Error                  *subsonicError             `xml:"error,omitempty" json:"error,omitempty"`
+	License                *subsonicLicense           `xml:"license,omitempty" json:"license,omitempty"`
+	OpenSubsonicExtensions []subsonicExtension        `xml:"openSubsonicExtensions,omitempty" json:"openSubsonicExtensions,omitempty"`
+	MusicFolders           *subsonicMusicFolders      `xml:"musicFolders,omitempty" json:"musicFolders,omitempty"`
+	Artists                *subsonicArtists           `xml:"artists,omitempty" json:"artists,omitempty"`
+	Artist                 *subsonicArtist            `xml:"artist,omitempty" json:"artist,omitempty"`
+	Album                  *subsonicAlbum             `xml:"album,omitempty" json:"album,omitempty"`
+	Song                   *subsonicChild             `xml:"song,omitempty" json:"song,omitempty"`
+	SearchResult3          *subsonicSearchResult3     `xml:"searchResult3,omitempty" json:"searchResult3,omitempty"`
+	Playlists              *subsonicPlaylists         `xml:"playlists,omitempty" json:"playlists,omitempty"`
+	Playlist               *subsonicPlaylistWithSongs `xml:"playlist,omitempty" json:"playlist,omitempty"`
+}
+
+type subsonicError struct {
+	Code    int    `xml:"code,attr" json:"code"`
+	Message string `xml:"message,attr" json:"message"`
+}
+
+type subsonicLicense struct {
+	Valid bool `xml:"valid,attr" json:"valid"`
+}
+
+type subsonicExtension struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Versions []int  `xml:"versions" json:"versions"`
+}
+
+type subsonicMusicFolders struct {
+	Folders []subsonicMusicFolder `xml:"musicFolder" json:"musicFolder"`
+}
+
+type subsonicMusicFolder struct {
+	ID   int    `xml:"id,attr" json:"id"`
+	Name string `xml:"name,attr" json:"name"`
+}
+
+// writeSubsonic 按 f 参数（xml / json / jsonp，默认 xml）输出响应；协议约定出错时 HTTP 状态码也是 200
+func writeSubsonic(c *gin.Context, r *subsonicResponse) {
+	r.Status = "ok"
+	if r.Error != nil {
+		r.Status = "failed"
+	}
+	r.Version = subsonicAPIVersion
+	r.Type = subsonicServerName
+	r.ServerVersion = subsonicServerVersion
+	r.OpenSubsonic = true
+	switch subsonicParam(c, "f") {
+	case "json":
+		c.JSON(200, gin.H{"subsonic-response": r})
+	case "jsonp":
+		c.JSONP(200, gin.H{"subsonic-response": r})
+	default:
+		c.XML(200, r)
+	}
+}
+
+func writeSubsonicError(c *gin.Context, code int, message string) {
+	writeSubsonic(c, &subsonicResponse{Error: &subsonicError{Code: code, Message: message}})
+}
+
+// writeSubsonicLookupError 记录不存在或不可见时返回 70，其他错误返回 0
+func writeSubsonicLookupError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeSubsonicError(c, subsonicErrNotFound, "not found")
+		return
+	}
+	writeSubsonicError(c, subsonicErrGeneric, err.Error())
+}
+
+// subsonicParam 读取查询参数，没有时读取表单（OpenSubsonic 的 formPost 扩展）
+func subsonicParam(c *gin.Context, name string) string {
+	if v, ok := c.GetQuery(name); ok {
+		return v
+	}
+	return c.PostForm(name)
+}
+
+// subsonicParams 读取可以重复的参数，如 id=1&id=2
+func subsonicParams(c *gin.Context, name string) []string {
+	if v, ok := c.GetQueryArray(name); ok {
+		return v
+	}
+	return c.PostFormArray(name)
+}
+
+// subsonicIntParam 读取整数参数，缺少或无法解析时返回 def
+func subsonicIntParam(c *gin.Context, name string, def int) int {
+	if v, err := strconv.Atoi(subsonicParam(c, name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// subsonicID 读取必填的 ID 参数；缺少时返回错误 10，不是本服务的 ID 时返回 70
+func subsonicID(c *gin.Context, name string) (uint, bool) {
+	v := subsonicParam(c, name)
+	if v == "" {
+		writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 "+name)
+		return 0, false
+	}
+	id, ok := parseSubsonicID(v)
+	if !ok {
+		writeSubsonicError(c, subsonicErrNotFound, "not found")
+	}
+	return id, ok
+}
+
+func parseSubsonicID(v string) (uint, bool) {
+	id, err := strconv.ParseUint(v, 10, 64)
+	return uint(id), err == nil && id != 0
+}
+
+func subsonicIDString(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// SubsonicAuth Subsonic 接口的认证：u 加 t 和 s（token = md5(密码 + salt)）或 p（密码），
+// 密码为用户的 Subsonic 密码，见 ResetSubsonicPassword；也可以用 OpenSubsonic 的 apiKey 参数传递本服务的 API 密钥
+func SubsonicAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := subsonicParam(c, "u")
+		apiKey := middleware.SubsonicCredential(c, "apiKey")
+		var p *services.Principal
+		var err error
+		switch {
+		case apiKey != "" && username != "":
+			writeSubsonicError(c, subsonicErrAuthConflict, "apiKey 不能与 u 同时使用")
+			c.Abort()
+			return
+		case apiKey != "":
+			// 只接受 API 密钥，访问令牌有效期太短，不适合配置在客户端里
+			if p, err = authService.Authenticate(apiKey); err == nil && p.Method != services.AuthAPIKey {
+				err = services.ErrInvalidToken
+			}
+			if errors.Is(err, services.ErrInvalidToken) {
+				writeSubsonicError(c, subsonicErrAPIKey, "apiKey 无效或已过期")
+				c.Abort()
+				return
+			}
+		case username == "":
+			writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 u")
+			c.Abort()
+			return
+		default:
+			token := middleware.SubsonicCredential(c, "t")
+			salt := middleware.SubsonicCredential(c, "s")
+			password := middleware.SubsonicCredential(c, "p")
+			if token == "" && password == "" {
+				writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 t 或 p")
+				c.Abort()
+				return
+			}
+			if token != "" && salt == "" {
+				writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 s")
+				c.Abort()
+				return
+			}
+			p, err = authService.AuthenticateSubsonic(username, password, token, salt)
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			writeSubsonicError(c, subsonicErrAuth, "用户名或 Subsonic 密码错误")
+		case errors.Is(err, services.ErrUserDisabled):
+			writeSubsonicError(c, subsonicErrForbidden, err.Error())
+		case err != nil:
+			writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		case !p.Has(models.ScopeListen):
+			writeSubsonicError(c, subsonicErrForbidden, "missing scope: "+models.ScopeListen)
+		default:
+			middleware.SetPrincipal(c, p)
+			c.Next()
+			return
+		}
+		c.Abort()
+	}
+}
+
+func SubsonicPing(c *gin.Context) {
+	writeSubsonic(c, &subsonicResponse{})
+}
+
+func SubsonicGetLicense(c *gin.Context) {
+	writeSubsonic(c, &subsonicResponse{License: &subsonicLicense{Valid: true}})
+}
+
+// SubsonicGetOpenSubsonicExtensions 支持的 OpenSubsonic 扩展，不需要认证
+func SubsonicGetOpenSubsonicExtensions(c *gin.Context) {
+	writeSubsonic(c, &subsonicResponse{OpenSubsonicExtensions: []subsonicExtension{
+		{Name: "apiKeyAuthentication", Versions: []int{1}},
+		{Name: "formPost", Versions: []int{1}},
+	}})
+}
+
+// SubsonicGetMusicFolders 曲库不分目录，只有一个音乐文件夹
+func SubsonicGetMusicFolders(c *gin.Context) {
+	writeSubsonic(c, &subsonicResponse{MusicFolders: &subsonicMusicFolders{
+		Folders: []subsonicMusicFolder{{ID: 1, Name: "Music"}},
+	}})
+}
+
+// subsonicIndexName 艺人在索引中的分组：英文字母开头的按首字母大写，其他归入 #
+func subsonicIndexName(a models.Artist) string {
+	name := a.SortName
+	if name == "" {
+		name = a.Name
+	}
+	if name != "" {
+		if ch := strings.ToUpper(name[:1]); ch >= "A" && ch <= "Z" {
+			return ch
+		}
+	}
+	return "#"
+}
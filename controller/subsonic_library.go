@@ -0,0 +1,591 @@
+package controller
+
+import (
+	"Music/models"
+	"Music/services"
+	"Music/storage"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subsonic 接口中曲目、专辑、艺人、歌单的表示；封面 ID（coverArt）直接使用封面的内容哈希
+
+type subsonicArtists struct {
+	IgnoredArticles string          `xml:"ignoredArticles,attr" json:"ignoredArticles"`
+	Index           []subsonicIndex `xml:"index" json:"index"`
+}
+
+type subsonicIndex struct {
+	Name    string           `xml:"name,attr" json:"name"`
+	Artists []subsonicArtist `xml:"artist" json:"artist"`
+}
+
+type subsonicArtist struct {
+	ID         string          `xml:"id,attr" json:"id"`
+	Name       string          `xml:"name,attr" json:"name"`
+	SortName   string          `xml:"sortName,attr,omitempty" json:"sortName,omitempty"`
+	AlbumCount int64           `xml:"albumCount,attr" json:"albumCount"`
+	Albums     []subsonicAlbum `xml:"album,omitempty" json:"album,omitempty"` // 只在 getArtist 中返回
+}
+
+type subsonicAlbum struct {
+	ID        string          `xml:"id,attr" json:"id"`
+	Name      string          `xml:"name,attr" json:"name"`
+	Artist    string          `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	ArtistID  string          `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	CoverArt  string          `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	SongCount int64           `xml:"songCount,attr" json:"songCount"`
+	Duration  int64           `xml:"duration,attr" json:"duration"` // 秒
+	Created   time.Time       `xml:"created,attr" json:"created"`
+	Year      int             `xml:"year,attr,omitempty" json:"year,omitempty"`
+	Genre     string          `xml:"genre,attr,omitempty" json:"genre,omitempty"`
+	Songs     []subsonicChild `xml:"song,omitempty" json:"song,omitempty"` // 只在 getAlbum 中返回
+}
+
+// subsonicChild 曲目
+type subsonicChild struct {
+	ID           string     `xml:"id,attr" json:"id"`
+	Parent       string     `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	IsDir        bool       `xml:"isDir,attr" json:"isDir"`
+	Title        string     `xml:"title,attr" json:"title"`
+	Album        string     `xml:"album,attr,omitempty" json:"album,omitempty"`
+	Artist       string     `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	Track        int        `xml:"track,attr,omitempty" json:"track,omitempty"`
+	DiscNumber   int        `xml:"discNumber,attr,omitempty" json:"discNumber,omitempty"`
+	Year         int        `xml:"year,attr,omitempty" json:"year,omitempty"`
+	Genre        string     `xml:"genre,attr,omitempty" json:"genre,omitempty"`
+	CoverArt     string     `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Size         int64      `xml:"size,attr,omitempty" json:"size,omitempty"`
+	ContentType  string     `xml:"contentType,attr,omitempty" json:"contentType,omitempty"`
+	Suffix       string     `xml:"suffix,attr,omitempty" json:"suffix,omitempty"`
+	Duration     int64      `xml:"duration,attr,omitempty" json:"duration,omitempty"` // 秒
+	BitRate      int        `xml:"bitRate,attr,omitempty" json:"bitRate,omitempty"`
+	SamplingRate int        `xml:"samplingRate,attr,omitempty" json:"samplingRate,omitempty"`
+	ChannelCount int        `xml:"channelCount,attr,omitempty" json:"channelCount,omitempty"`
+	BitDepth     int        `xml:"bitDepth,attr,omitempty" json:"bitDepth,omitempty"`
+	AlbumID      string     `xml:"albumId,attr,omitempty" json:"albumId,omitempty"`
+	ArtistID     string     `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	Type         string     `xml:"type,attr" json:"type"`
+	MediaType    string     `xml:"mediaType,attr" json:"mediaType"`
+	Starred      *time.Time `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+	UserRating   int        `xml:"userRating,attr,omitempty" json:"userRating,omitempty"`
+}
+
+type subsonicSearchResult3 struct {
+	Artists []subsonicArtist `xml:"artist" json:"artist"`
+	Albums  []subsonicAlbum  `xml:"album" json:"album"`
+	Songs   []subsonicChild  `xml:"song" json:"song"`
+}
+
+type subsonicPlaylists struct {
+	Playlists []subsonicPlaylist `xml:"playlist" json:"playlist"`
+}
+
+type subsonicPlaylist struct {
+	ID        string    `xml:"id,attr" json:"id"`
+	Name      string    `xml:"name,attr" json:"name"`
+	Comment   string    `xml:"comment,attr,omitempty" json:"comment,omitempty"`
+	Owner     string    `xml:"owner,attr" json:"owner"`
+	Public    bool      `xml:"public,attr" json:"public"` // 已开启分享链接
+	SongCount int64     `xml:"songCount,attr" json:"songCount"`
+	Duration  int64     `xml:"duration,attr" json:"duration"` // 秒
+	Created   time.Time `xml:"created,attr" json:"created"`
+	Changed   time.Time `xml:"changed,attr" json:"changed"`
+}
+
+type subsonicPlaylistWithSongs struct {
+	subsonicPlaylist
+	Entries []subsonicChild `xml:"entry,omitempty" json:"entry,omitempty"`
+}
+
+// 各编码对应的 MIME 类型，未知编码按扩展名推断
+var subsonicContentTypes = map[string]string{
+	"mp3":    "audio/mpeg",
+	"flac":   "audio/flac",
+	"aac":    "audio/mp4",
+	"alac":   "audio/mp4",
+	"vorbis": "audio/ogg",
+	"opus":   "audio/ogg",
+	"pcm":    "audio/wav",
+}
+
+func subsonicSong(m *models.MusicInfo, starred map[uint]time.Time, ratings map[uint]int) subsonicChild {
+	song := subsonicChild{
+		ID:           subsonicIDString(m.ID),
+		Title:        m.Name,
+		Album:        m.Album,
+		Artist:       m.Singer,
+		Track:        m.TrackNumber,
+		DiscNumber:   m.DiscNumber,
+		Year:         m.Year,
+		Genre:        m.Genre,
+		CoverArt:     m.Cover,
+		Size:         m.Size,
+		Suffix:       strings.TrimPrefix(strings.ToLower(path.Ext(m.Location)), "."),
+		Duration:     m.Duration / 1000,
+		BitRate:      m.Bitrate,
+		SamplingRate: m.SampleRate,
+		ChannelCount: m.Channels,
+		BitDepth:     m.BitDepth,
+		Type:         "music",
+		MediaType:    "song",
+		UserRating:   ratings[m.ID],
+	}
+	song.ContentType = subsonicContentTypes[m.Codec]
+	if song.ContentType == "" && song.Suffix != "" {
+		song.ContentType = mime.TypeByExtension("." + song.Suffix)
+	}
+	if m.AlbumID != nil {
+		song.AlbumID = subsonicIDString(*m.AlbumID)
+		song.Parent = song.AlbumID
+	}
+	for _, credit := range m.Credits {
+		if credit.Role == models.RoleMain {
+			song.ArtistID = subsonicIDString(credit.ArtistID)
+			break
+		}
+	}
+	if at, ok := starred[m.ID]; ok {
+		song.Starred = &at
+	}
+	return song
+}
+
+// subsonicSongs 转换曲目并带上当前用户的收藏和评分
+func subsonicSongs(c *gin.Context, tracks []*models.MusicInfo) ([]subsonicChild, error) {
+	ids := make([]uint, 0, len(tracks))
+	for _, m := range tracks {
+		ids = append(ids, m.ID)
+	}
+	starred, ratings, err := libraryService.TrackAnnotations(viewer(c).UserID, ids)
+	if err != nil {
+		return nil, err
+	}
+	songs := make([]subsonicChild, 0, len(tracks))
+	for _, m := range tracks {
+		songs = append(songs, subsonicSong(m, starred, ratings))
+	}
+	return songs, nil
+}
+
+func trackPointers(tracks []models.MusicInfo) []*models.MusicInfo {
+	list := make([]*models.MusicInfo, 0, len(tracks))
+	for i := range tracks {
+		list = append(list, &tracks[i])
+	}
+	return list
+}
+
+func subsonicAlbumOf(a services.AlbumSummary) subsonicAlbum {
+	return subsonicAlbum{
+		ID:        subsonicIDString(a.ID),
+		Name:      a.Title,
+		Artist:    a.ArtistName,
+		ArtistID:  subsonicIDString(a.ArtistID),
+		CoverArt:  a.Cover,
+		SongCount: a.Tracks,
+		Duration:  a.Duration / 1000,
+		Created:   a.CreatedAt,
+		Year:      a.Year,
+		Genre:     a.Genre,
+	}
+}
+
+func subsonicArtistOf(a services.ArtistSummary) subsonicArtist {
+	return subsonicArtist{ID: subsonicIDString(a.ID), Name: a.Name, SortName: a.SortName, AlbumCount: a.AlbumCount}
+}
+
+// SubsonicGetArtists 全部可见艺人按首字母分组；只有一个音乐文件夹，忽略 musicFolderId
+func SubsonicGetArtists(c *gin.Context) {
+	artists, err := catalogService.AllArtists(viewer(c))
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	groups := map[string][]subsonicArtist{}
+	for _, a := range artists {
+		name := subsonicIndexName(a.Artist)
+		groups[name] = append(groups[name], subsonicArtistOf(a))
+	}
+	result := &subsonicArtists{Index: make([]subsonicIndex, 0, len(groups))}
+	for name, list := range groups {
+		result.Index = append(result.Index, subsonicIndex{Name: name, Artists: list})
+	}
+	// # 排在字母之后
+	sort.Slice(result.Index, func(i, j int) bool {
+		a, b := result.Index[i].Name, result.Index[j].Name
+		if (a == "#") != (b == "#") {
+			return b == "#"
+		}
+		return a < b
+	})
+	writeSubsonic(c, &subsonicResponse{Artists: result})
+}
+
+// SubsonicGetArtist 艺人及其作为专辑艺人的专辑
+func SubsonicGetArtist(c *gin.Context) {
+	id, ok := subsonicID(c, "id")
+	if !ok {
+		return
+	}
+	detail, err := catalogService.GetArtist(viewer(c), id)
+	if err != nil {
+		writeSubsonicLookupError(c, err)
+		return
+	}
+	albums, err := catalogService.SummarizeAlbums(viewer(c), detail.Albums)
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	artist := subsonicArtist{
+		ID:         subsonicIDString(detail.ID),
+		Name:       detail.Name,
+		SortName:   detail.SortName,
+		AlbumCount: int64(len(albums)),
+		Albums:     make([]subsonicAlbum, 0, len(albums)),
+	}
+	for _, a := range albums {
+		artist.Albums = append(artist.Albums, subsonicAlbumOf(a))
+	}
+	writeSubsonic(c, &subsonicResponse{Artist: &artist})
+}
+
+// SubsonicGetAlbum 专辑及其可见的曲目
+func SubsonicGetAlbum(c *gin.Context) {
+	id, ok := subsonicID(c, "id")
+	if !ok {
+		return
+	}
+	detail, err := catalogService.GetAlbum(viewer(c), id)
+	if err != nil {
+		writeSubsonicLookupError(c, err)
+		return
+	}
+	songs, err := subsonicSongs(c, trackPointers(detail.Tracks))
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	summary := services.AlbumSummary{Album: detail.Album, ArtistName: detail.Artist.Name, Tracks: int64(len(detail.Tracks))}
+	for _, m := range detail.Tracks {
+		summary.Duration += m.Duration
+	}
+	album := subsonicAlbumOf(summary)
+	album.Songs = songs
+	writeSubsonic(c, &subsonicResponse{Album: &album})
+}
+
+func SubsonicGetSong(c *gin.Context) {
+	id, ok := subsonicID(c, "id")
+	if !ok {
+		return
+	}
+	music, err := musicService.GetVisibleTrack(viewer(c), id)
+	if err != nil {
+		writeSubsonicLookupError(c, err)
+		return
+	}
+	songs, err := subsonicSongs(c, []*models.MusicInfo{music})
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	writeSubsonic(c, &subsonicResponse{Song: &songs[0]})
+}
+
+// subsonicSearchPage 读取 xxxCount / xxxOffset 参数，数量默认 20，最多 500
+func subsonicSearchPage(c *gin.Context, kind string) services.SearchPage {
+	page := services.SearchPage{
+		Offset: max(subsonicIntParam(c, kind+"Offset", 0), 0),
+		Limit:  subsonicIntParam(c, kind+"Count", 20),
+	}
+	page.Limit = min(max(page.Limit, 0), 500)
+	return page
+}
+
+// SubsonicSearch3 按关键词搜索艺人、专辑和曲目；query 为空时分页列出全部，客户端用来同步整个曲库
+func SubsonicSearch3(c *gin.Context) {
+	query := strings.Trim(strings.TrimSpace(subsonicParam(c, "query")), `"`)
+	result, err := catalogService.Search(viewer(c), query,
+		subsonicSearchPage(c, "artist"), subsonicSearchPage(c, "album"), subsonicSearchPage(c, "song"))
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	songs, err := subsonicSongs(c, trackPointers(result.Tracks))
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	search := &subsonicSearchResult3{
+		Artists: make([]subsonicArtist, 0, len(result.Artists)),
+		Albums:  make([]subsonicAlbum, 0, len(result.Albums)),
+		Songs:   songs,
+	}
+	for _, a := range result.Artists {
+		search.Artists = append(search.Artists, subsonicArtistOf(a))
+	}
+	for _, a := range result.Albums {
+		search.Albums = append(search.Albums, subsonicAlbumOf(a))
+	}
+	writeSubsonic(c, &subsonicResponse{SearchResult3: search})
+}
+
+func subsonicPlaylistOf(p services.PlaylistSummary) subsonicPlaylist {
+	return subsonicPlaylist{
+		ID:        subsonicIDString(p.ID),
+		Name:      p.Name,
+		Comment:   p.Description,
+		Owner:     p.Owner.Username,
+		Public:    p.ShareToken != nil,
+		SongCount: p.Tracks,
+		Duration:  p.Duration / 1000,
+		Created:   p.CreatedAt,
+		Changed:   p.UpdatedAt,
+	}
+}
+
+// SubsonicGetPlaylists 当前用户拥有或参与协作的歌单；不支持通过 username 查看其他用户的歌单
+func SubsonicGetPlaylists(c *gin.Context) {
+	playlists, _, err := playlistService.List(viewer(c), 0, -1)
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	summaries, err := playlistService.Summaries(viewer(c), playlists)
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	result := &subsonicPlaylists{Playlists: make([]subsonicPlaylist, 0, len(summaries))}
+	for _, p := range summaries {
+		result.Playlists = append(result.Playlists, subsonicPlaylistOf(p))
+	}
+	writeSubsonic(c, &subsonicResponse{Playlists: result})
+}
+
+// SubsonicGetPlaylist 歌单及其中当前用户可见的曲目
+func SubsonicGetPlaylist(c *gin.Context) {
+	id, ok := subsonicID(c, "id")
+	if !ok {
+		return
+	}
+	detail, err := playlistService.Get(viewer(c), id)
+	if err != nil {
+		writeSubsonicLookupError(c, err)
+		return
+	}
+	summary := services.PlaylistSummary{Playlist: detail.Playlist, Owner: detail.Owner}
+	tracks := make([]*models.MusicInfo, 0, len(detail.Tracks))
+	for _, e := range detail.Tracks {
+		if e.Track != nil {
+			tracks = append(tracks, e.Track)
+			summary.Tracks++
+			summary.Duration += e.Track.Duration
+		}
+	}
+	songs, err := subsonicSongs(c, tracks)
+	if err != nil {
+		writeSubsonicError(c, subsonicErrGeneric, err.Error())
+		return
+	}
+	writeSubsonic(c, &subsonicResponse{Playlist: &subsonicPlaylistWithSongs{
+		subsonicPlaylist: subsonicPlaylistOf(summary),
+		Entries:          songs,
+	}})
+}
+
+// subsonicStarIDs 读取要收藏的曲目 ID；只支持收藏曲目，带 albumId / artistId 时返回错误
+func subsonicStarIDs(c *gin.Context) ([]uint, bool) {
+	if len(subsonicParams(c, "albumId")) > 0 || len(subsonicParams(c, "artistId")) > 0 {
+		writeSubsonicError(c, subsonicErrGeneric, "只支持收藏曲目")
+		return nil, false
+	}
+	values := subsonicParams(c, "id")
+	if len(values) == 0 {
+		writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 id")
+		return nil, false
+	}
+	ids := make([]uint, 0, len(values))
+	for _, v := range values {
+		id, ok := parseSubsonicID(v)
+		if !ok {
+			writeSubsonicError(c, subsonicErrNotFound, "not found")
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// SubsonicStar 收藏曲目
+func SubsonicStar(c *gin.Context) {
+	ids, ok := subsonicStarIDs(c)
+	if !ok {
+		return
+	}
+	for _, id := range ids {
+		if _, err := libraryService.Like(viewer(c), id); err != nil {
+			writeSubsonicLookupError(c, err)
+			return
+		}
+	}
+	writeSubsonic(c, &subsonicResponse{})
+}
+
+// SubsonicUnstar 取消收藏曲目
+func SubsonicUnstar(c *gin.Context) {
+	ids, ok := subsonicStarIDs(c)
+	if !ok {
+		return
+	}
+	for _, id := range ids {
+		if _, err := libraryService.Unlike(viewer(c), id); err != nil {
+			writeSubsonicLookupError(c, err)
+			return
+		}
+	}
+	writeSubsonic(c, &subsonicResponse{})
+}
+
+// SubsonicScrobble 客户端上报播放：submission=false 表示正在播放，只转发给关联的 scrobble 服务；
+// 否则记为一次完整的播放，time 为开始播放的时间（毫秒时间戳），可以与 id 一一对应地重复
+func SubsonicScrobble(c *gin.Context) {
+	values := subsonicParams(c, "id")
+	if len(values) == 0 {
+		writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 id")
+		return
+	}
+	times := subsonicParams(c, "time")
+	submission := true
+	if v := subsonicParam(c, "submission"); v != "" {
+		submission, _ = strconv.ParseBool(v)
+	}
+	userID := viewer(c).UserID
+	for i, v := range values {
+		id, ok := parseSubsonicID(v)
+		if !ok {
+			writeSubsonicError(c, subsonicErrNotFound, "not found")
+			return
+		}
+		music, err := musicService.GetByID(viewer(c), id)
+		if err != nil {
+			writeSubsonicLookupError(c, err)
+			return
+		}
+		if !submission {
+			err = libraryService.NowPlaying(userID, music)
+		} else {
+			playedAt := time.Now()
+			if i < len(times) {
+				if ms, perr := strconv.ParseInt(times[i], 10, 64); perr == nil && ms > 0 {
+					playedAt = time.UnixMilli(ms)
+				}
+			}
+			err = libraryService.Scrobble(userID, music, subsonicParam(c, "c"), playedAt)
+		}
+		if err != nil {
+			writeSubsonicError(c, subsonicErrGeneric, err.Error())
+			return
+		}
+	}
+	writeSubsonic(c, &subsonicResponse{})
+}
+
+// SubsonicStream 播放曲目，支持 Range；不支持转码，忽略 maxBitRate 和 format。
+// 播放记录以客户端的 scrobble 为准，这里不记录
+func SubsonicStream(c *gin.Context) {
+	serveSubsonicAudio(c, false)
+}
+
+// SubsonicDownload 下载曲目原文件
+func SubsonicDownload(c *gin.Context) {
+	serveSubsonicAudio(c, true)
+}
+
+func serveSubsonicAudio(c *gin.Context, attachment bool) {
+	id, ok := subsonicID(c, "id")
+	if !ok {
+		return
+	}
+	music, err := musicService.GetByID(viewer(c), id)
+	if err != nil {
+		writeSubsonicLookupError(c, err)
+		return
+	}
+	if music.Location == "" {
+		writeSubsonicError(c, subsonicErrNotFound, "music not found")
+		return
+	}
+	obj, err := storage.Store.Get(c.Request.Context(), music.StorageKey(), c.GetHeader("Range"))
+	if err != nil {
+		writeSubsonicStorageError(c, err)
+		return
+	}
+	defer obj.Body.Close()
+
+	if attachment {
+		name := music.Name
+		if music.Singer != "" {
+			name = music.Singer + " - " + name
+		}
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": name + path.Ext(music.Location),
+		}))
+	}
+	writeAudioHeaders(c, music)
+	writeObject(c, obj)
+}
+
+// writeSubsonicStorageError 无效的 Range 仍返回 416，便于播放器按 HTTP 语义处理
+func writeSubsonicStorageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeSubsonicError(c, subsonicErrNotFound, "music not found")
+	case errors.Is(err, storage.ErrInvalidRange):
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+	default:
+		writeSubsonicError(c, subsonicErrGeneric, "failed to read from storage")
+	}
+}
+
+// SubsonicGetCoverArt 封面图片，id 为曲目或专辑的 coverArt；size 取不小于它的缩略图，超过最大缩略图时返回原图
+func SubsonicGetCoverArt(c *gin.Context) {
+	id := subsonicParam(c, "id")
+	if id == "" {
+		writeSubsonicError(c, subsonicErrMissingParam, "缺少参数 id")
+		return
+	}
+	size := 0
+	if requested := subsonicIntParam(c, "size", 0); requested > 0 {
+		for _, s := range services.ArtworkSizes {
+			if s >= requested {
+				size = s
+				break
+			}
+		}
+	}
+	var obj *storage.Object
+	var err error
+	if size == 0 {
+		obj, err = artworkService.Open(c.Request.Context(), id, c.GetHeader("Range"))
+	} else {
+		obj, err = artworkService.OpenVariant(c.Request.Context(), id, size, "jpeg", c.GetHeader("Range"))
+	}
+	if err != nil {
+		writeSubsonicStorageError(c, err)
+		return
+	}
+	defer obj.Body.Close()
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	writeObject(c, obj)
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"Music/config"
+	"Music/middleware"
+	"Music/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var tusService = services.NewTusService()
+
+// tusMaxSize 单个上传的大小上限（字节），与 server.max_upload_mb 一致
+func tusMaxSize() int64 {
+	maxMB := config.Config.Server.MaxUploadMB
+	if maxMB <= 0 {
+		maxMB = 2048
+	}
+	return maxMB << 20
+}
+
+// TusResumable 检查 Tus-Resumable 请求头并在响应中带上协议版本，OPTIONS 请求除外
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", services.TusVersion)
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		if c.GetHeader("Tus-Resumable") != services.TusVersion {
+			c.Header("Tus-Version", services.TusVersion)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+		c.Next()
+	}
+}
+
+// TusMethodOverride 不支持 PATCH / DELETE 的客户端可以用 POST 加 X-HTTP-Method-Override
+func TusMethodOverride(c *gin.Context) {
+	switch strings.ToUpper(c.GetHeader("X-HTTP-Method-Override")) {
+	case http.MethodPatch:
+		TusPatch(c)
+	case http.MethodDelete:
+		TusDelete(c)
+	default:
+		c.JSON(405, gin.H{"error": "method not allowed"})
+	}
+}
+
+// TusOptions 返回服务端支持的协议版本和扩展
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Version", services.TusVersion)
+	c.Header("Tus-Extension", "creation,termination")
+	c.Header("Tus-Max-Size", strconv.FormatInt(tusMaxSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// TusCreate 创建上传，Upload-Metadata 中的 filename、visibility 和 title / artist 等字段用于入库
+func TusCreate(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(400, gin.H{"error": "invalid Upload-Length"})
+		return
+	}
+	if length > tusMaxSize() {
+		c.JSON(413, gin.H{"error": "upload too large"})
+		return
+	}
+	meta, err := services.ParseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	u, err := tusService.Create(length, meta, middleware.CurrentPrincipal(c).UserID)
+	var fe *services.FieldError
+	if errors.As(err, &fe) {
+		c.JSON(400, gin.H{"error": fe.Error(), "field": fe.Field})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", config.BaseURL()+"/music/v1/tus/"+u.ID)
+	c.Header("Upload-Offset", "0")
+	c.Status(http.StatusCreated)
+}
+
+// TusHead 返回已接收的字节数
+func TusHead(c *gin.Context) {
+	u, ok := findTusUpload(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if len(u.Metadata) > 0 {
+		c.Header("Upload-Metadata", services.EncodeTusMetadata(u.Metadata))
+	}
+	c.Status(http.StatusOK)
+}
+
+// TusPatch 从 Upload-Offset 处追加数据，收到全部数据后入库，结果通过 GET 查询；
+// 入库失败（X-Upload-Status: failed）时数据保留，在最终 offset 处发送空的 PATCH 重试
+func TusPatch(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(415, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{"error": "invalid Upload-Offset"})
+		return
+	}
+	if _, ok := findTusUpload(c); !ok {
+		return
+	}
+	u, err := tusService.Append(c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		writeTusError(c, err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	if u.Result != nil {
+		c.Header("X-Upload-Status", u.Result.Status)
+		if u.Result.Track != nil {
+			c.Header("X-Track-ID", strconv.FormatUint(uint64(u.Result.Track.ID), 10))
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TusDelete 终止上传
+func TusDelete(c *gin.Context) {
+	if _, ok := findTusUpload(c); !ok {
+		return
+	}
+	if err := tusService.Delete(c.Param("id")); err != nil {
+		writeTusError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetTusUpload 查询上传状态，完成后包含入库结果
+func GetTusUpload(c *gin.Context) {
+	u, ok := findTusUpload(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{"data": u})
+}
+
+// findTusUpload 读取当前调用方创建的上传，其他用户的上传视为不存在
+func findTusUpload(c *gin.Context) (*services.TusUpload, bool) {
+	u, err := tusService.Get(c.Param("id"))
+	if err == nil && !u.OwnedBy(viewer(c)) {
+		err = services.ErrUploadNotFound
+	}
+	if err != nil {
+		writeTusError(c, err)
+		return nil, false
+	}
+	return u, true
+}
+
+func writeTusError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOffsetMismatch), errors.Is(err, services.ErrUploadComplete):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadTooLarge):
+		c.JSON(413, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadLocked):
+		c.JSON(423, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
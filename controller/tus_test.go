@@ -0,0 +1,431 @@
+package controller_test
+
+import (
+	"Music/config"
+	"Music/migrations"
+	"Music/models"
+	"Music/router"
+	"Music/services"
+	"Music/storage"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "tus-test-token"
+
+// flakyStorage 在 failPut 为 true 时让写入失败，模拟入库时存储暂时不可用；
+// 设置 putStarted 和 releasePut 后写入会先通知再等待放行，模拟耗时的入库
+type flakyStorage struct {
+	storage.Storage
+	failPut    atomic.Bool
+	putStarted chan struct{}
+	releasePut chan struct{}
+}
+
+func (s *flakyStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	if s.failPut.Load() {
+		return "", errors.New("storage unavailable")
+	}
+	if s.releasePut != nil {
+		s.putStarted <- struct{}{}
+		<-s.releasePut
+	}
+	return s.Storage.Put(ctx, key, r, size, contentType)
+}
+
+// newTusTestServer 使用临时的 SQLite 数据库、本地存储和 tus 目录启动完整的路由
+func newTusTestServer(t *testing.T) (*httptest.Server, *flakyStorage, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	root := t.TempDir()
+	oldCfg, oldStore := config.Config, storage.Store
+	t.Cleanup(func() { config.Config, storage.Store = oldCfg, oldStore })
+
+	config.Config.Database = config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(root, "music.db")}
+	config.Config.Auth = config.AuthConfig{AdminToken: testAdminToken, JWTSecret: "test"}
+	config.Config.Server.TusDir = filepath.Join(root, "tus")
+	models.Init()
+	if _, err := migrations.Up(models.DB, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if db, err := models.DB.DB(); err == nil {
+			db.Close()
+		}
+	})
+	local, err := storage.NewLocalStorage(config.LocalStorageConfig{Root: filepath.Join(root, "objects"), Secret: "test"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyStorage{Storage: local}
+	storage.Store = store
+
+	e := gin.New()
+	router.InitRouter(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	config.Config.Server.BaseURL = srv.URL
+	return srv, store, config.Config.Server.TusDir
+}
+
+// tusClient 最小的 tus 1.0 客户端，只实现 creation 和 termination 扩展
+type tusClient struct {
+	endpoint string
+	token    string
+}
+
+func (tc *tusClient) do(method, url string, body io.Reader, header map[string]string) *http.Response {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Tus-Resumable", services.TusVersion)
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func (tc *tusClient) create(t *testing.T, length int, meta map[string]string) string {
+	t.Helper()
+	var pairs []string
+	for k, v := range meta {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	resp := tc.do(http.MethodPost, tc.endpoint, nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": strings.Join(pairs, ","),
+	})
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Upload-Offset") != "0" {
+		t.Fatalf("创建上传 = %d, Upload-Offset = %q", resp.StatusCode, resp.Header.Get("Upload-Offset"))
+	}
+	return resp.Header.Get("Location")
+}
+
+// head 返回已接收的字节数，上传不存在时返回 -1
+func (tc *tusClient) head(t *testing.T, location string) int64 {
+	t.Helper()
+	resp := tc.do(http.MethodHead, location, nil, nil)
+	if resp.StatusCode == http.StatusNotFound {
+		return -1
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD = %d", resp.StatusCode)
+	}
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		t.Fatalf("Upload-Offset = %q", resp.Header.Get("Upload-Offset"))
+	}
+	return offset
+}
+
+func (tc *tusClient) patch(location string, offset int64, chunk []byte) *http.Response {
+	return tc.do(http.MethodPatch, location, bytes.NewReader(chunk), map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.FormatInt(offset, 10),
+	})
+}
+
+// interruptedPatch 声明整段数据的长度，只发送 sent 字节就断开连接，模拟上传中途断网
+func (tc *tusClient) interruptedPatch(t *testing.T, location string, offset int64, chunk []byte, sent int, keepOpen bool) net.Conn {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "PATCH %s HTTP/1.1\r\nHost: %s\r\nTus-Resumable: %s\r\nAuthorization: Bearer %s\r\n"+
+		"Content-Type: application/offset+octet-stream\r\nUpload-Offset: %d\r\nContent-Length: %d\r\n\r\n",
+		u.RequestURI(), u.Host, services.TusVersion, tc.token, offset, len(chunk))
+	conn.Write(chunk[:sent])
+	if keepOpen {
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	conn.Close()
+	return nil
+}
+
+func (tc *tusClient) status(t *testing.T, location string) services.TusUpload {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, location, nil)
+	req.Header.Set("Tus-Resumable", services.TusVersion)
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Data services.TusUpload `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Data
+}
+
+// waitOffset 等待服务端处理完断开的请求，HEAD 返回 want 为止
+func (tc *tusClient) waitOffset(t *testing.T, location string, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := tc.head(t, location)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Upload-Offset = %d, want %d", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitUnlocked 等待断开的请求释放写锁：offset 不一致的 PATCH 在拿到锁后返回 409，锁被占用时返回 423
+func (tc *tusClient) waitUnlocked(t *testing.T, location string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp := tc.patch(location, 1<<40, nil)
+		if resp.StatusCode != http.StatusLocked {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("上传的写锁一直没有释放")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testWAV 生成 1 秒 8kHz 单声道 16 位的 PCM 音频
+func testWAV() []byte {
+	const rate, seconds = 8000, 1
+	samples := make([]byte, rate*seconds*2)
+	for i := range samples {
+		samples[i] = byte(i * 7)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(samples)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []any{uint32(16), uint16(1), uint16(1), uint32(rate), uint32(rate * 2), uint16(2), uint16(16)})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(samples)))
+	buf.Write(samples)
+	return buf.Bytes()
+}
+
+func tusFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestTusUploadResumeRetryAndTerminate(t *testing.T) {
+	srv, store, dir := newTusTestServer(t)
+	tc := &tusClient{endpoint: srv.URL + "/music/v1/tus", token: testAdminToken}
+	data := testWAV()
+	const chunkSize = 4096
+
+	location := tc.create(t, len(data), map[string]string{"filename": "tus song.wav", "title": "Tus Song"})
+	if !strings.HasPrefix(location, tc.endpoint+"/") {
+		t.Fatalf("Location = %q", location)
+	}
+	if got := tc.head(t, location); got != 0 {
+		t.Fatalf("新上传的 offset = %d", got)
+	}
+
+	// 第一块正常上传
+	if resp := tc.patch(location, 0, data[:chunkSize]); resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get("Upload-Offset") != strconv.Itoa(chunkSize) {
+		t.Fatalf("PATCH = %d, Upload-Offset = %q", resp.StatusCode, resp.Header.Get("Upload-Offset"))
+	}
+	// offset 不一致时拒绝
+	if resp := tc.patch(location, 0, data[:chunkSize]); resp.StatusCode != http.StatusConflict {
+		t.Errorf("offset 不一致的 PATCH = %d, want 409", resp.StatusCode)
+	}
+
+	// 第二块发送到一半断开，已收到的部分保留
+	tc.interruptedPatch(t, location, chunkSize, data[chunkSize:2*chunkSize], 1000, false)
+	tc.waitOffset(t, location, chunkSize+1000)
+	tc.waitUnlocked(t, location)
+
+	// 写入过程中不能终止
+	conn := tc.interruptedPatch(t, location, chunkSize+1000, data[chunkSize+1000:2*chunkSize], 500, true)
+	tc.waitOffset(t, location, chunkSize+1500)
+	if resp := tc.do(http.MethodDelete, location, nil, nil); resp.StatusCode != http.StatusLocked {
+		t.Errorf("写入中的上传 DELETE = %d, want 423", resp.StatusCode)
+	}
+	conn.Close()
+	tc.waitUnlocked(t, location)
+
+	// 从 HEAD 返回的 offset 续传剩余部分，入库时存储暂时不可用
+	store.failPut.Store(true)
+	offset := tc.head(t, location)
+	if offset != chunkSize+1500 {
+		t.Fatalf("续传前 offset = %d", offset)
+	}
+	for offset < int64(len(data)) {
+		end := min(offset+chunkSize, int64(len(data)))
+		resp := tc.patch(location, offset, data[offset:end])
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("续传 PATCH = %d", resp.StatusCode)
+		}
+		offset, _ = strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+		if offset == int64(len(data)) && resp.Header.Get("X-Upload-Status") != services.ImportFailed {
+			t.Fatalf("存储不可用时 X-Upload-Status = %q", resp.Header.Get("X-Upload-Status"))
+		}
+	}
+
+	// 入库失败后数据仍在，上传保持未完成
+	u := tc.status(t, location)
+	if u.Completed || u.Offset != int64(len(data)) || u.Result == nil || u.Result.Status != services.ImportFailed {
+		t.Fatalf("入库失败后的状态 = %+v", u)
+	}
+	saved, err := os.ReadFile(filepath.Join(dir, u.ID+".bin"))
+	if err != nil || !bytes.Equal(saved, data) {
+		t.Fatalf("入库失败后暂存数据丢失或不完整, err = %v", err)
+	}
+
+	// 存储恢复后在最终 offset 处发送空的 PATCH 重新入库
+	store.failPut.Store(false)
+	resp := tc.patch(location, int64(len(data)), nil)
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("X-Upload-Status") != services.ImportCreated {
+		t.Fatalf("重试入库 = %d, X-Upload-Status = %q", resp.StatusCode, resp.Header.Get("X-Upload-Status"))
+	}
+	trackID, _ := strconv.ParseUint(resp.Header.Get("X-Track-ID"), 10, 64)
+	var track models.MusicInfo
+	if err := models.DB.First(&track, trackID).Error; err != nil {
+		t.Fatalf("入库的曲目 %d 不存在: %v", trackID, err)
+	}
+	if track.Name != "Tus Song" || track.Size != int64(len(data)) {
+		t.Errorf("入库的曲目 = %+v", track)
+	}
+	u = tc.status(t, location)
+	if !u.Completed || u.Result == nil || u.Result.Track == nil || u.Result.Track.ID != uint(trackID) {
+		t.Errorf("入库后的状态 = %+v", u)
+	}
+	if resp := tc.patch(location, int64(len(data)), nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("已完成的上传再次 PATCH = %d, want 409", resp.StatusCode)
+	}
+	// 入库成功后只保留状态记录
+	if files := tusFiles(t, dir); len(files) != 1 || files[0] != u.ID+".info" {
+		t.Errorf("入库后 tus 目录 = %v", files)
+	}
+
+	// 终止
+	if resp := tc.do(http.MethodDelete, location, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", resp.StatusCode)
+	}
+	if got := tc.head(t, location); got != -1 {
+		t.Errorf("终止后 HEAD offset = %d, want 404", got)
+	}
+	if files := tusFiles(t, dir); len(files) != 0 {
+		t.Errorf("终止后 tus 目录 = %v", files)
+	}
+}
+
+func TestTusTerminateIncompleteUpload(t *testing.T) {
+	srv, _, dir := newTusTestServer(t)
+	tc := &tusClient{endpoint: srv.URL + "/music/v1/tus", token: testAdminToken}
+	data := testWAV()
+
+	location := tc.create(t, len(data), map[string]string{"filename": "x.wav"})
+	if resp := tc.patch(location, 0, data[:100]); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PATCH = %d", resp.StatusCode)
+	}
+	if resp := tc.do(http.MethodDelete, location, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", resp.StatusCode)
+	}
+	if got := tc.head(t, location); got != -1 {
+		t.Errorf("终止后 HEAD offset = %d, want 404", got)
+	}
+	if resp := tc.patch(location, 100, data[100:200]); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("终止后 PATCH = %d, want 404", resp.StatusCode)
+	}
+	if files := tusFiles(t, dir); len(files) != 0 {
+		t.Errorf("终止后 tus 目录 = %v", files)
+	}
+}
+
+// 入库过程中数据仍在 tus 目录，HEAD 返回完整的 offset 而不是 404
+func TestTusHeadDuringIngest(t *testing.T) {
+	srv, store, dir := newTusTestServer(t)
+	tc := &tusClient{endpoint: srv.URL + "/music/v1/tus", token: testAdminToken}
+	data := testWAV()
+	store.putStarted, store.releasePut = make(chan struct{}), make(chan struct{})
+
+	location := tc.create(t, len(data), map[string]string{"filename": "slow.wav"})
+	done := make(chan *http.Response)
+	go func() { done <- tc.patch(location, 0, data) }()
+	select {
+	case <-store.putStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("入库没有开始")
+	}
+	if got := tc.head(t, location); got != int64(len(data)) {
+		t.Errorf("入库中 HEAD offset = %d, want %d", got, len(data))
+	}
+	close(store.releasePut)
+
+	resp := <-done
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("X-Upload-Status") != services.ImportCreated {
+		t.Fatalf("PATCH = %d, X-Upload-Status = %q", resp.StatusCode, resp.Header.Get("X-Upload-Status"))
+	}
+	if got := tc.head(t, location); got != int64(len(data)) {
+		t.Errorf("入库后 HEAD offset = %d, want %d", got, len(data))
+	}
+	u := tc.status(t, location)
+	if files := tusFiles(t, dir); len(files) != 1 || files[0] != u.ID+".info" {
+		t.Errorf("入库后 tus 目录 = %v", files)
+	}
+}
+
+// 引导令牌没有对应的用户，上传的私有曲目没有所有者，任何人都看不到
+func TestTusRejectsPrivateWithoutUser(t *testing.T) {
+	srv, _, dir := newTusTestServer(t)
+	tc := &tusClient{endpoint: srv.URL + "/music/v1/tus", token: testAdminToken}
+	meta := "filename " + base64.StdEncoding.EncodeToString([]byte("a.wav")) + ",visibility " + base64.StdEncoding.EncodeToString([]byte("private"))
+	resp := tc.do(http.MethodPost, tc.endpoint, nil, map[string]string{"Upload-Length": "100", "Upload-Metadata": meta})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("引导令牌创建私有上传 = %d, want 400", resp.StatusCode)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("被拒绝的上传不应写入 tus 目录: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"Music/config"
+	"Music/middleware"
+	"Music/services"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var uploadService = services.NewUploadService()
+
+// UploadMusic 上传一个或多个音频文件（multipart/form-data）
+//
+// 字段：file（可重复）音频文件；cover 可选的封面图片，用于本次上传的全部曲目；
+// title / artist / albumartist / album / track / disc / year / genre 可选，覆盖标签中的值；
+// visibility 可选 shared（默认）/ private，曲目归上传者所有；使用引导令牌上传时没有所有者，只能为 shared
+func UploadMusic(c *gin.Context) {
+	maxMB := config.Config.Server.MaxUploadMB
+	if maxMB <= 0 {
+		maxMB = 2048
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxMB<<20)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid multipart form: " + err.Error()})
+		return
+	}
+	defer form.RemoveAll()
+	files := form.File["file"]
+	if len(files) == 0 {
+		c.JSON(400, gin.H{"error": "no file"})
+		return
+	}
+
+	own, err := services.ParseOwnership(middleware.CurrentPrincipal(c).UserID, c.PostForm("visibility"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "field": "visibility"})
+		return
+	}
+
+	overrides := services.UploadOverrides{}
+	for _, field := range services.UploadOverrideFields {
+		overrides[field] = c.PostForm(field)
+	}
+
+	cover := ""
+	if covers := form.File["cover"]; len(covers) > 0 {
+		data, err := readFormFile(covers[0])
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid cover: " + err.Error()})
+			return
+		}
+		cover, err = uploadService.SaveCover(c.Request.Context(), data)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid cover: " + err.Error()})
+			return
+		}
+	}
+
+	results := make([]services.UploadResult, 0, len(files))
+	for _, fh := range files {
+		results = append(results, ingestUploadedFile(c, fh, overrides, cover, own))
+	}
+	c.JSON(200, gin.H{"data": results})
+}
+
+// ingestUploadedFile 以原始文件名保存到临时目录后入库，文件名参与路径模板匹配
+func ingestUploadedFile(c *gin.Context, fh *multipart.FileHeader, overrides services.UploadOverrides, cover string, own services.Ownership) services.UploadResult {
+	name := filepath.Base(strings.ReplaceAll(fh.Filename, `\`, "/"))
+	if name == "." || name == "/" {
+		name = "upload"
+	}
+	dir, err := os.MkdirTemp("", "upload-*")
+	if err != nil {
+		return services.UploadResult{File: name, Status: services.ImportFailed, Error: err.Error()}
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	if err := c.SaveUploadedFile(fh, path); err != nil {
+		return services.UploadResult{File: name, Status: services.ImportFailed, Error: err.Error()}
+	}
+	return uploadService.Ingest(path, overrides, cover, own)
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
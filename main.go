@@ -2,9 +2,16 @@ package main
 
 import (
 	"Music/config"
+	"Music/middleware"
+	"Music/migrations"
 	"Music/models"
 	"Music/my_utils"
 	"Music/router"
+	_ "Music/s3_storage"
+	"Music/services"
+	"Music/storage"
+	_ "Music/tengcent_cos"
+	"context"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,6 +31,17 @@ func main() {
 
 	// Init Database
 	models.Init()
+	if err := migrations.EnsureUpToDate(models.DB, config.Config.Database.AutoMigrate); err != nil {
+		my_utils.Fatal("数据库版本检查失败: %v", err)
+	}
+
+	// Init Storage
+	if err := storage.Init(); err != nil {
+		my_utils.Fatal("存储初始化失败: %v", err)
+	}
+
+	// 后台提交 scrobble 队列
+	go services.NewScrobbleService().Run(context.Background())
 
 	// test
 	//services := services.MusicService{}
@@ -41,7 +59,9 @@ func main() {
 	// test
 
 	// 初始化路由
-	r := gin.Default()
+	// 查询参数中的 API 密钥先移到请求头，不写进访问日志
+	r := gin.New()
+	r.Use(middleware.MoveQueryCredentials(), gin.Logger(), gin.Recovery())
 	router.InitRouter(r)
 
 	// 启动服务
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"Music/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"strings"
+)
+
+// principalKey gin.Context 中保存调用方的键
+const principalKey = "principal"
+
+// 插件（如 MusicFree）只能在播放地址里带凭据，允许通过这些查询参数传递 API 密钥
+var credentialParams = []string{"key", "api_key"}
+
+// Subsonic 接口（/rest）在查询参数中传递的凭据，见 SubsonicCredential
+var subsonicCredentialParams = []string{"p", "t", "s", "apiKey"}
+
+// subsonicCredentialsKey gin.Context 中保存 Subsonic 凭据的键
+const subsonicCredentialsKey = "subsonic_credentials"
+
+var authService = services.NewAuthService()
+
+// bearerToken 从 Authorization: Bearer <token> 中取出令牌
+func bearerToken(c *gin.Context) string {
+	h := c.GetHeader("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// credential 依次从 Authorization、X-API-Key 中取凭据；查询参数中的密钥已由 MoveQueryCredentials 移到 X-API-Key
+func credential(c *gin.Context) string {
+	if token := bearerToken(c); token != "" {
+		return token
+	}
+	return strings.TrimSpace(c.GetHeader("X-API-Key"))
+}
+
+// MoveQueryCredentials 把查询参数中的 API 密钥移到 X-API-Key 请求头并从 URL 中去掉，
+// Subsonic 接口的密码和 token 移到 gin.Context 中，避免凭据写进访问日志；需注册在日志中间件之前
+func MoveQueryCredentials() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.RawQuery == "" {
+			c.Next()
+			return
+		}
+		query, err := url.ParseQuery(c.Request.URL.RawQuery)
+		if err != nil {
+			c.Next()
+			return
+		}
+		moved := false
+		for _, name := range credentialParams {
+			if v := query.Get(name); v != "" && c.GetHeader("X-API-Key") == "" {
+				c.Request.Header.Set("X-API-Key", v)
+			}
+			if _, ok := query[name]; ok {
+				query.Del(name)
+				moved = true
+			}
+		}
+		if strings.HasPrefix(c.Request.URL.Path, "/rest/") {
+			creds := url.Values{}
+			for _, name := range subsonicCredentialParams {
+				if v, ok := query[name]; ok {
+					creds[name] = v
+					query.Del(name)
+					moved = true
+				}
+			}
+			c.Set(subsonicCredentialsKey, creds)
+		}
+		if moved {
+			c.Request.URL.RawQuery = query.Encode()
+		}
+		c.Next()
+	}
+}
+
+// Authenticate 识别请求中的凭据，识别成功时保存调用方；没有凭据时放行，由 RequireScope 决定是否拒绝，
+// 凭据无效时直接返回 401
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := credential(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+		principal, err := authService.Authenticate(token)
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			unauthorized(c, "invalid token")
+			return
+		case errors.Is(err, services.ErrUserDisabled):
+			c.AbortWithStatusJSON(403, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// CurrentPrincipal 当前请求的调用方，未认证时返回 nil
+func CurrentPrincipal(c *gin.Context) *services.Principal {
+	if v, ok := c.Get(principalKey); ok {
+		return v.(*services.Principal)
+	}
+	return nil
+}
+
+// SetPrincipal 保存其他方式（如 Subsonic 接口）认证的调用方
+func SetPrincipal(c *gin.Context, p *services.Principal) {
+	c.Set(principalKey, p)
+}
+
+// SubsonicCredential MoveQueryCredentials 从 URL 中取出的 Subsonic 凭据，没有时读取表单（POST 请求）
+func SubsonicCredential(c *gin.Context, name string) string {
+	if v, ok := c.Get(subsonicCredentialsKey); ok {
+		if creds := v.(url.Values); creds.Has(name) {
+			return creds.Get(name)
+		}
+	}
+	return c.PostForm(name)
+}
+
+// RequireAuth 要求已认证，不限权限
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentPrincipal(c) == nil {
+			unauthorized(c, "unauthorized")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope 要求调用方拥有 scope 权限，需在 Authenticate 之后使用
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := CurrentPrincipal(c)
+		if p == nil {
+			unauthorized(c, "unauthorized")
+			return
+		}
+		if !p.Has(scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "missing scope: " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, msg string) {
+	c.Header("WWW-Authenticate", `Bearer realm="music"`)
+	c.AbortWithStatusJSON(401, gin.H{"error": msg})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// 基线：与此前 AutoMigrate 创建的表结构一致，已有的表不会被改动
+type musicInfoV1 struct {
+	ID       uint `gorm:"primaryKey"`
+	Singer   string
+	Album    string
+	Name     string
+	Cover    string
+	Location string
+}
+
+func (musicInfoV1) TableName() string {
+	return "music_infos"
+}
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "create_music_infos",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &musicInfoV1{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&musicInfoV1{})
+		},
+	})
+}
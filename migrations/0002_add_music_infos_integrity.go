@@ -0,0 +1,23 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type musicInfoV2 struct {
+	musicInfoV1
+	Size   int64
+	SHA256 string `gorm:"column:sha256;size:64"`
+	Broken bool   `gorm:"not null;default:false"`
+}
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "add_music_infos_integrity",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &musicInfoV2{}, "Size", "SHA256", "Broken")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &musicInfoV2{}, "Size", "SHA256", "Broken")
+		},
+	})
+}
@@ -0,0 +1,199 @@
+package migrations
+
+import (
+	"Music/my_utils"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type artistV3 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:255;not null"`
+	SortName  string `gorm:"size:255"`
+	CreatedAt time.Time
+}
+
+func (artistV3) TableName() string { return "artists" }
+
+type artistAliasV3 struct {
+	ID       uint   `gorm:"primaryKey"`
+	ArtistID uint   `gorm:"index;not null"`
+	Name     string `gorm:"size:255;not null;uniqueIndex"`
+}
+
+func (artistAliasV3) TableName() string { return "artist_aliases" }
+
+type albumV3 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Title     string `gorm:"size:255;not null;uniqueIndex:idx_albums_title_artist"`
+	ArtistID  uint   `gorm:"not null;uniqueIndex:idx_albums_title_artist"`
+	Year      int
+	Genre     string `gorm:"size:64"`
+	Cover     string
+	CreatedAt time.Time
+}
+
+func (albumV3) TableName() string { return "albums" }
+
+type trackArtistV3 struct {
+	MusicID  uint   `gorm:"primaryKey;autoIncrement:false"`
+	ArtistID uint   `gorm:"primaryKey;autoIncrement:false;index"`
+	Role     string `gorm:"primaryKey;size:32"`
+	Position int
+}
+
+func (trackArtistV3) TableName() string { return "track_artists" }
+
+type musicInfoV3 struct {
+	musicInfoV2
+	AlbumArtist string
+	AlbumID     *uint `gorm:"index"`
+	TrackNumber int
+	DiscNumber  int
+	Duration    int64
+	Year        int
+	Genre       string `gorm:"size:64"`
+}
+
+var musicInfoV3Columns = []string{"AlbumArtist", "AlbumID", "TrackNumber", "DiscNumber", "Duration", "Year", "Genre"}
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "create_catalog",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &artistV3{}, &artistAliasV3{}, &albumV3{}, &trackArtistV3{}); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &musicInfoV3{}, musicInfoV3Columns...); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &musicInfoV3{}, "AlbumID"); err != nil {
+				return err
+			}
+			return convertCatalogV3(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndex(tx, &musicInfoV3{}, "AlbumID"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &musicInfoV3{}, musicInfoV3Columns...); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&trackArtistV3{}, &albumV3{}, &artistAliasV3{}, &artistV3{})
+		},
+	})
+}
+
+// convertCatalogV3 把已有记录中的 Singer / Album 字符串转换为艺人、专辑和关联；
+// 重新执行时沿用上次已创建的艺人、专辑，已有署名的曲目不再重复写入
+func convertCatalogV3(tx *gorm.DB) error {
+	artists := map[string]uint{} // 小写名称 -> 艺人 ID
+	albums := map[string]uint{}  // 小写标题 + 艺人 ID -> 专辑 ID
+	credited := map[uint]bool{}  // 已有署名的曲目
+
+	var aliases []artistAliasV3
+	if err := tx.Find(&aliases).Error; err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		artists[strings.ToLower(a.Name)] = a.ArtistID
+	}
+	var existing []albumV3
+	if err := tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	for _, a := range existing {
+		albums[fmt.Sprintf("%s\x00%d", strings.ToLower(a.Title), a.ArtistID)] = a.ID
+	}
+	var creditedIDs []uint
+	if err := tx.Model(&trackArtistV3{}).Distinct("music_id").Pluck("music_id", &creditedIDs).Error; err != nil {
+		return err
+	}
+	for _, id := range creditedIDs {
+		credited[id] = true
+	}
+
+	resolveArtist := func(name string) (uint, error) {
+		key := strings.ToLower(name)
+		if id, ok := artists[key]; ok {
+			return id, nil
+		}
+		a := artistV3{Name: name, SortName: name, CreatedAt: time.Now()}
+		if err := tx.Create(&a).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Create(&artistAliasV3{ArtistID: a.ID, Name: name}).Error; err != nil {
+			return 0, err
+		}
+		artists[key] = a.ID
+		return a.ID, nil
+	}
+
+	type row struct {
+		ID     uint
+		Singer string
+		Album  string
+	}
+	var lastID uint
+	for {
+		var rows []row
+		err := tx.Table("music_infos").Select("id", "singer", "album").
+			Where("id > ?", lastID).Order("id").Limit(500).Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		lastID = rows[len(rows)-1].ID
+		for _, row := range rows {
+			mainNames, featuring := my_utils.SplitArtists(row.Singer)
+			var credits []trackArtistV3
+			for i, name := range mainNames {
+				id, err := resolveArtist(name)
+				if err != nil {
+					return err
+				}
+				credits = append(credits, trackArtistV3{MusicID: row.ID, ArtistID: id, Role: "main", Position: i})
+			}
+			for i, name := range featuring {
+				id, err := resolveArtist(name)
+				if err != nil {
+					return err
+				}
+				credits = append(credits, trackArtistV3{MusicID: row.ID, ArtistID: id, Role: "featuring", Position: len(mainNames) + i})
+			}
+			if len(credits) > 0 && !credited[row.ID] {
+				if err := tx.Create(&credits).Error; err != nil {
+					return err
+				}
+			}
+
+			title := strings.TrimSpace(row.Album)
+			if title == "" || len(mainNames) == 0 {
+				continue
+			}
+			albumArtistID := credits[0].ArtistID
+			key := fmt.Sprintf("%s\x00%d", strings.ToLower(title), albumArtistID)
+			albumID, ok := albums[key]
+			if !ok {
+				a := albumV3{Title: title, ArtistID: albumArtistID, CreatedAt: time.Now()}
+				if err := tx.Create(&a).Error; err != nil {
+					return err
+				}
+				albumID = a.ID
+				albums[key] = albumID
+			}
+			err := tx.Table("music_infos").Where("id = ?", row.ID).Updates(map[string]interface{}{
+				"album_id":     albumID,
+				"album_artist": mainNames[0],
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
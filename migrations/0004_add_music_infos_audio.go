@@ -0,0 +1,27 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type musicInfoV4 struct {
+	musicInfoV3
+	Codec      string `gorm:"size:16"`
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	BitDepth   int
+}
+
+var musicInfoV4Columns = []string{"Codec", "Bitrate", "SampleRate", "Channels", "BitDepth"}
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "add_music_infos_audio",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &musicInfoV4{}, musicInfoV4Columns...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &musicInfoV4{}, musicInfoV4Columns...)
+		},
+	})
+}
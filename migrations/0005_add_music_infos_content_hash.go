@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"errors"
+	"gorm.io/gorm"
+)
+
+type musicInfoV5 struct {
+	musicInfoV4
+	ObjectKey string `gorm:"size:255;index"`
+	AudioHash string `gorm:"size:64;index"`
+}
+
+var musicInfoV5Columns = []string{"ObjectKey", "AudioHash"}
+
+const sha256IndexV5 = "idx_music_infos_sha256"
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "add_music_infos_content_hash",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &musicInfoV5{}, musicInfoV5Columns...); err != nil {
+				return err
+			}
+			for _, f := range []string{"ObjectKey", "AudioHash"} {
+				if err := createIndex(tx, &musicInfoV5{}, f); err != nil {
+					return err
+				}
+			}
+			// sha256 列来自 0002 的快照，快照中没有索引定义，直接建
+			if !tx.Migrator().HasIndex(&musicInfoV5{}, sha256IndexV5) {
+				if err := tx.Exec("CREATE INDEX " + sha256IndexV5 + " ON music_infos (sha256)").Error; err != nil {
+					return err
+				}
+			}
+			// 已有曲目的对象仍以 ID 为 key
+			return tx.Exec("UPDATE music_infos SET object_key = CAST(id AS CHAR) WHERE object_key IS NULL OR object_key = ''").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			// 回滚后只能按 ID 定位对象，按哈希存储的曲目会找不到音频
+			if tx.Migrator().HasColumn(&musicInfoV5{}, "ObjectKey") {
+				var count int64
+				if err := tx.Table("music_infos").Where("object_key <> CAST(id AS CHAR)").Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return errors.New("存在按内容哈希存储的曲目，无法回滚")
+				}
+			}
+			for _, f := range []string{"ObjectKey", "AudioHash", sha256IndexV5} {
+				if err := dropIndex(tx, &musicInfoV5{}, f); err != nil {
+					return err
+				}
+			}
+			return dropColumns(tx, &musicInfoV5{}, musicInfoV5Columns...)
+		},
+	})
+}
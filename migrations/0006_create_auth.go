@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type userV6 struct {
+	ID           uint   `gorm:"primaryKey"`
+	Username     string `gorm:"size:64;not null;uniqueIndex"`
+	PasswordHash string `gorm:"size:255;not null"`
+	Scopes       string `gorm:"size:255"`
+	Disabled     bool   `gorm:"not null;default:false"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (userV6) TableName() string { return "users" }
+
+type apiKeyV6 struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"size:64"`
+	Prefix     string `gorm:"size:16"`
+	KeyHash    string `gorm:"size:64;not null;uniqueIndex"`
+	Scopes     string `gorm:"size:255"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (apiKeyV6) TableName() string { return "api_keys" }
+
+type refreshTokenV6 struct {
+	ID        string    `gorm:"primaryKey;size:32"`
+	UserID    uint      `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+func (refreshTokenV6) TableName() string { return "refresh_tokens" }
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "create_auth",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &userV6{}, &apiKeyV6{}, &refreshTokenV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&refreshTokenV6{}, &apiKeyV6{}, &userV6{})
+		},
+	})
+}
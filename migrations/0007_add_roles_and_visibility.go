@@ -0,0 +1,72 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// userV7 用角色代替逐个用户配置的权限
+type userV7 struct {
+	userV6
+	Role string `gorm:"size:16;not null;default:listener"`
+}
+
+func (userV7) TableName() string { return "users" }
+
+type musicInfoV7 struct {
+	musicInfoV5
+	OwnerID    *uint  `gorm:"index"`
+	Visibility string `gorm:"size:16;not null;default:shared"`
+}
+
+var musicInfoV7Columns = []string{"OwnerID", "Visibility"}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "add_roles_and_visibility",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &userV7{}, "Role"); err != nil {
+				return err
+			}
+			// 按原有权限取最接近的角色；scopes 列已删除说明上次执行时已经转换过
+			if tx.Migrator().HasColumn(&userV6{}, "Scopes") {
+				err := tx.Exec(`UPDATE users SET role = CASE
+					WHEN scopes LIKE '%admin%' THEN 'admin'
+					WHEN scopes LIKE '%upload%' THEN 'uploader'
+					ELSE 'listener' END`).Error
+				if err != nil {
+					return err
+				}
+				if err := dropColumns(tx, &userV6{}, "Scopes"); err != nil {
+					return err
+				}
+			}
+			// 已有曲目没有所有者，保持共享
+			if err := addColumns(tx, &musicInfoV7{}, musicInfoV7Columns...); err != nil {
+				return err
+			}
+			return createIndex(tx, &musicInfoV7{}, "OwnerID")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndex(tx, &musicInfoV7{}, "OwnerID"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &musicInfoV7{}, musicInfoV7Columns...); err != nil {
+				return err
+			}
+			// role 列已删除说明上次执行时已经转换过
+			if !tx.Migrator().HasColumn(&userV7{}, "Role") {
+				return nil
+			}
+			if err := addColumns(tx, &userV6{}, "Scopes"); err != nil {
+				return err
+			}
+			err := tx.Exec(`UPDATE users SET scopes = CASE role
+				WHEN 'admin' THEN 'listen,upload,admin'
+				WHEN 'uploader' THEN 'listen,upload'
+				ELSE 'listen' END`).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(tx, &userV7{}, "Role")
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type playlistV8 struct {
+	ID          uint    `gorm:"primaryKey"`
+	OwnerID     uint    `gorm:"index;not null"`
+	Name        string  `gorm:"size:255;not null"`
+	Description string  `gorm:"size:1000"`
+	Revision    int     `gorm:"not null;default:1"`
+	ShareToken  *string `gorm:"size:32;uniqueIndex"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (playlistV8) TableName() string { return "playlists" }
+
+type playlistTrackV8 struct {
+	ID         uint `gorm:"primaryKey"`
+	PlaylistID uint `gorm:"index;not null"`
+	MusicID    uint `gorm:"index;not null"`
+	Position   int  `gorm:"not null"`
+	AddedBy    uint
+	AddedAt    time.Time
+}
+
+func (playlistTrackV8) TableName() string { return "playlist_tracks" }
+
+type playlistCollaboratorV8 struct {
+	PlaylistID uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID     uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time
+}
+
+func (playlistCollaboratorV8) TableName() string { return "playlist_collaborators" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "create_playlists",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &playlistV8{}, &playlistTrackV8{}, &playlistCollaboratorV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&playlistCollaboratorV8{}, &playlistTrackV8{}, &playlistV8{})
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type favoriteV9 struct {
+	UserID    uint `gorm:"primaryKey;autoIncrement:false"`
+	MusicID   uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time
+}
+
+func (favoriteV9) TableName() string { return "favorites" }
+
+type ratingV9 struct {
+	UserID    uint `gorm:"primaryKey;autoIncrement:false"`
+	MusicID   uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Stars     int  `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (ratingV9) TableName() string { return "ratings" }
+
+type playEventV9 struct {
+	ID       uint      `gorm:"primaryKey"`
+	UserID   uint      `gorm:"index:idx_play_events_user_time,priority:1;not null"`
+	MusicID  uint      `gorm:"index;not null"`
+	PlayedAt time.Time `gorm:"index:idx_play_events_user_time,priority:2;not null"`
+	Client   string    `gorm:"size:128"`
+	Partial  bool      `gorm:"not null;default:false"`
+}
+
+func (playEventV9) TableName() string { return "play_events" }
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "create_library",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &favoriteV9{}, &ratingV9{}, &playEventV9{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&playEventV9{}, &ratingV9{}, &favoriteV9{})
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type scrobbleAccountV10 struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_scrobble_accounts_user_service"`
+	Service   string `gorm:"size:16;not null;uniqueIndex:idx_scrobble_accounts_user_service"`
+	Token     string `gorm:"size:255;not null"`
+	Username  string `gorm:"size:255"`
+	Enabled   bool   `gorm:"not null;default:true"`
+	LastError string `gorm:"size:500"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (scrobbleAccountV10) TableName() string { return "scrobble_accounts" }
+
+type scrobbleJobV10 struct {
+	ID          uint      `gorm:"primaryKey"`
+	AccountID   uint      `gorm:"index;not null"`
+	PlayEventID uint      `gorm:"index"`
+	Artist      string    `gorm:"size:255;not null"`
+	Track       string    `gorm:"size:255;not null"`
+	Album       string    `gorm:"size:255"`
+	DurationMs  int64     `gorm:"not null;default:0"`
+	ListenedAt  time.Time `gorm:"not null"`
+	DueAt       time.Time `gorm:"index;not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	LastError   string    `gorm:"size:500"`
+	CreatedAt   time.Time
+}
+
+func (scrobbleJobV10) TableName() string { return "scrobble_jobs" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "create_scrobble",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &scrobbleAccountV10{}, &scrobbleJobV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&scrobbleJobV10{}, &scrobbleAccountV10{})
+		},
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type userV11 struct {
+	userV7
+	SubsonicPassword string `gorm:"size:64"`
+}
+
+func (userV11) TableName() string { return "users" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "add_users_subsonic_password",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &userV11{}, "SubsonicPassword")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &userV11{}, "SubsonicPassword")
+		},
+	})
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// addColumns 添加缺少的列；此前由 AutoMigrate 创建过的列会被跳过
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	m := tx.Migrator()
+	for _, f := range fields {
+		if m.HasColumn(model, f) {
+			continue
+		}
+		if err := m.AddColumn(model, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	m := tx.Migrator()
+	for _, f := range fields {
+		if !m.HasColumn(model, f) {
+			continue
+		}
+		if err := m.DropColumn(model, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTables 创建缺少的表；MySQL 的 DDL 不能回滚，迁移中途失败后重新执行时跳过已经建好的表
+func createTables(tx *gorm.DB, models ...interface{}) error {
+	m := tx.Migrator()
+	for _, model := range models {
+		if m.HasTable(model) {
+			continue
+		}
+		if err := m.CreateTable(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndex 创建缺少的索引，name 为字段名或索引名
+func createIndex(tx *gorm.DB, model interface{}, name string) error {
+	if tx.Migrator().HasIndex(model, name) {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(model, name)
+}
+
+func dropIndex(tx *gorm.DB, model interface{}, name string) error {
+	if !tx.Migrator().HasIndex(model, name) {
+		return nil
+	}
+	return tx.Migrator().DropIndex(model, name)
+}
@@ -0,0 +1,227 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// Migration 一个带版本号的数据库迁移，Up/Down 与 schema_migrations 的记录放在同一个事务中执行。
+// 只有 SQLite 的 DDL 是事务性的；MySQL 每条 DDL 语句都会隐式提交，迁移中途失败时已执行的部分不会回滚，
+// 也不会留下 schema_migrations 记录，再次执行时会从头开始。因此 Up/Down 的每一步都必须可以重复执行：
+// 建表、加列、建索引前检查是否已存在，数据转换跳过已转换的记录`
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 记录已执行的迁移
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// ErrDatabaseAhead 数据库中有当前程序不认识的迁移，说明程序版本比数据库旧
+var ErrDatabaseAhead = errors.New("数据库版本高于程序版本")
+
+// ErrPending 存在尚未执行的迁移
+var ErrPending = errors.New("存在未执行的数据库迁移")
+
+var all []Migration
+
+// register 注册迁移，在各迁移文件的 init 中调用
+func register(m Migration) {
+	for _, existing := range all {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("migrations: 重复的版本号 %d", m.Version))
+		}
+	}
+	all = append(all, m)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+}
+
+// All 返回按版本排序的全部迁移
+func All() []Migration {
+	return all
+}
+
+// Latest 程序内置的最新迁移版本
+func Latest() int {
+	if len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+func applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("创建 schema_migrations 失败: %v", err)
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int]SchemaMigration, len(rows))
+	for _, r := range rows {
+		done[r.Version] = r
+	}
+	return done, nil
+}
+
+// Current 数据库当前的迁移版本
+func Current(db *gorm.DB) (int, error) {
+	done, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for v := range done {
+		current = max(current, v)
+	}
+	return current, nil
+}
+
+// Up 依次执行版本不超过 target 的未执行迁移，target 为 0 时执行到最新
+func Up(db *gorm.DB, target int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKnown(done); err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = Latest()
+	}
+	var ran []Migration
+	for _, m := range all {
+		if m.Version > target {
+			break
+		}
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("迁移 %04d_%s 失败: %v", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down 按版本从高到低回滚已执行的迁移，直到数据库版本为 target
+func Down(db *gorm.DB, target int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKnown(done); err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for i := len(all) - 1; i >= 0; i-- {
+		m := all[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("回滚 %04d_%s 失败: %v", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// StatusEntry 一条迁移的执行状态
+type StatusEntry struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool // 数据库中存在但程序中没有
+}
+
+func Status(db *gorm.DB) ([]StatusEntry, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var entries []StatusEntry
+	known := map[int]bool{}
+	for _, m := range all {
+		known[m.Version] = true
+		r, ok := done[m.Version]
+		entries = append(entries, StatusEntry{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: r.AppliedAt})
+	}
+	for v, r := range done {
+		if !known[v] {
+			entries = append(entries, StatusEntry{Version: v, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Version < entries[j].Version })
+	return entries, nil
+}
+
+// checkKnown 数据库中有程序不认识的迁移时拒绝继续
+func checkKnown(done map[int]SchemaMigration) error {
+	known := map[int]bool{}
+	for _, m := range all {
+		known[m.Version] = true
+	}
+	for v, r := range done {
+		if !known[v] {
+			return fmt.Errorf("%w: 未知迁移 %04d_%s，请升级程序", ErrDatabaseAhead, v, r.Name)
+		}
+	}
+	return nil
+}
+
+// EnsureUpToDate 启动时检查数据库版本：高于程序时拒绝启动；
+// 有未执行的迁移时，autoMigrate 为 true 则自动执行，否则拒绝启动
+func EnsureUpToDate(db *gorm.DB, autoMigrate bool) error {
+	done, err := applied(db)
+	if err != nil {
+		return err
+	}
+	if err := checkKnown(done); err != nil {
+		return err
+	}
+	pending := 0
+	for _, m := range all {
+		if _, ok := done[m.Version]; !ok {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return nil
+	}
+	if !autoMigrate {
+		return fmt.Errorf("%w（%d 个），请先执行 go run ./cmd migrate up", ErrPending, pending)
+	}
+	_, err = Up(db, 0)
+	return err
+}
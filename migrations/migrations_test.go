@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "music.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func count(t *testing.T, db *gorm.DB, table string) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Table(table).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// MySQL 的 DDL 不在事务中，迁移中途失败后会从头重新执行，已完成的步骤必须能再执行一次
+func TestMigrationsCanBeRerun(t *testing.T) {
+	db := openTestDB(t)
+	for _, m := range All() {
+		switch m.Version {
+		case 3:
+			err := db.Exec(`INSERT INTO music_infos (singer, album, name) VALUES
+				('陈奕迅 feat. 王菲', '黑白灰', '十年'), ('陈奕迅', '黑白灰', '浮夸'), ('', '', '未知')`).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		case 7:
+			if err := db.Exec(`INSERT INTO users (username, password_hash, scopes) VALUES ('admin', 'x', 'listen,upload,admin')`).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 2; i++ {
+			if err := m.Up(db); err != nil {
+				t.Fatalf("%04d_%s 第 %d 次执行 Up 失败: %v", m.Version, m.Name, i+1, err)
+			}
+		}
+	}
+
+	if n := count(t, db, "artists"); n != 2 {
+		t.Errorf("艺人数 = %d, want 2", n)
+	}
+	if n := count(t, db, "albums"); n != 1 {
+		t.Errorf("专辑数 = %d, want 1", n)
+	}
+	if n := count(t, db, "track_artists"); n != 3 {
+		t.Errorf("署名数 = %d, want 3", n)
+	}
+	var role string
+	if err := db.Table("users").Select("role").Where("username = ?", "admin").Scan(&role).Error; err != nil || role != "admin" {
+		t.Errorf("转换后的角色 = %q, %v", role, err)
+	}
+
+	for i := len(all) - 1; i >= 0; i-- {
+		m := all[i]
+		for j := 0; j < 2; j++ {
+			if err := m.Down(db); err != nil {
+				t.Fatalf("%04d_%s 第 %d 次执行 Down 失败: %v", m.Version, m.Name, j+1, err)
+			}
+		}
+	}
+	if db.Migrator().HasTable("music_infos") {
+		t.Error("全部回滚后不应留下 music_infos")
+	}
+}
+
+func TestUpRecordsVersions(t *testing.T) {
+	db := openTestDB(t)
+	ran, err := Up(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(All()) {
+		t.Errorf("执行了 %d 个迁移, want %d", len(ran), len(All()))
+	}
+	if current, err := Current(db); err != nil || current != Latest() {
+		t.Errorf("Current = %d, %v, want %d", current, err, Latest())
+	}
+	if ran, err := Up(db, 0); err != nil || len(ran) != 0 {
+		t.Errorf("重复 Up = %d 个, %v", len(ran), err)
+	}
+	if err := EnsureUpToDate(db, false); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Album 专辑，按 标题 + 专辑艺人 唯一
+type Album struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Title     string    `gorm:"size:255;not null;uniqueIndex:idx_albums_title_artist" json:"title"`
+	ArtistID  uint      `gorm:"not null;uniqueIndex:idx_albums_title_artist" json:"artist_id"` // 专辑艺人
+	Year      int       `json:"year,omitempty"`
+	Genre     string    `gorm:"size:64" json:"genre,omitempty"`
+	Cover     string    `json:"cover,omitempty"` // 封面图片的 SHA-256，同 MusicInfo.Cover
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Artist 艺人；同一艺人的不同写法（如 周杰伦 / Jay Chou）通过 ArtistAlias 归并
+type Artist struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	SortName  string    `gorm:"size:255" json:"sort_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ArtistAlias 艺人的别名，艺人的主名称也会登记为一个别名
+type ArtistAlias struct {
+	ID       uint   `gorm:"primaryKey"`
+	ArtistID uint   `gorm:"index;not null"`
+	Name     string `gorm:"size:255;not null;uniqueIndex"`
+}
+
+// 曲目中艺人的角色
+const (
+	RoleMain      = "main"
+	RoleFeaturing = "featuring"
+)
+
+// TrackArtist 曲目与艺人的多对多关联
+type TrackArtist struct {
+	MusicID  uint   `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	ArtistID uint   `gorm:"primaryKey;autoIncrement:false;index" json:"artist_id"`
+	Role     string `gorm:"primaryKey;size:32" json:"role"`
+	Position int    `json:"-"` // 同一曲目内的署名顺序
+	Artist   Artist `gorm:"foreignKey:ArtistID" json:"artist"`
+}
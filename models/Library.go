@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Favorite 用户收藏（喜欢）的曲目
+type Favorite struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	MusicID   uint      `gorm:"primaryKey;autoIncrement:false;index" json:"music_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Rating 用户给曲目的评分，1 到 5 星
+type Rating struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	MusicID   uint      `gorm:"primaryKey;autoIncrement:false;index" json:"music_id"`
+	Stars     int       `gorm:"not null" json:"stars"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PlayEvent 一次播放请求；Partial 表示拖动进度或续传等不是从头开始的 Range 请求，
+// 统计播放次数时只计算 Partial 为 false 的记录
+type PlayEvent struct {
+	ID       uint      `gorm:"primaryKey" json:"id"`
+	UserID   uint      `gorm:"index:idx_play_events_user_time,priority:1;not null" json:"-"`
+	MusicID  uint      `gorm:"index;not null" json:"music_id"`
+	PlayedAt time.Time `gorm:"index:idx_play_events_user_time,priority:2;not null" json:"played_at"`
+	Client   string    `gorm:"size:128" json:"client"`
+	Partial  bool      `gorm:"not null;default:false" json:"partial"`
+}
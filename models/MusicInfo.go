@@ -1,10 +1,49 @@
 package models
 
+import "strconv"
+
+// MusicInfo 即曲目（track）表。Singer / Album / AlbumArtist 是冗余的展示字段，
+// 规范化的艺人和专辑信息见 Credits 与 AlbumID
 type MusicInfo struct {
-	ID       uint `gorm:"primaryKey"`
-	Singer   string
-	Album    string
-	Name     string
-	Cover    string
-	Location string
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Singer      string `json:"singer"`
+	Album       string `json:"album"`
+	AlbumArtist string `json:"album_artist"`
+	Name        string `json:"name"`
+	AlbumID     *uint  `gorm:"index" json:"album_id"`
+	TrackNumber int    `json:"track_number,omitempty"`
+	DiscNumber  int    `json:"disc_number,omitempty"`
+	Duration    int64  `json:"duration,omitempty"` // 时长（毫秒）
+	Year        int    `json:"year,omitempty"`
+	Genre       string `gorm:"size:64" json:"genre,omitempty"`
+	Cover       string `json:"cover,omitempty"` // 封面图片的 SHA-256，对象 key 为 artwork/<sha256>
+	Location    string `json:"-"`
+	Size        int64  `json:"size,omitempty"`                                      // 音频文件字节数
+	SHA256      string `gorm:"column:sha256;size:64;index" json:"sha256,omitempty"` // 音频文件内容哈希（十六进制）
+	AudioHash   string `gorm:"size:64;index" json:"audio_hash,omitempty"`           // 去掉标签后的音频数据哈希，只支持 MP3 / FLAC
+	ObjectKey   string `gorm:"size:255;index" json:"-"`                             // 存储中的对象 key，由内容哈希决定
+	Broken      bool   `gorm:"not null;default:false" json:"broken,omitempty"`      // 一致性检查发现存储对象丢失或损坏
+	Codec       string `gorm:"size:16" json:"codec,omitempty"`                      // mp3 / flac / aac / alac / vorbis / opus / pcm
+	Bitrate     int    `json:"bitrate,omitempty"`                                   // 平均码率（kbps）
+	SampleRate  int    `json:"sample_rate,omitempty"`                               // 采样率（Hz）
+	Channels    int    `json:"channels,omitempty"`
+	BitDepth    int    `json:"bit_depth,omitempty"`                               // 无损格式的位深
+	OwnerID     *uint  `gorm:"index" json:"owner_id,omitempty"`                   // 上传者，命令行导入的曲目没有所有者
+	Visibility  string `gorm:"size:16;not null;default:shared" json:"visibility"` // shared / private，私有曲目只有所有者和管理员可见
+
+	Credits []TrackArtist `gorm:"foreignKey:MusicID" json:"credits,omitempty"`
+}
+
+// 曲目可见范围
+const (
+	VisibilityShared  = "shared"
+	VisibilityPrivate = "private"
+)
+
+// StorageKey 音频在存储后端中的对象 key；按哈希存储之前入库的曲目以 ID 为 key
+func (m *MusicInfo) StorageKey() string {
+	if m.ObjectKey != "" {
+		return m.ObjectKey
+	}
+	return strconv.Itoa(int(m.ID))
 }
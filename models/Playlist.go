@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Playlist 用户歌单；所有者和协作者都可以编辑，每次修改内容 Revision 加一，
+// 客户端提交修改时带上读取到的 Revision，不一致说明期间已被他人修改
+type Playlist struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OwnerID     uint      `gorm:"index;not null" json:"owner_id"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	Description string    `gorm:"size:1000" json:"description"`
+	Revision    int       `gorm:"not null;default:1" json:"revision"`
+	ShareToken  *string   `gorm:"size:32;uniqueIndex" json:"-"` // 公开分享链接的令牌，为空表示未分享
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PlaylistTrack 歌单中的一项，同一曲目可以出现多次，按 Position 排序
+type PlaylistTrack struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	PlaylistID uint       `gorm:"index;not null" json:"-"`
+	MusicID    uint       `gorm:"index;not null" json:"music_id"`
+	Position   int        `gorm:"not null" json:"position"`
+	AddedBy    uint       `json:"added_by"`
+	AddedAt    time.Time  `json:"added_at"`
+	Track      *MusicInfo `gorm:"-" json:"track"` // 调用方看不到的曲目（他人的私有曲目）为空
+}
+
+// PlaylistCollaborator 可以编辑歌单的其他用户
+type PlaylistCollaborator struct {
+	PlaylistID uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID     uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time
+}
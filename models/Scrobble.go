@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// 支持的 scrobble 服务
+const (
+	ScrobbleListenBrainz = "listenbrainz"
+	ScrobbleLastFM       = "lastfm"
+)
+
+// ScrobbleAccount 用户关联的 scrobble 服务账号，每种服务一个
+type ScrobbleAccount struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_scrobble_accounts_user_service" json:"-"`
+	Service   string    `gorm:"size:16;not null;uniqueIndex:idx_scrobble_accounts_user_service" json:"service"`
+	Token     string    `gorm:"size:255;not null" json:"-"` // ListenBrainz 用户令牌或 Last.fm 会话密钥
+	Username  string    `gorm:"size:255" json:"username"`   // 远端服务上的用户名
+	Enabled   bool      `gorm:"not null;default:true" json:"enabled"`
+	LastError string    `gorm:"size:500" json:"last_error,omitempty"` // 令牌失效等原因停用时的错误信息
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ScrobbleJob 待提交的一次收听，保存提交时需要的曲目信息，曲目被修改或删除也不影响提交。
+// DueAt 之前用户开始播放别的曲目时视为跳过，记录被取消；提交失败时推迟 DueAt 重试
+type ScrobbleJob struct {
+	ID          uint      `gorm:"primaryKey"`
+	AccountID   uint      `gorm:"index;not null"`
+	PlayEventID uint      `gorm:"index"`
+	Artist      string    `gorm:"size:255;not null"`
+	Track       string    `gorm:"size:255;not null"`
+	Album       string    `gorm:"size:255"`
+	DurationMs  int64     `gorm:"not null;default:0"`
+	ListenedAt  time.Time `gorm:"not null"` // 开始播放的时间
+	DueAt       time.Time `gorm:"index;not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	LastError   string    `gorm:"size:500"`
+	CreatedAt   time.Time
+}
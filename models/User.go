@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 接口权限范围，admin 包含全部权限
+const (
+	ScopeListen = "listen" // 搜索、浏览、播放
+	ScopeUpload = "upload" // 上传曲目
+	ScopeAdmin  = "admin"  // 修改、删除曲目
+)
+
+// AllScopes 全部权限范围，按从低到高排列
+var AllScopes = []string{ScopeListen, ScopeUpload, ScopeAdmin}
+
+// Scopes 逗号分隔的权限范围
+type Scopes string
+
+// List 拆分为权限列表
+func (s Scopes) List() []string {
+	var list []string
+	for _, v := range strings.Split(string(s), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// Has 是否包含 scope，admin 包含全部权限
+func (s Scopes) Has(scope string) bool {
+	for _, v := range s.List() {
+		if v == scope || v == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户角色，决定用户拥有的权限范围
+const (
+	UserRoleAdmin    = "admin"    // 全部权限，可以看到所有私有曲目
+	UserRoleUploader = "uploader" // 收听和上传，上传的曲目归自己所有
+	UserRoleListener = "listener" // 只能收听
+)
+
+// UserRoles 全部角色，按权限从高到低排列
+var UserRoles = []string{UserRoleAdmin, UserRoleUploader, UserRoleListener}
+
+// RoleScopes 角色拥有的权限范围，未知角色没有任何权限
+func RoleScopes(role string) Scopes {
+	switch role {
+	case UserRoleAdmin:
+		return Scopes(strings.Join(AllScopes, ","))
+	case UserRoleUploader:
+		return ScopeListen + "," + ScopeUpload
+	case UserRoleListener:
+		return ScopeListen
+	}
+	return ""
+}
+
+// User 登录用户，密码以 bcrypt 哈希保存
+type User struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Username     string `gorm:"size:64;not null;uniqueIndex" json:"username"`
+	PasswordHash string `gorm:"size:255;not null" json:"-"`
+	// SubsonicPassword Subsonic 客户端使用的独立密码，由服务器生成；token 认证需要 md5(密码 + salt)，只能保存明文
+	SubsonicPassword string    `gorm:"size:64" json:"-"`
+	Role             string    `gorm:"size:16;not null;default:listener" json:"role"`
+	Disabled         bool      `gorm:"not null;default:false" json:"disabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Scopes 用户角色对应的权限范围
+func (u *User) Scopes() Scopes {
+	return RoleScopes(u.Role)
+}
+
+// APIKey 长期有效的接口密钥，供只能在查询参数里带凭据的插件（如 MusicFree）使用；
+// 只保存密钥的 SHA-256，明文在创建时返回一次
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:64" json:"name"`
+	Prefix     string     `gorm:"size:16" json:"prefix"` // 明文前几位，便于辨认
+	KeyHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     Scopes     `gorm:"size:255" json:"scopes"` // 不超过所属用户的权限
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken 已签发的刷新令牌，ID 即令牌中的 jti；刷新时轮换，旧令牌作废
+type RefreshToken struct {
+	ID        string    `gorm:"primaryKey;size:32"`
+	UserID    uint      `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
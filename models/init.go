@@ -3,22 +3,44 @@ package models
 import (
 	"Music/config"
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 var DB *gorm.DB
 
 func Init() {
-	var DBNAME = config.Config.Database.Name
-	var USER = config.Config.Database.User
-	var PASSWORD = config.Config.Database.Password
-	dsn := USER + ":" + PASSWORD + "@tcp(127.0.0.1:3306)/" + DBNAME + "?charset=utf8mb4&parseTime=True&loc=Local"
-	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	cfg := config.Config.Database
+	dialector, err := openDialector(cfg)
 	if err != nil {
-		fmt.Println("Gorm init error: " + err.Error())
+		log.Fatal("数据库配置错误: ", err)
+	}
+	// SQL 日志写到标准错误，命令行工具的标准输出只用于输出报告；查无记录属于正常情况，不打印
+	DB, err = gorm.Open(dialector, &gorm.Config{
+		Logger: logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		}),
+	})
+	if err != nil {
+		log.Fatal("Gorm init error: ", err)
+	}
+	if cfg.Driver == "sqlite" && isMemoryDSN(cfg.Path) {
+		// 内存数据库每个连接都是独立的库，只能使用一个连接
+		sqlDB, err := DB.DB()
+		if err != nil {
+			log.Fatal("Gorm init error: ", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
 	}
 	// Create DB
 	//err = DB.Exec("CREATE DATABASE IF NOT EXISTS " + DBNAME + " CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci").Error
@@ -26,9 +48,50 @@ func Init() {
 	//	panic("failed to create database")
 	//}
 	//fmt.Println("Database created or already exists")
-	// Table auto migrate
-	err = DB.AutoMigrate(MusicInfo{})
-	if err != nil {
-		log.Fatal("迁移失败: ", err)
+	// 表结构由 migrations 包维护，见 go run ./cmd migrate
+}
+
+// openDialector 按 database.driver 选择驱动，默认 MySQL
+func openDialector(cfg config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case "", "mysql":
+		host := cfg.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		port := cfg.Port
+		if port == 0 {
+			port = 3306
+		}
+		params := cfg.Params
+		if params == "" {
+			params = "charset=utf8mb4&parseTime=True&loc=Local"
+		}
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s", cfg.User, cfg.Password, host, port, cfg.Name, params)
+		return mysql.Open(dsn), nil
+	case "sqlite":
+		path := cfg.Path
+		if path == "" {
+			path = "data/music.db"
+		}
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		// 内存数据库同样检查外键，测试才能发现生产环境会拒绝的写入
+		if isMemoryDSN(path) {
+			return sqlite.Open(path + sep + "_pragma=foreign_keys(1)"), nil
+		}
+		if err := os.MkdirAll(filepath.Dir(strings.TrimPrefix(path, "file:")), 0755); err != nil {
+			return nil, err
+		}
+		// 导入时有并发写入，等待锁而不是直接报 database is locked
+		return sqlite.Open(path + sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"), nil
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动 %q，可选 mysql / sqlite", cfg.Driver)
 	}
 }
+
+func isMemoryDSN(path string) bool {
+	return path == ":memory:" || strings.HasPrefix(path, "file::memory:")
+}
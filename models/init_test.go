@@ -0,0 +1,33 @@
+package models
+
+import (
+	"Music/config"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteEnforcesForeignKeys(t *testing.T) {
+	oldCfg := config.Config.Database
+	t.Cleanup(func() { config.Config.Database = oldCfg })
+
+	for _, path := range []string{":memory:", "file::memory:?cache=shared", filepath.Join(t.TempDir(), "music.db")} {
+		config.Config.Database = config.DatabaseConfig{Driver: "sqlite", Path: path}
+		Init()
+		var enabled int
+		if err := DB.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil || enabled != 1 {
+			t.Errorf("%s: foreign_keys = %d, %v", path, enabled, err)
+		}
+		if err := DB.Exec("CREATE TABLE parents (id INTEGER PRIMARY KEY)").Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := DB.Exec("CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parents(id))").Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := DB.Exec("INSERT INTO children (parent_id) VALUES (1)").Error; err == nil {
+			t.Errorf("%s: 违反外键的写入应失败", path)
+		}
+		if db, err := DB.DB(); err == nil {
+			db.Close()
+		}
+	}
+}
@@ -23,3 +23,44 @@ func ExtractLastNumber(rawurl string) (int, error) {
 	}
 	return num, nil
 }
+
+// 多位艺人之间的分隔符；不按 & 和逗号拆分，避免拆开 "Simon & Garfunkel" 这类组合名
+var artistSeparators = []string{"/", "、", ";", "；", "|"}
+
+// 合作艺人标记，标记之后的艺人视为 featuring
+var featuringMarkers = []string{" feat. ", " feat ", " ft. ", " ft ", " featuring ", " Feat. ", " Ft. ", " FEAT. "}
+
+// SplitArtists 把 "周杰伦/费玉清" 或 "A feat. B" 形式的艺人字符串拆为主艺人与合作艺人
+func SplitArtists(s string) (main []string, featuring []string) {
+	s = strings.TrimSpace(s)
+	for _, marker := range featuringMarkers {
+		if i := strings.Index(s, marker); i >= 0 {
+			featuring = splitNames(s[i+len(marker):])
+			s = s[:i]
+			break
+		}
+	}
+	return splitNames(s), featuring
+}
+
+func splitNames(s string) []string {
+	parts := []string{s}
+	for _, sep := range artistSeparators {
+		var next []string
+		for _, p := range parts {
+			next = append(next, strings.Split(p, sep)...)
+		}
+		parts = next
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[strings.ToLower(p)] {
+			continue
+		}
+		seen[strings.ToLower(p)] = true
+		names = append(names, p)
+	}
+	return names
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"Music/models"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type UserRepository struct {
+	tx *gorm.DB
+}
+
+func (r *UserRepository) WithTx(tx *gorm.DB) *UserRepository {
+	return &UserRepository{tx: tx}
+}
+
+func (r *UserRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+func (r *UserRepository) Create(user *models.User) error {
+	return r.db().Create(user).Error
+}
+
+func (r *UserRepository) GetByID(id uint) (*models.User, error) {
+	var user models.User
+	err := r.db().First(&user, id).Error
+	return &user, err
+}
+
+// GetByUsername 按用户名查找（不区分大小写），未找到时返回 gorm.ErrRecordNotFound
+func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+	var user models.User
+	err := r.db().Where("LOWER(username) = ?", strings.ToLower(strings.TrimSpace(username))).First(&user).Error
+	return &user, err
+}
+
+func (r *UserRepository) List() ([]models.User, error) {
+	var users []models.User
+	err := r.db().Order("id").Find(&users).Error
+	return users, err
+}
+
+// UpdateFields 只写入 user 中 fields 列出的字段（结构体字段名），零值也会写入
+func (r *UserRepository) UpdateFields(user *models.User, fields ...string) error {
+	return r.db().Model(user).Select(fields).Updates(user).Error
+}
+
+type APIKeyRepository struct {
+	tx *gorm.DB
+}
+
+func (r *APIKeyRepository) WithTx(tx *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{tx: tx}
+}
+
+func (r *APIKeyRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+func (r *APIKeyRepository) Create(key *models.APIKey) error {
+	return r.db().Create(key).Error
+}
+
+// GetByHash 按密钥哈希查找，未找到时返回 gorm.ErrRecordNotFound
+func (r *APIKeyRepository) GetByHash(hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db().Where("key_hash = ?", hash).First(&key).Error
+	return &key, err
+}
+
+func (r *APIKeyRepository) ListByUser(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db().Where("user_id = ?", userID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// Delete 删除用户的密钥，密钥不存在或不属于该用户时返回 gorm.ErrRecordNotFound
+func (r *APIKeyRepository) Delete(userID, id uint) error {
+	result := r.db().Where("user_id = ?", userID).Delete(&models.APIKey{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// Touch 记录最近使用时间
+func (r *APIKeyRepository) Touch(id uint, at time.Time) error {
+	return r.db().Model(&models.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
+
+type RefreshTokenRepository struct {
+	tx *gorm.DB
+}
+
+func (r *RefreshTokenRepository) WithTx(tx *gorm.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{tx: tx}
+}
+
+func (r *RefreshTokenRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+func (r *RefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.db().Create(token).Error
+}
+
+func (r *RefreshTokenRepository) GetByID(id string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db().Where("id = ?", id).First(&token).Error
+	return &token, err
+}
+
+// Revoke 作废未作废的令牌，返回是否由本次调用作废（并发刷新时只有一个请求成功）
+func (r *RefreshTokenRepository) Revoke(id string, at time.Time) (bool, error) {
+	result := r.db().Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeByUser 作废用户全部未作废的令牌
+func (r *RefreshTokenRepository) RevokeByUser(userID uint, at time.Time) error {
+	return r.db().Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", at).Error
+}
+
+// DeleteExpired 删除过期的令牌
+func (r *RefreshTokenRepository) DeleteExpired(before time.Time) error {
+	return r.db().Where("expires_at < ?", before).Delete(&models.RefreshToken{}).Error
+}
@@ -0,0 +1,271 @@
+package repositories
+
+import (
+	"Music/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type ArtistRepository struct {
+	tx     *gorm.DB
+	viewer *Viewer
+}
+
+func (r *ArtistRepository) WithTx(tx *gorm.DB) *ArtistRepository {
+	return &ArtistRepository{tx: tx, viewer: r.viewer}
+}
+
+// ForViewer 返回只读取 v 可见艺人的仓库，作用于 GetByID 和 List
+func (r *ArtistRepository) ForViewer(v Viewer) *ArtistRepository {
+	return &ArtistRepository{tx: r.tx, viewer: &v}
+}
+
+func (r *ArtistRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+// FindByName 按主名称或别名查找艺人（不区分大小写），未找到时返回 gorm.ErrRecordNotFound
+func (r *ArtistRepository) FindByName(name string) (*models.Artist, error) {
+	var artist models.Artist
+	err := r.db().
+		Joins("JOIN artist_aliases ON artist_aliases.artist_id = artists.id").
+		Where("LOWER(artist_aliases.name) = ?", strings.ToLower(strings.TrimSpace(name))).
+		First(&artist).Error
+	return &artist, err
+}
+
+// Create 创建艺人并把主名称登记为别名
+func (r *ArtistRepository) Create(artist *models.Artist) error {
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(artist).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ArtistAlias{ArtistID: artist.ID, Name: artist.Name}).Error
+	})
+}
+
+func (r *ArtistRepository) GetByID(id uint) (*models.Artist, error) {
+	var artist models.Artist
+	err := r.viewer.visibleArtists(r.db(), r.db()).First(&artist, id).Error
+	return &artist, err
+}
+
+// List 按名称排序分页列出艺人
+func (r *ArtistRepository) List(offset, limit int) ([]models.Artist, int64, error) {
+	var artists []models.Artist
+	var total int64
+	if err := r.viewer.visibleArtists(r.db(), r.db().Model(&models.Artist{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := r.viewer.visibleArtists(r.db(), r.db()).Order("sort_name, name").Offset(offset).Limit(limit).Find(&artists).Error
+	return artists, total, err
+}
+
+// FindByIDs 按 ID 批量读取艺人，不存在的 ID 被忽略
+func (r *ArtistRepository) FindByIDs(ids []uint) ([]models.Artist, error) {
+	var artists []models.Artist
+	if len(ids) == 0 {
+		return artists, nil
+	}
+	err := r.db().Where("id IN ?", ids).Find(&artists).Error
+	return artists, err
+}
+
+// Search 按名称或别名模糊搜索可见的艺人，按名称排序分页；keyword 为空时列出全部艺人
+func (r *ArtistRepository) Search(keyword string, offset, limit int) ([]models.Artist, error) {
+	var artists []models.Artist
+	byAlias := r.db().Model(&models.ArtistAlias{}).Select("artist_id").
+		Where("LOWER(name) LIKE ?", "%"+strings.ToLower(keyword)+"%")
+	err := r.viewer.visibleArtists(r.db(), r.db()).Where("artists.id IN (?)", byAlias).
+		Order("sort_name, name").Offset(offset).Limit(limit).Find(&artists).Error
+	return artists, err
+}
+
+func (r *ArtistRepository) Aliases(artistID uint) ([]string, error) {
+	var names []string
+	err := r.db().Model(&models.ArtistAlias{}).Where("artist_id = ?", artistID).Order("id").Pluck("name", &names).Error
+	return names, err
+}
+
+func (r *ArtistRepository) AddAlias(artistID uint, name string) error {
+	return r.db().Create(&models.ArtistAlias{ArtistID: artistID, Name: strings.TrimSpace(name)}).Error
+}
+
+// Merge 把 from 的别名、专辑和曲目署名全部转移到 into，然后删除 from
+func (r *ArtistRepository) Merge(into, from uint) error {
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ArtistAlias{}).Where("artist_id = ?", from).Update("artist_id", into).Error; err != nil {
+			return err
+		}
+		// 已经同时署名两位艺人的曲目，删除重复的关联
+		// （先取出 ID，MySQL 不允许 DELETE 的子查询引用同一张表）
+		var dup []uint
+		if err := tx.Model(&models.TrackArtist{}).Where("artist_id = ?", into).Pluck("music_id", &dup).Error; err != nil {
+			return err
+		}
+		if len(dup) > 0 {
+			if err := tx.Where("artist_id = ? AND music_id IN ?", from, dup).Delete(&models.TrackArtist{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.TrackArtist{}).Where("artist_id = ?", from).Update("artist_id", into).Error; err != nil {
+			return err
+		}
+		// 同名专辑合并到 into 已有的专辑
+		var albums []models.Album
+		if err := tx.Where("artist_id = ?", from).Find(&albums).Error; err != nil {
+			return err
+		}
+		for _, a := range albums {
+			var existing models.Album
+			err := tx.Where("artist_id = ? AND LOWER(title) = ?", into, strings.ToLower(a.Title)).First(&existing).Error
+			switch {
+			case err == nil:
+				if err := tx.Model(&models.MusicInfo{}).Where("album_id = ?", a.ID).Update("album_id", existing.ID).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&models.Album{}, a.ID).Error; err != nil {
+					return err
+				}
+			case err == gorm.ErrRecordNotFound:
+				if err := tx.Model(&models.Album{}).Where("id = ?", a.ID).Update("artist_id", into).Error; err != nil {
+					return err
+				}
+			default:
+				return err
+			}
+		}
+		return tx.Delete(&models.Artist{}, from).Error
+	})
+}
+
+type AlbumRepository struct {
+	tx     *gorm.DB
+	viewer *Viewer
+}
+
+func (r *AlbumRepository) WithTx(tx *gorm.DB) *AlbumRepository {
+	return &AlbumRepository{tx: tx, viewer: r.viewer}
+}
+
+// ForViewer 返回只读取 v 可见专辑的仓库，作用于 GetByID、List 和 ListByArtist
+func (r *AlbumRepository) ForViewer(v Viewer) *AlbumRepository {
+	return &AlbumRepository{tx: r.tx, viewer: &v}
+}
+
+func (r *AlbumRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+// Find 按标题（不区分大小写）和专辑艺人查找专辑
+func (r *AlbumRepository) Find(title string, artistID uint) (*models.Album, error) {
+	var album models.Album
+	err := r.db().Where("LOWER(title) = ? AND artist_id = ?", strings.ToLower(strings.TrimSpace(title)), artistID).
+		First(&album).Error
+	return &album, err
+}
+
+func (r *AlbumRepository) Create(album *models.Album) error {
+	return r.db().Create(album).Error
+}
+
+func (r *AlbumRepository) GetByID(id uint) (*models.Album, error) {
+	var album models.Album
+	err := r.viewer.visibleAlbums(r.db(), r.db()).First(&album, id).Error
+	return &album, err
+}
+
+func (r *AlbumRepository) Update(id uint, updates map[string]interface{}) error {
+	return r.db().Model(&models.Album{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *AlbumRepository) Delete(id uint) error {
+	return r.db().Delete(&models.Album{}, id).Error
+}
+
+// CountByCover 使用同一封面的专辑数
+func (r *AlbumRepository) CountByCover(cover string) (int64, error) {
+	var count int64
+	err := r.db().Model(&models.Album{}).Where("cover = ?", cover).Count(&count).Error
+	return count, err
+}
+
+// List 按标题排序分页列出专辑
+func (r *AlbumRepository) List(offset, limit int) ([]models.Album, int64, error) {
+	var albums []models.Album
+	var total int64
+	if err := r.viewer.visibleAlbums(r.db(), r.db().Model(&models.Album{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := r.viewer.visibleAlbums(r.db(), r.db()).Order("title").Offset(offset).Limit(limit).Find(&albums).Error
+	return albums, total, err
+}
+
+// Covers 所有专辑引用的封面
+func (r *AlbumRepository) Covers() ([]string, error) {
+	var covers []string
+	err := r.db().Model(&models.Album{}).Where("cover <> ''").Distinct().Pluck("cover", &covers).Error
+	return covers, err
+}
+
+// Search 按标题模糊搜索可见的专辑，按标题排序分页；keyword 为空时列出全部专辑
+func (r *AlbumRepository) Search(keyword string, offset, limit int) ([]models.Album, error) {
+	var albums []models.Album
+	err := r.viewer.visibleAlbums(r.db(), r.db()).Where("LOWER(title) LIKE ?", "%"+strings.ToLower(keyword)+"%").
+		Order("title").Offset(offset).Limit(limit).Find(&albums).Error
+	return albums, err
+}
+
+// CountByArtists 各艺人作为专辑艺人的可见专辑数
+func (r *AlbumRepository) CountByArtists(artistIDs []uint) (map[uint]int64, error) {
+	counts := map[uint]int64{}
+	if len(artistIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		ArtistID uint
+		Count    int64
+	}
+	err := r.viewer.visibleAlbums(r.db(), r.db().Model(&models.Album{})).Select("artist_id, COUNT(*) AS count").
+		Where("artist_id IN ?", artistIDs).Group("artist_id").Scan(&rows).Error
+	for _, row := range rows {
+		counts[row.ArtistID] = row.Count
+	}
+	return counts, err
+}
+
+// ListByArtist 专辑艺人为 artistID 的专辑，按年份排序
+func (r *AlbumRepository) ListByArtist(artistID uint) ([]models.Album, error) {
+	var albums []models.Album
+	err := r.viewer.visibleAlbums(r.db(), r.db()).Where("artist_id = ?", artistID).Order("year, title").Find(&albums).Error
+	return albums, err
+}
+
+// visibleAlbums 限定为 v 可见的专辑，即至少有一首 v 可见的曲目；q 需以 albums 为主表
+func (v *Viewer) visibleAlbums(db, q *gorm.DB) *gorm.DB {
+	if v == nil || v.All {
+		return q
+	}
+	return q.Where("albums.id IN (?)", v.visibleAlbumIDs(db))
+}
+
+func (v *Viewer) visibleAlbumIDs(db *gorm.DB) *gorm.DB {
+	return v.visibleTracks(db.Model(&models.MusicInfo{})).Select("album_id").Where("album_id IS NOT NULL")
+}
+
+// visibleArtists 限定为 v 可见的艺人，即署名于 v 可见的曲目，或是 v 可见专辑的专辑艺人；q 需以 artists 为主表
+func (v *Viewer) visibleArtists(db, q *gorm.DB) *gorm.DB {
+	if v == nil || v.All {
+		return q
+	}
+	tracks := v.visibleTracks(db.Model(&models.MusicInfo{})).Select("id")
+	credited := db.Model(&models.TrackArtist{}).Select("artist_id").Where("music_id IN (?)", tracks)
+	albumArtists := db.Model(&models.Album{}).Select("artist_id").Where("id IN (?)", v.visibleAlbumIDs(db))
+	return q.Where("(artists.id IN (?) OR artists.id IN (?))", credited, albumArtists)
+}
@@ -0,0 +1,202 @@
+package repositories
+
+import (
+	"Music/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// LibraryRepository 用户的收藏、评分和播放记录
+type LibraryRepository struct {
+	tx     *gorm.DB
+	viewer *Viewer
+}
+
+func (r *LibraryRepository) WithTx(tx *gorm.DB) *LibraryRepository {
+	return &LibraryRepository{tx: tx, viewer: r.viewer}
+}
+
+// ForViewer 返回列表查询只包含 v 可见曲目的仓库
+func (r *LibraryRepository) ForViewer(v Viewer) *LibraryRepository {
+	return &LibraryRepository{tx: r.tx, viewer: &v}
+}
+
+func (r *LibraryRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+// joinTracks 关联 music_infos 并排除不可见的曲目，table 为主表名
+func (r *LibraryRepository) joinTracks(q *gorm.DB, table string) *gorm.DB {
+	q = q.Joins("JOIN music_infos ON music_infos.id = " + table + ".music_id")
+	return r.viewer.visibleTracks(q)
+}
+
+// AddFavorite 收藏曲目，已收藏时不做修改
+func (r *LibraryRepository) AddFavorite(userID, musicID uint) error {
+	return r.db().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.Favorite{UserID: userID, MusicID: musicID}).Error
+}
+
+func (r *LibraryRepository) RemoveFavorite(userID, musicID uint) error {
+	return r.db().Where("user_id = ? AND music_id = ?", userID, musicID).Delete(&models.Favorite{}).Error
+}
+
+// Favorites 用户收藏的曲目，最近收藏的在前
+func (r *LibraryRepository) Favorites(userID uint, offset, limit int) ([]models.Favorite, int64, error) {
+	var favorites []models.Favorite
+	var total int64
+	q := func() *gorm.DB {
+		return r.joinTracks(r.db().Model(&models.Favorite{}), "favorites").Where("favorites.user_id = ?", userID)
+	}
+	if err := q().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q().Select("favorites.*").Order("favorites.created_at DESC, favorites.music_id DESC").
+		Offset(offset).Limit(limit).Find(&favorites).Error
+	return favorites, total, err
+}
+
+// SetRating 设置评分，已有评分时覆盖
+func (r *LibraryRepository) SetRating(userID, musicID uint, stars int) error {
+	return r.db().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "music_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"stars", "updated_at"}),
+	}).Create(&models.Rating{UserID: userID, MusicID: musicID, Stars: stars}).Error
+}
+
+func (r *LibraryRepository) RemoveRating(userID, musicID uint) error {
+	return r.db().Where("user_id = ? AND music_id = ?", userID, musicID).Delete(&models.Rating{}).Error
+}
+
+// Feedback 用户对一组曲目的收藏时间和评分，未收藏的曲目不在 liked 中
+func (r *LibraryRepository) Feedback(userID uint, musicIDs []uint) (map[uint]time.Time, map[uint]int, error) {
+	liked, ratings := map[uint]time.Time{}, map[uint]int{}
+	if len(musicIDs) == 0 {
+		return liked, ratings, nil
+	}
+	var favorites []models.Favorite
+	err := r.db().Where("user_id = ? AND music_id IN ?", userID, musicIDs).Find(&favorites).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range favorites {
+		liked[f.MusicID] = f.CreatedAt
+	}
+	var rated []models.Rating
+	err = r.db().Where("user_id = ? AND music_id IN ?", userID, musicIDs).Find(&rated).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rt := range rated {
+		ratings[rt.MusicID] = rt.Stars
+	}
+	return liked, ratings, nil
+}
+
+// RecordPlay 写入播放记录；时间统一按 UTC 保存，SQLite 按字符串比较时间，时区不一致会比较出错
+func (r *LibraryRepository) RecordPlay(e *models.PlayEvent) error {
+	e.PlayedAt = e.PlayedAt.UTC()
+	return r.db().Create(e).Error
+}
+
+// RecentPlays 用户最近的播放记录，includePartial 为 false 时只包含从头开始的播放
+func (r *LibraryRepository) RecentPlays(userID uint, includePartial bool, offset, limit int) ([]models.PlayEvent, int64, error) {
+	var plays []models.PlayEvent
+	var total int64
+	q := func() *gorm.DB {
+		q := r.joinTracks(r.db().Model(&models.PlayEvent{}), "play_events").Where("play_events.user_id = ?", userID)
+		if !includePartial {
+			q = q.Where("play_events.partial = ?", false)
+		}
+		return q
+	}
+	if err := q().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q().Select("play_events.*").Order("play_events.played_at DESC, play_events.id DESC").
+		Offset(offset).Limit(limit).Find(&plays).Error
+	return plays, total, err
+}
+
+// TrackPlays 一首曲目的播放次数，LastPlayID 为最近一次播放记录的 ID
+type TrackPlays struct {
+	MusicID    uint
+	Plays      int64
+	LastPlayID uint
+}
+
+// MostPlayed 用户播放次数最多的曲目，只统计 since 之后从头开始的播放；since 为零值时不限时间
+func (r *LibraryRepository) MostPlayed(userID uint, since time.Time, offset, limit int) ([]TrackPlays, int64, error) {
+	var results []TrackPlays
+	var total int64
+	q := func() *gorm.DB {
+		q := r.joinTracks(r.db().Model(&models.PlayEvent{}), "play_events").
+			Where("play_events.user_id = ? AND play_events.partial = ?", userID, false)
+		if !since.IsZero() {
+			q = q.Where("play_events.played_at >= ?", since.UTC())
+		}
+		return q
+	}
+	if err := q().Distinct("play_events.music_id").Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q().Select("play_events.music_id, COUNT(*) AS plays, MAX(play_events.id) AS last_play_id").
+		Group("play_events.music_id").Order("plays DESC, last_play_id DESC").
+		Offset(offset).Limit(limit).Scan(&results).Error
+	return results, total, err
+}
+
+// PlaysBetween [from, to) 之间从头开始的播放，按时间排序；from 为零值时不限开始时间
+func (r *LibraryRepository) PlaysBetween(userID uint, from, to time.Time) ([]models.PlayEvent, error) {
+	var plays []models.PlayEvent
+	q := r.joinTracks(r.db().Model(&models.PlayEvent{}), "play_events").
+		Where("play_events.user_id = ? AND play_events.partial = ? AND play_events.played_at < ?", userID, false, to.UTC())
+	if !from.IsZero() {
+		q = q.Where("play_events.played_at >= ?", from.UTC())
+	}
+	err := q.Select("play_events.*").Order("play_events.played_at, play_events.id").Find(&plays).Error
+	return plays, err
+}
+
+// FirstPlays 用户每首曲目第一次从头播放的记录，键为曲目 ID；按播放时间判断，时间相同时取 ID 较小的。
+// 不能按 ID 判断：客户端补报的 scrobble 会在之后写入更早的播放
+func (r *LibraryRepository) FirstPlays(userID uint) (map[uint]models.PlayEvent, error) {
+	mine := func() *gorm.DB {
+		return r.db().Model(&models.PlayEvent{}).Where("play_events.user_id = ? AND play_events.partial = ?", userID, false)
+	}
+	firstAt := mine().Select("play_events.music_id, MIN(play_events.played_at) AS first_at").Group("play_events.music_id")
+	ids := mine().Select("MIN(play_events.id)").
+		Joins("JOIN (?) AS f ON f.music_id = play_events.music_id AND f.first_at = play_events.played_at", firstAt).
+		Group("play_events.music_id")
+	var plays []models.PlayEvent
+	if err := r.db().Where("id IN (?)", ids).Find(&plays).Error; err != nil {
+		return nil, err
+	}
+	first := make(map[uint]models.PlayEvent, len(plays))
+	for _, p := range plays {
+		first[p.MusicID] = p
+	}
+	return first, nil
+}
+
+// PlaysByIDs 按 ID 批量读取播放记录
+func (r *LibraryRepository) PlaysByIDs(ids []uint) ([]models.PlayEvent, error) {
+	var plays []models.PlayEvent
+	if len(ids) == 0 {
+		return plays, nil
+	}
+	err := r.db().Where("id IN ?", ids).Find(&plays).Error
+	return plays, err
+}
+
+// RemoveMusic 删除曲目的全部收藏和评分；播放记录保留用于统计
+func (r *LibraryRepository) RemoveMusic(musicID uint) error {
+	if err := r.db().Where("music_id = ?", musicID).Delete(&models.Favorite{}).Error; err != nil {
+		return err
+	}
+	return r.db().Where("music_id = ?", musicID).Delete(&models.Rating{}).Error
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"Music/config"
+	"Music/migrations"
+	"Music/models"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func useTestDB(t *testing.T) {
+	t.Helper()
+	oldCfg := config.Config
+	t.Cleanup(func() { config.Config = oldCfg })
+	config.Config.Database = config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "music.db")}
+	models.Init()
+	if _, err := migrations.Up(models.DB, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if db, err := models.DB.DB(); err == nil {
+			db.Close()
+		}
+	})
+}
+
+func TestFirstPlaysUsesPlayedAt(t *testing.T) {
+	useTestDB(t)
+	r := &LibraryRepository{}
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	plays := []models.PlayEvent{
+		{UserID: 1, MusicID: 10, PlayedAt: base},
+		// 之后补报的更早播放
+		{UserID: 1, MusicID: 10, PlayedAt: base.Add(-48 * time.Hour)},
+		{UserID: 1, MusicID: 10, PlayedAt: base.Add(-72 * time.Hour), Partial: true},
+		// 同一时间的两条记录取 ID 较小的
+		{UserID: 1, MusicID: 11, PlayedAt: base},
+		{UserID: 1, MusicID: 11, PlayedAt: base},
+		// 其他用户的播放不计入
+		{UserID: 2, MusicID: 10, PlayedAt: base.Add(-96 * time.Hour)},
+	}
+	for i := range plays {
+		if err := r.RecordPlay(&plays[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := r.FirstPlays(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("FirstPlays = %v", first)
+	}
+	if got := first[10]; got.ID != plays[1].ID || !got.PlayedAt.Equal(plays[1].PlayedAt) {
+		t.Errorf("曲目 10 的第一次播放 = %d (%v), want %d", got.ID, got.PlayedAt, plays[1].ID)
+	}
+	if got := first[11]; got.ID != plays[3].ID {
+		t.Errorf("曲目 11 的第一次播放 = %d, want %d", got.ID, plays[3].ID)
+	}
+}
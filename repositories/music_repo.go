@@ -1,40 +1,274 @@
 package repositories
 
-import "Music/models"
+import (
+	"Music/models"
+	"gorm.io/gorm"
+	"strings"
+)
 
-type MusicRepository struct{}
+// Viewer 浏览曲目的调用方，决定能看到哪些私有曲目
+type Viewer struct {
+	UserID uint // 0 表示没有对应的用户，只能看到共享曲目
+	All    bool // 管理员可以看到全部曲目
+}
+
+// visibleTracks 限定为 v 可见的曲目，查询需以 music_infos 为主表；v 为 nil 时不限制（内部调用）
+func (v *Viewer) visibleTracks(q *gorm.DB) *gorm.DB {
+	if v == nil || v.All {
+		return q
+	}
+	return q.Where("(music_infos.visibility = ? OR music_infos.owner_id = ?)", models.VisibilityShared, v.UserID)
+}
+
+type MusicRepository struct {
+	tx     *gorm.DB
+	viewer *Viewer
+}
+
+// WithTx 返回在指定事务中执行的仓库
+func (r *MusicRepository) WithTx(tx *gorm.DB) *MusicRepository {
+	return &MusicRepository{tx: tx, viewer: r.viewer}
+}
+
+// ForViewer 返回只读取 v 可见曲目的仓库，作用于 GetByID、SearchByKeyword 和各列表查询
+func (r *MusicRepository) ForViewer(v Viewer) *MusicRepository {
+	return &MusicRepository{tx: r.tx, viewer: &v}
+}
+
+func (r *MusicRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
 
 func (r *MusicRepository) Create(info *models.MusicInfo) (uint, error) {
-	result := models.DB.Create(info)
+	result := r.db().Create(info)
 	return info.ID, result.Error
 }
 
 func (r *MusicRepository) GetByID(id uint) (*models.MusicInfo, error) {
 	var music models.MusicInfo
-	err := models.DB.First(&music, id).Error
+	err := r.viewer.visibleTracks(r.db()).First(&music, id).Error
 	return &music, err
 }
 func (r *MusicRepository) Update(id uint, updates map[string]interface{}) error {
-	return models.DB.Model(&models.MusicInfo{}).Where("id = ?", id).Updates(updates).Error
+	return r.db().Model(&models.MusicInfo{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// UpdateFields 只写入 info 中 fields 列出的字段（结构体字段名），零值也会写入
+func (r *MusicRepository) UpdateFields(info *models.MusicInfo, fields ...string) error {
+	return r.db().Model(info).Select(fields).Updates(info).Error
 }
 
 func (r *MusicRepository) Delete(id uint) error {
-	return models.DB.Delete(&models.MusicInfo{}, id).Error
+	return r.db().Delete(&models.MusicInfo{}, id).Error
+}
+
+// 列出全部音乐记录
+func (r *MusicRepository) ListAll() ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	err := r.db().Order("id").Find(&results).Error
+	return results, err
+}
+
+// ListMissingAudioInfo 列出缺少编码、大小或哈希的记录（不含 broken 记录）
+func (r *MusicRepository) ListMissingAudioInfo() ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	err := r.db().Where("broken = ?", false).
+		Where("codec IS NULL OR codec = '' OR size IS NULL OR size = 0 OR sha256 IS NULL OR sha256 = ''").
+		Order("id").Find(&results).Error
+	return results, err
 }
 
 // 模糊搜索函数
+// 统一用 LOWER 比较，使 SQLite 与 MySQL（utf8mb4_general_ci）一样不区分大小写
 func (r *MusicRepository) SearchByKeyword(keyword string) ([]models.MusicInfo, error) {
 	var results []models.MusicInfo
-	err := models.DB.Where("name LIKE ? OR singer LIKE ? OR album LIKE ?",
-		"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%").
-		Find(&results).Error
+	err := r.keywordQuery(keyword).Find(&results).Error
+	return results, err
+}
+
+// Search 同 SearchByKeyword，按 ID 排序分页并读取艺人署名；keyword 为空时列出全部曲目
+func (r *MusicRepository) Search(keyword string, offset, limit int) ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	err := r.keywordQuery(keyword).
+		Preload("Credits", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).Preload("Credits.Artist").
+		Order("id").Offset(offset).Limit(limit).Find(&results).Error
+	return results, err
+}
+
+func (r *MusicRepository) keywordQuery(keyword string) *gorm.DB {
+	pattern := "%" + strings.ToLower(keyword) + "%"
+	// 通过艺人别名匹配，搜索 "Jay Chou" 也能找到署名为 "周杰伦" 的曲目
+	byAlias := r.db().Model(&models.TrackArtist{}).Select("track_artists.music_id").
+		Joins("JOIN artist_aliases ON artist_aliases.artist_id = track_artists.artist_id").
+		Where("LOWER(artist_aliases.name) LIKE ?", pattern)
+	return r.viewer.visibleTracks(r.db()).
+		Where("LOWER(name) LIKE ? OR LOWER(singer) LIKE ? OR LOWER(album) LIKE ? OR id IN (?)",
+			pattern, pattern, pattern, byAlias).
+		Where("broken = ?", false)
+}
+
+// FindByHash 查找文件哈希相同，或去掉标签后的音频哈希相同的可见曲目，未找到时返回 gorm.ErrRecordNotFound
+func (r *MusicRepository) FindByHash(sha256, audioHash string) (*models.MusicInfo, error) {
+	var music models.MusicInfo
+	q := r.viewer.visibleTracks(r.db())
+	if audioHash != "" {
+		q = q.Where("sha256 = ? OR audio_hash = ?", sha256, audioHash)
+	} else {
+		q = q.Where("sha256 = ?", sha256)
+	}
+	err := q.Order("id").First(&music).Error
+	return &music, err
+}
+
+// CountByObjectKey 引用同一存储对象的曲目数
+func (r *MusicRepository) CountByObjectKey(key string) (int64, error) {
+	var count int64
+	err := r.db().Model(&models.MusicInfo{}).Where("object_key = ?", key).Count(&count).Error
+	return count, err
+}
+
+// TrackFilter 批量修改时筛选曲目的条件，字符串字段不区分大小写完全匹配，多个条件同时满足
+type TrackFilter struct {
+	IDs         []uint `json:"ids"`
+	AlbumID     uint   `json:"album_id"`
+	Album       string `json:"album"`
+	AlbumArtist string `json:"album_artist"`
+	Singer      string `json:"singer"`
+}
+
+// Empty 没有任何条件
+func (f TrackFilter) Empty() bool {
+	return len(f.IDs) == 0 && f.AlbumID == 0 && f.Album == "" && f.AlbumArtist == "" && f.Singer == ""
+}
+
+// FindByFilter 按条件列出曲目，条件为空时返回空列表
+func (r *MusicRepository) FindByFilter(f TrackFilter) ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	if f.Empty() {
+		return results, nil
+	}
+	q := r.db()
+	if len(f.IDs) > 0 {
+		q = q.Where("id IN ?", f.IDs)
+	}
+	if f.AlbumID != 0 {
+		q = q.Where("album_id = ?", f.AlbumID)
+	}
+	if f.Album != "" {
+		q = q.Where("LOWER(album) = ?", strings.ToLower(f.Album))
+	}
+	if f.AlbumArtist != "" {
+		q = q.Where("LOWER(album_artist) = ?", strings.ToLower(f.AlbumArtist))
+	}
+	if f.Singer != "" {
+		q = q.Where("LOWER(singer) = ?", strings.ToLower(f.Singer))
+	}
+	err := q.Order("id").Find(&results).Error
 	return results, err
 }
 
-func (r *MusicRepository) ExistsByFields(name, album, singer string) (bool, error) {
+// CountByAlbum 专辑内的曲目数
+func (r *MusicRepository) CountByAlbum(albumID uint) (int64, error) {
 	var count int64
-	err := models.DB.Model(&models.MusicInfo{}).
-		Where("name = ? AND album = ? AND singer = ?", name, album, singer).
-		Count(&count).Error
-	return count > 0, err
+	err := r.db().Model(&models.MusicInfo{}).Where("album_id = ?", albumID).Count(&count).Error
+	return count, err
+}
+
+// AlbumStats 专辑内可见曲目的数量和总时长
+type AlbumStats struct {
+	AlbumID  uint
+	Tracks   int64
+	Duration int64 // 毫秒
+}
+
+// AlbumStats 按专辑统计可见且未损坏的曲目
+func (r *MusicRepository) AlbumStats(albumIDs []uint) (map[uint]AlbumStats, error) {
+	stats := map[uint]AlbumStats{}
+	if len(albumIDs) == 0 {
+		return stats, nil
+	}
+	var rows []AlbumStats
+	err := r.viewer.visibleTracks(r.db().Model(&models.MusicInfo{})).
+		Select("album_id, COUNT(*) AS tracks, COALESCE(SUM(duration), 0) AS duration").
+		Where("album_id IN ? AND broken = ?", albumIDs, false).Group("album_id").Scan(&rows).Error
+	for _, row := range rows {
+		stats[row.AlbumID] = row
+	}
+	return stats, err
+}
+
+// CountByCover 使用同一封面的曲目数
+func (r *MusicRepository) CountByCover(cover string) (int64, error) {
+	var count int64
+	err := r.db().Model(&models.MusicInfo{}).Where("cover = ?", cover).Count(&count).Error
+	return count, err
+}
+
+// FindByIDs 按 ID 批量读取曲目，不存在或不可见的 ID 被忽略
+func (r *MusicRepository) FindByIDs(ids []uint) ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	if len(ids) == 0 {
+		return results, nil
+	}
+	err := r.viewer.visibleTracks(r.db()).Where("id IN ?", ids).Find(&results).Error
+	return results, err
+}
+
+// FindByIDsWithCredits 同 FindByIDs，并读取艺人署名
+func (r *MusicRepository) FindByIDsWithCredits(ids []uint) ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	if len(ids) == 0 {
+		return results, nil
+	}
+	err := r.viewer.visibleTracks(r.db()).
+		Preload("Credits", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).Preload("Credits.Artist").
+		Where("id IN ?", ids).Find(&results).Error
+	return results, err
+}
+
+// GetWithCredits 读取曲目及艺人署名
+func (r *MusicRepository) GetWithCredits(id uint) (*models.MusicInfo, error) {
+	var music models.MusicInfo
+	err := r.viewer.visibleTracks(r.db()).
+		Preload("Credits", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).Preload("Credits.Artist").
+		First(&music, id).Error
+	return &music, err
+}
+
+// SetCredits 用 credits 替换曲目的艺人署名
+func (r *MusicRepository) SetCredits(musicID uint, credits []models.TrackArtist) error {
+	if err := r.db().Where("music_id = ?", musicID).Delete(&models.TrackArtist{}).Error; err != nil {
+		return err
+	}
+	if len(credits) == 0 {
+		return nil
+	}
+	for i := range credits {
+		credits[i].MusicID = musicID
+	}
+	return r.db().Omit("Artist").Create(&credits).Error
+}
+
+// ListByAlbum 专辑内的曲目，按碟号、曲目号排序
+func (r *MusicRepository) ListByAlbum(albumID uint) ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	err := r.viewer.visibleTracks(r.db()).
+		Preload("Credits", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).Preload("Credits.Artist").
+		Where("album_id = ? AND broken = ?", albumID, false).
+		Order("disc_number, track_number, id").
+		Find(&results).Error
+	return results, err
+}
+
+// ListByArtist 署名中包含 artistID 的曲目
+func (r *MusicRepository) ListByArtist(artistID uint) ([]models.MusicInfo, error) {
+	var results []models.MusicInfo
+	sub := r.db().Model(&models.TrackArtist{}).Select("music_id").Where("artist_id = ?", artistID)
+	err := r.viewer.visibleTracks(r.db()).Where("id IN (?) AND broken = ?", sub, false).
+		Order("album_id, disc_number, track_number, id").
+		Find(&results).Error
+	return results, err
 }
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"Music/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type PlaylistRepository struct {
+	tx *gorm.DB
+}
+
+func (r *PlaylistRepository) WithTx(tx *gorm.DB) *PlaylistRepository {
+	return &PlaylistRepository{tx: tx}
+}
+
+func (r *PlaylistRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+func (r *PlaylistRepository) Create(p *models.Playlist) error {
+	return r.db().Create(p).Error
+}
+
+func (r *PlaylistRepository) GetByID(id uint) (*models.Playlist, error) {
+	var p models.Playlist
+	err := r.db().First(&p, id).Error
+	return &p, err
+}
+
+// GetByShareToken 按分享令牌查找，未找到时返回 gorm.ErrRecordNotFound
+func (r *PlaylistRepository) GetByShareToken(token string) (*models.Playlist, error) {
+	var p models.Playlist
+	err := r.db().Where("share_token = ?", token).First(&p).Error
+	return &p, err
+}
+
+// ListForUser 用户拥有或参与协作的歌单，按最近修改排序
+func (r *PlaylistRepository) ListForUser(userID uint, offset, limit int) ([]models.Playlist, int64, error) {
+	var playlists []models.Playlist
+	var total int64
+	shared := r.db().Model(&models.PlaylistCollaborator{}).Select("playlist_id").Where("user_id = ?", userID)
+	q := func() *gorm.DB {
+		return r.db().Model(&models.Playlist{}).Where("owner_id = ? OR id IN (?)", userID, shared)
+	}
+	if err := q().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q().Order("updated_at DESC, id DESC").Offset(offset).Limit(limit).Find(&playlists).Error
+	return playlists, total, err
+}
+
+// PlaylistStats 歌单中 v 可见曲目的数量和总时长
+type PlaylistStats struct {
+	PlaylistID uint
+	Tracks     int64
+	Duration   int64 // 毫秒
+}
+
+// Stats 按歌单统计 v 可见的曲目，同一曲目出现多次时重复计算
+func (r *PlaylistRepository) Stats(playlistIDs []uint, v Viewer) (map[uint]PlaylistStats, error) {
+	stats := map[uint]PlaylistStats{}
+	if len(playlistIDs) == 0 {
+		return stats, nil
+	}
+	var rows []PlaylistStats
+	q := r.db().Model(&models.PlaylistTrack{}).
+		Joins("JOIN music_infos ON music_infos.id = playlist_tracks.music_id")
+	err := v.visibleTracks(q).
+		Select("playlist_tracks.playlist_id, COUNT(*) AS tracks, COALESCE(SUM(music_infos.duration), 0) AS duration").
+		Where("playlist_tracks.playlist_id IN ?", playlistIDs).Group("playlist_tracks.playlist_id").Scan(&rows).Error
+	for _, row := range rows {
+		stats[row.PlaylistID] = row
+	}
+	return stats, err
+}
+
+// UpdateFields 只写入 p 中 fields 列出的字段（结构体字段名），零值也会写入
+func (r *PlaylistRepository) UpdateFields(p *models.Playlist, fields ...string) error {
+	return r.db().Model(p).Select(fields).Updates(p).Error
+}
+
+// BumpRevision 当前版本为 expected 时版本号加一，返回是否成功；并发修改时只有一个请求成功
+func (r *PlaylistRepository) BumpRevision(id uint, expected int) (bool, error) {
+	result := r.db().Model(&models.Playlist{}).Where("id = ? AND revision = ?", id, expected).
+		Updates(map[string]interface{}{"revision": gorm.Expr("revision + 1"), "updated_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Delete 删除歌单及其曲目和协作者
+func (r *PlaylistRepository) Delete(id uint) error {
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", id).Delete(&models.PlaylistTrack{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("playlist_id = ?", id).Delete(&models.PlaylistCollaborator{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Playlist{}, id).Error
+	})
+}
+
+// Entries 歌单中的全部曲目，按位置排序
+func (r *PlaylistRepository) Entries(playlistID uint) ([]models.PlaylistTrack, error) {
+	var entries []models.PlaylistTrack
+	err := r.db().Where("playlist_id = ?", playlistID).Order("position, id").Find(&entries).Error
+	return entries, err
+}
+
+func (r *PlaylistRepository) AddEntries(entries []models.PlaylistTrack) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.db().Create(&entries).Error
+}
+
+// DeleteEntries 删除歌单中的指定项，返回删除的数量
+func (r *PlaylistRepository) DeleteEntries(playlistID uint, ids []uint) (int64, error) {
+	result := r.db().Where("playlist_id = ? AND id IN ?", playlistID, ids).Delete(&models.PlaylistTrack{})
+	return result.RowsAffected, result.Error
+}
+
+// SetPosition 修改一项的位置
+func (r *PlaylistRepository) SetPosition(id uint, position int) error {
+	return r.db().Model(&models.PlaylistTrack{}).Where("id = ?", id).UpdateColumn("position", position).Error
+}
+
+// RemoveMusic 从所有歌单中删除曲目，受影响的歌单版本号加一
+func (r *PlaylistRepository) RemoveMusic(musicID uint) error {
+	affected := r.db().Model(&models.PlaylistTrack{}).Select("playlist_id").Where("music_id = ?", musicID)
+	err := r.db().Model(&models.Playlist{}).Where("id IN (?)", affected).
+		Updates(map[string]interface{}{"revision": gorm.Expr("revision + 1"), "updated_at": time.Now()}).Error
+	if err != nil {
+		return err
+	}
+	return r.db().Where("music_id = ?", musicID).Delete(&models.PlaylistTrack{}).Error
+}
+
+// Collaborators 歌单的协作者，按加入顺序排列
+func (r *PlaylistRepository) Collaborators(playlistID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.db().Joins("JOIN playlist_collaborators ON playlist_collaborators.user_id = users.id").
+		Where("playlist_collaborators.playlist_id = ?", playlistID).
+		Order("playlist_collaborators.created_at, users.id").Find(&users).Error
+	return users, err
+}
+
+// IsCollaborator 用户是否为歌单的协作者
+func (r *PlaylistRepository) IsCollaborator(playlistID, userID uint) (bool, error) {
+	var count int64
+	err := r.db().Model(&models.PlaylistCollaborator{}).Where("playlist_id = ? AND user_id = ?", playlistID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *PlaylistRepository) AddCollaborator(playlistID, userID uint) error {
+	return r.db().Create(&models.PlaylistCollaborator{PlaylistID: playlistID, UserID: userID}).Error
+}
+
+// RemoveCollaborator 移除协作者，不是协作者时返回 gorm.ErrRecordNotFound
+func (r *PlaylistRepository) RemoveCollaborator(playlistID, userID uint) error {
+	result := r.db().Where("playlist_id = ? AND user_id = ?", playlistID, userID).Delete(&models.PlaylistCollaborator{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
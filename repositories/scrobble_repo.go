@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"Music/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ScrobbleRepository scrobble 账号和待提交队列；时间统一按 UTC 保存和比较
+type ScrobbleRepository struct {
+	tx *gorm.DB
+}
+
+func (r *ScrobbleRepository) WithTx(tx *gorm.DB) *ScrobbleRepository {
+	return &ScrobbleRepository{tx: tx}
+}
+
+func (r *ScrobbleRepository) db() *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return models.DB
+}
+
+// GetAccount 用户关联的某个服务的账号，未关联时返回 gorm.ErrRecordNotFound
+func (r *ScrobbleRepository) GetAccount(userID uint, service string) (*models.ScrobbleAccount, error) {
+	var a models.ScrobbleAccount
+	err := r.db().Where("user_id = ? AND service = ?", userID, service).First(&a).Error
+	return &a, err
+}
+
+func (r *ScrobbleRepository) GetAccountByID(id uint) (*models.ScrobbleAccount, error) {
+	var a models.ScrobbleAccount
+	err := r.db().First(&a, id).Error
+	return &a, err
+}
+
+func (r *ScrobbleRepository) ListAccounts(userID uint) ([]models.ScrobbleAccount, error) {
+	var accounts []models.ScrobbleAccount
+	err := r.db().Where("user_id = ?", userID).Order("service").Find(&accounts).Error
+	return accounts, err
+}
+
+// EnabledAccounts 用户已启用的账号
+func (r *ScrobbleRepository) EnabledAccounts(userID uint) ([]models.ScrobbleAccount, error) {
+	var accounts []models.ScrobbleAccount
+	err := r.db().Where("user_id = ? AND enabled = ?", userID, true).Order("service").Find(&accounts).Error
+	return accounts, err
+}
+
+// SaveAccount 创建或更新账号
+func (r *ScrobbleRepository) SaveAccount(a *models.ScrobbleAccount) error {
+	return r.db().Save(a).Error
+}
+
+// DisableAccount 停用账号并记录原因，队列中的记录保留到重新关联后提交
+func (r *ScrobbleRepository) DisableAccount(id uint, reason string) error {
+	return r.db().Model(&models.ScrobbleAccount{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"enabled": false, "last_error": reason}).Error
+}
+
+// DeleteAccount 删除账号及其待提交的记录
+func (r *ScrobbleRepository) DeleteAccount(id uint) error {
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", id).Delete(&models.ScrobbleJob{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ScrobbleAccount{}, id).Error
+	})
+}
+
+// PendingCounts 各账号待提交的记录数
+func (r *ScrobbleRepository) PendingCounts(accountIDs []uint) (map[uint]int64, error) {
+	counts := map[uint]int64{}
+	if len(accountIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		AccountID uint
+		Count     int64
+	}
+	err := r.db().Model(&models.ScrobbleJob{}).Select("account_id, COUNT(*) AS count").
+		Where("account_id IN ?", accountIDs).Group("account_id").Scan(&rows).Error
+	for _, row := range rows {
+		counts[row.AccountID] = row.Count
+	}
+	return counts, err
+}
+
+func (r *ScrobbleRepository) AddJobs(jobs []models.ScrobbleJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	for i := range jobs {
+		jobs[i].ListenedAt = jobs[i].ListenedAt.UTC()
+		jobs[i].DueAt = jobs[i].DueAt.UTC()
+	}
+	return r.db().Create(&jobs).Error
+}
+
+// CancelPending 删除这些账号中还没到期、也没尝试提交过的记录（播放被下一首打断）
+func (r *ScrobbleRepository) CancelPending(accountIDs []uint, now time.Time) error {
+	if len(accountIDs) == 0 {
+		return nil
+	}
+	return r.db().Where("account_id IN ? AND attempts = ? AND due_at > ?", accountIDs, 0, now.UTC()).
+		Delete(&models.ScrobbleJob{}).Error
+}
+
+// DueJobs 已到期且账号已启用的记录，按账号和收听时间排序
+func (r *ScrobbleRepository) DueJobs(now time.Time, limit int) ([]models.ScrobbleJob, error) {
+	var jobs []models.ScrobbleJob
+	err := r.db().Joins("JOIN scrobble_accounts ON scrobble_accounts.id = scrobble_jobs.account_id").
+		Where("scrobble_jobs.due_at <= ? AND scrobble_accounts.enabled = ?", now.UTC(), true).
+		Order("scrobble_jobs.account_id, scrobble_jobs.listened_at, scrobble_jobs.id").
+		Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *ScrobbleRepository) DeleteJobs(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db().Where("id IN ?", ids).Delete(&models.ScrobbleJob{}).Error
+}
+
+// RescheduleJob 记录失败次数和原因，推迟到 dueAt 再提交
+func (r *ScrobbleRepository) RescheduleJob(id uint, attempts int, dueAt time.Time, lastError string) error {
+	return r.db().Model(&models.ScrobbleJob{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"attempts": attempts, "due_at": dueAt.UTC(), "last_error": lastError}).Error
+}
@@ -2,16 +2,132 @@ package router
 
 import (
 	"Music/controller"
+	"Music/middleware"
+	"Music/models"
 	"github.com/gin-gonic/gin"
 )
 
 func InitRouter(e *gin.Engine) {
-	musicGroup := e.Group("/music/v1")
+	v1 := e.Group("/music/v1", middleware.Authenticate())
+
+	// 封面按内容寻址，本地对象地址带签名，不需要登录
+	v1.GET("/object/*key", controller.ServeLocalObject)
+	v1.GET("/artwork/:id", controller.GetArtwork)
+
+	authGroup := v1.Group("/auth")
+	{
+		authGroup.POST("/login", controller.Login)
+		authGroup.POST("/refresh", controller.RefreshToken)
+		authGroup.POST("/logout", controller.Logout)
+		authGroup.GET("/me", middleware.RequireAuth(), controller.Me)
+		authGroup.GET("/keys", middleware.RequireAuth(), controller.ListAPIKeys)
+		authGroup.POST("/keys", middleware.RequireAuth(), controller.CreateAPIKey)
+		authGroup.DELETE("/keys/:id", middleware.RequireAuth(), controller.RevokeAPIKey)
+		authGroup.POST("/subsonic", middleware.RequireAuth(), controller.ResetSubsonicPassword)
+		authGroup.DELETE("/subsonic", middleware.RequireAuth(), controller.ClearSubsonicPassword)
+	}
+
+	musicGroup := v1.Group("", middleware.RequireScope(models.ScopeListen))
 	{
 		musicGroup.GET("/search", controller.SearchMusic)
 		musicGroup.GET("/play", controller.PlayMusic)
 		musicGroup.POST("/album", controller.GetAlbumMusics)
 		musicGroup.GET("list", controller.GetAlbumList)
-		//musicGroup.POST("/upload", controller.UploadMusic)
+		musicGroup.GET("/artists", controller.ListArtists)
+		musicGroup.GET("/artists/:id", controller.GetArtist)
+		musicGroup.GET("/albums", controller.ListAlbums)
+		musicGroup.GET("/albums/:id", controller.GetAlbum)
+
+		// 收藏、评分、播放记录、统计和 scrobble 账号
+		musicGroup.GET("/favorites", controller.ListFavorites)
+		musicGroup.GET("/history", controller.ListRecentPlays)
+		musicGroup.GET("/history/top", controller.ListMostPlayed)
+		musicGroup.GET("/tracks/:id/feedback", controller.GetTrackFeedback)
+		musicGroup.PUT("/tracks/:id/favorite", controller.LikeTrack)
+		musicGroup.DELETE("/tracks/:id/favorite", controller.UnlikeTrack)
+		musicGroup.PUT("/tracks/:id/rating", controller.RateTrack)
+		musicGroup.DELETE("/tracks/:id/rating", controller.UnrateTrack)
+		musicGroup.GET("/stats", controller.GetStats)
+		musicGroup.GET("/stats/recap/:year", controller.GetYearInReview)
+		musicGroup.GET("/scrobble/accounts", controller.ListScrobbleAccounts)
+		musicGroup.PUT("/scrobble/accounts/:service", controller.LinkScrobbleAccount)
+		musicGroup.DELETE("/scrobble/accounts/:service", controller.UnlinkScrobbleAccount)
+	}
+
+	// 歌单；分享链接不需要登录
+	v1.GET("/shared/playlists/:token", controller.GetSharedPlaylist)
+	playlistGroup := musicGroup.Group("/playlists")
+	{
+		playlistGroup.GET("", controller.ListPlaylists)
+		playlistGroup.POST("", controller.CreatePlaylist)
+		playlistGroup.GET("/:id", controller.GetPlaylist)
+		playlistGroup.PATCH("/:id", controller.UpdatePlaylist)
+		playlistGroup.DELETE("/:id", controller.DeletePlaylist)
+		playlistGroup.POST("/:id/tracks", controller.AddPlaylistTracks)
+		playlistGroup.POST("/:id/tracks/remove", controller.RemovePlaylistTracks)
+		playlistGroup.PUT("/:id/tracks/order", controller.ReorderPlaylistTracks)
+		playlistGroup.POST("/:id/duplicate", controller.DuplicatePlaylist)
+		playlistGroup.POST("/:id/share", controller.SharePlaylist)
+		playlistGroup.DELETE("/:id/share", controller.UnsharePlaylist)
+		playlistGroup.POST("/:id/collaborators", controller.AddPlaylistCollaborator)
+		playlistGroup.DELETE("/:id/collaborators/:user_id", controller.RemovePlaylistCollaborator)
+	}
+
+	v1.POST("/upload", middleware.RequireScope(models.ScopeUpload), controller.UploadMusic)
+	v1.PUT("/tracks/:id/visibility", middleware.RequireScope(models.ScopeUpload), controller.SetTrackVisibility)
+
+	adminGroup := v1.Group("/admin", middleware.RequireScope(models.ScopeAdmin))
+	{
+		adminGroup.GET("/tracks/:id", controller.GetTrack)
+		adminGroup.PATCH("/tracks/:id", controller.UpdateTrack)
+		adminGroup.DELETE("/tracks/:id", controller.DeleteTrack)
+		adminGroup.POST("/tracks/bulk", controller.BulkUpdateTracks)
+		adminGroup.POST("/artists/:id/aliases", controller.AddArtistAlias)
+		adminGroup.POST("/artists/:id/merge", controller.MergeArtists)
+	}
+
+	// Subsonic / OpenSubsonic 兼容接口，供 DSub、Symfonium、Feishin 等客户端使用；
+	// 每个接口同时注册 GET 和 POST，以及带 .view 后缀的旧地址
+	rest := e.Group("/rest")
+	subsonic := func(name string, handlers ...gin.HandlerFunc) {
+		for _, path := range []string{"/" + name, "/" + name + ".view"} {
+			rest.GET(path, handlers...)
+			rest.POST(path, handlers...)
+		}
+	}
+	subsonic("getOpenSubsonicExtensions", controller.SubsonicGetOpenSubsonicExtensions)
+	for name, handler := range map[string]gin.HandlerFunc{
+		"ping":            controller.SubsonicPing,
+		"getLicense":      controller.SubsonicGetLicense,
+		"getMusicFolders": controller.SubsonicGetMusicFolders,
+		"getArtists":      controller.SubsonicGetArtists,
+		"getArtist":       controller.SubsonicGetArtist,
+		"getAlbum":        controller.SubsonicGetAlbum,
+		"getSong":         controller.SubsonicGetSong,
+		"search3":         controller.SubsonicSearch3,
+		"stream":          controller.SubsonicStream,
+		"download":        controller.SubsonicDownload,
+		"getCoverArt":     controller.SubsonicGetCoverArt,
+		"getPlaylists":    controller.SubsonicGetPlaylists,
+		"getPlaylist":     controller.SubsonicGetPlaylist,
+		"star":            controller.SubsonicStar,
+		"unstar":          controller.SubsonicUnstar,
+		"scrobble":        controller.SubsonicScrobble,
+	} {
+		subsonic(name, controller.SubsonicAuth(), handler)
+	}
+
+	// 可续传上传（tus 1.0），OPTIONS 用于协议发现，不需要令牌
+	tusGroup := v1.Group("/tus")
+	{
+		tusGroup.OPTIONS("", controller.TusResumable(), controller.TusOptions)
+		tusGroup.OPTIONS("/:id", controller.TusResumable(), controller.TusOptions)
+		tusGroup.Use(middleware.RequireScope(models.ScopeUpload), controller.TusResumable())
+		tusGroup.POST("", controller.TusCreate)
+		tusGroup.POST("/:id", controller.TusMethodOverride)
+		tusGroup.HEAD("/:id", controller.TusHead)
+		tusGroup.PATCH("/:id", controller.TusPatch)
+		tusGroup.DELETE("/:id", controller.TusDelete)
+		tusGroup.GET("/:id", controller.GetTusUpload)
 	}
 }
@@ -0,0 +1,161 @@
+package s3_storage
+
+import (
+	"Music/config"
+	"Music/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	storage.Register("s3", func(bucket string) (storage.Storage, error) {
+		return NewClient(bucket)
+	})
+}
+
+// S3Client 基于 S3 协议的存储后端，可对接 AWS S3、MinIO 等兼容服务
+type S3Client struct {
+	client *minio.Client
+	bucket string
+}
+
+// InitClient 创建默认存储桶的客户端
+func InitClient() (*S3Client, error) {
+	return NewClient("")
+}
+
+// NewClient 创建指定存储桶的客户端，bucket 为空时使用 s3.bucket
+func NewClient(bucket string) (*S3Client, error) {
+	cfg := config.Config.S3
+	if bucket == "" {
+		bucket = cfg.Bucket
+	}
+	if cfg.Endpoint == "" || bucket == "" {
+		return nil, errors.New("s3.endpoint 与 s3.bucket 不能为空")
+	}
+	// endpoint 允许带协议头，未写时按 use_ssl 决定
+	endpoint, secure := cfg.Endpoint, cfg.UseSSL
+	if u, err := url.Parse(cfg.Endpoint); err == nil && u.Host != "" {
+		endpoint, secure = u.Host, u.Scheme == "https"
+	}
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       secure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Client{client: client, bucket: bucket}, nil
+}
+
+// Put 上传对象，返回对象地址
+func (s *S3Client) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(s.client.EndpointURL().String(), "/") + "/" + s.bucket + "/" + key, nil
+}
+
+// Get 读取对象，支持 Range
+func (s *S3Client) Get(ctx context.Context, key string, rangeHeader string) (*storage.Object, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	start, end, partial, err := storage.ParseRange(rangeHeader, info.Size)
+	if err != nil {
+		return nil, err
+	}
+	opt := minio.GetObjectOptions{}
+	if partial {
+		if err := opt.SetRange(start, end); err != nil {
+			return nil, err
+		}
+	}
+	body, err := s.client.GetObject(ctx, s.bucket, key, opt)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &storage.Object{Body: body, Info: *info, Start: start, End: end, Partial: partial}, nil
+}
+
+func (s *S3Client) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	o, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &storage.ObjectInfo{
+		Key:          key,
+		Size:         o.Size,
+		ContentType:  o.ContentType,
+		ETag:         `"` + o.ETag + `"`,
+		LastModified: o.LastModified,
+	}, nil
+}
+
+func (s *S3Client) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Client) Copy(ctx context.Context, srcKey, dstKey string) (string, error) {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey},
+	)
+	if err != nil {
+		return "", convertError(err)
+	}
+	return strings.TrimSuffix(s.client.EndpointURL().String(), "/") + "/" + s.bucket + "/" + dstKey, nil
+}
+
+func (s *S3Client) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	for o := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if o.Err != nil {
+			return nil, o.Err
+		}
+		objects = append(objects, storage.ObjectInfo{
+			Key:          o.Key,
+			Size:         o.Size,
+			ETag:         `"` + o.ETag + `"`,
+			LastModified: o.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+// PresignURL 生成限时下载地址
+func (s *S3Client) PresignURL(ctx context.Context, key string, expire time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expire, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// convertError 把 404 转换为 storage.ErrNotFound
+func convertError(err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == http.StatusNotFound || resp.Code == "NoSuchKey" {
+		return storage.ErrNotFound
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return storage.ErrInvalidRange
+	}
+	return fmt.Errorf("s3: %w", err)
+}
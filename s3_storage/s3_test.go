@@ -0,0 +1,380 @@
+package s3_storage
+
+import (
+	"Music/config"
+	"Music/storage"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+// fakeS3 只实现 S3Client 用到的几个接口（路径风格），不校验签名
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]fakeObject
+	// 收到的请求，格式为 "METHOD key"
+	requests []string
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string]fakeObject{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+key)
+	f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copy(w, r, key)
+	case r.Method == http.MethodPut:
+		f.put(w, r, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		f.mu.Lock()
+		delete(f.objects, key)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) put(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		if body, err = decodeAWSChunked(body); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+	}
+	o := fakeObject{data: body, contentType: r.Header.Get("Content-Type"), modified: time.Now().UTC()}
+	f.mu.Lock()
+	f.objects[key] = o
+	f.mu.Unlock()
+	w.Header().Set("ETag", etag(o.data))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeS3) copy(w http.ResponseWriter, r *http.Request, key string) {
+	src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	srcKey := strings.TrimPrefix(strings.TrimPrefix(src, "/"), f.bucket+"/")
+	f.mu.Lock()
+	o, ok := f.objects[srcKey]
+	if ok {
+		f.objects[key] = o
+	}
+	f.mu.Unlock()
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<CopyObjectResult><LastModified>%s</LastModified><ETag>%s</ETag></CopyObjectResult>`,
+		o.modified.Format(time.RFC3339), etag(o.data))
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	f.mu.Lock()
+	o, ok := f.objects[key]
+	f.mu.Unlock()
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	w.Header().Set("ETag", etag(o.data))
+	w.Header().Set("Content-Type", o.contentType)
+	// ServeContent 处理 Range，返回 206 或 416
+	http.ServeContent(w, r, key, o.modified, bytes.NewReader(o.data))
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	var b strings.Builder
+	b.WriteString(`<ListBucketResult><Name>` + f.bucket + `</Name><IsTruncated>false</IsTruncated>`)
+	f.mu.Lock()
+	for key, o := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			fmt.Fprintf(&b, `<Contents><Key>%s</Key><Size>%d</Size><ETag>%s</ETag><LastModified>%s</LastModified></Contents>`,
+				key, len(o.data), etag(o.data), o.modified.Format(time.RFC3339))
+		}
+	}
+	f.mu.Unlock()
+	b.WriteString(`</ListBucketResult>`)
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, b.String())
+}
+
+func (f *fakeS3) seen(req string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.requests {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// decodeAWSChunked 解析流式签名（aws-chunked）的请求体：<hex 长度>;chunk-signature=...\r\n<数据>\r\n
+func decodeAWSChunked(body []byte) ([]byte, error) {
+	var out []byte
+	r := bufio.NewReader(bytes.NewReader(body))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return out, nil
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk[:n]...)
+	}
+}
+
+func newTestClient(t *testing.T) (*S3Client, *fakeS3, *httptest.Server) {
+	t.Helper()
+	fake := newFakeS3("music")
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	old := config.Config.S3
+	t.Cleanup(func() { config.Config.S3 = old })
+	config.Config.S3 = config.S3Config{
+		Endpoint:  srv.URL,
+		Region:    "us-east-1",
+		Bucket:    "music",
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+		PathStyle: true,
+	}
+	client, err := InitClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, fake, srv
+}
+
+func TestS3ClientRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s, fake, srv := newTestClient(t)
+	data := "0123456789abcdefghij"
+
+	loc, err := s.Put(ctx, "music/a.mp3", strings.NewReader(data), int64(len(data)), "audio/mpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/music/music/a.mp3"; loc != want {
+		t.Errorf("Put 地址 = %q, want %q", loc, want)
+	}
+
+	info, err := s.Stat(ctx, "music/a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) || info.ContentType != "audio/mpeg" || info.ETag != etag([]byte(data)) {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	obj, err := s.Get(ctx, "music/a.mp3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, obj); got != data || obj.Partial {
+		t.Errorf("Get = %q, Partial = %v", got, obj.Partial)
+	}
+
+	obj, err = s.Get(ctx, "music/a.mp3", "bytes=5-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !obj.Partial || obj.ContentRange() != "bytes 5-9/20" || obj.ContentLength() != 5 {
+		t.Errorf("Range 读取 Partial = %v, ContentRange = %q", obj.Partial, obj.ContentRange())
+	}
+	if got := readObject(t, obj); got != "56789" {
+		t.Errorf("Range 读取 = %q", got)
+	}
+
+	if _, err := s.Stat(ctx, "music/missing.mp3"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("不存在的对象 Stat err = %v", err)
+	}
+	if _, err := s.Get(ctx, "music/missing.mp3", ""); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("不存在的对象 Get err = %v", err)
+	}
+
+	if _, err := s.Copy(ctx, "music/a.mp3", "music/b.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err = s.Get(ctx, "music/b.mp3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, obj); got != data {
+		t.Errorf("复制后的对象 = %q", got)
+	}
+	if _, err := s.Copy(ctx, "music/missing.mp3", "music/c.mp3"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("复制不存在的对象 err = %v", err)
+	}
+
+	objects, err := s.List(ctx, "music/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("List = %+v", objects)
+	}
+
+	if err := s.Delete(ctx, "music/a.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.seen("DELETE music/a.mp3") {
+		t.Error("未发送 DELETE 请求")
+	}
+	if _, err := s.Stat(ctx, "music/a.mp3"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("删除后 Stat err = %v", err)
+	}
+}
+
+func TestS3ClientInvalidRange(t *testing.T) {
+	ctx := context.Background()
+	s, fake, _ := newTestClient(t)
+	if _, err := s.Put(ctx, "a.mp3", strings.NewReader("0123456789"), 10, "audio/mpeg"); err != nil {
+		t.Fatal(err)
+	}
+	// 按 Stat 得到的大小判断，不发出 GET 请求
+	if _, err := s.Get(ctx, "a.mp3", "bytes=100-"); !errors.Is(err, storage.ErrInvalidRange) {
+		t.Errorf("越界 Range err = %v", err)
+	}
+	if fake.seen("GET a.mp3") {
+		t.Error("越界 Range 不应请求对象内容")
+	}
+
+	// 对象在 Stat 之后变小时由服务端返回 416
+	opt := minio.GetObjectOptions{}
+	opt.SetRange(100, 199)
+	body, err := s.client.GetObject(ctx, s.bucket, "a.mp3", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(body)
+	if resp := minio.ToErrorResponse(err); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("服务端应返回 416, err = %v", err)
+	}
+	if err := convertError(err); !errors.Is(err, storage.ErrInvalidRange) {
+		t.Errorf("convertError(416) = %v", err)
+	}
+}
+
+func TestS3ClientPresignURL(t *testing.T) {
+	ctx := context.Background()
+	s, _, srv := newTestClient(t)
+	if _, err := s.Put(ctx, "ab/cd.jpg", strings.NewReader("jpeg"), 4, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.PresignURL(ctx, "ab/cd.jpg", 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, srv.URL+"/music/ab/cd.jpg?") {
+		t.Errorf("签名地址 = %q", raw)
+	}
+	q := u.Query()
+	if q.Get("X-Amz-Expires") != "600" || q.Get("X-Amz-Signature") == "" ||
+		!strings.HasPrefix(q.Get("X-Amz-Credential"), "test-access/") {
+		t.Errorf("签名参数 = %v", q)
+	}
+
+	resp, err := http.Get(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "jpeg" {
+		t.Errorf("签名地址下载 = %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestNewClientRequiresEndpointAndBucket(t *testing.T) {
+	old := config.Config.S3
+	t.Cleanup(func() { config.Config.S3 = old })
+	config.Config.S3 = config.S3Config{Endpoint: "127.0.0.1:9000"}
+	if _, err := NewClient(""); err == nil {
+		t.Error("缺少 bucket 时应返回错误")
+	}
+	c, err := NewClient("artwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.bucket != "artwork" || c.client.EndpointURL().Scheme != "http" {
+		t.Errorf("bucket = %q, endpoint = %s", c.bucket, c.client.EndpointURL())
+	}
+}
+
+func readObject(t *testing.T, obj *storage.Object) string {
+	t.Helper()
+	defer obj.Body.Close()
+	b, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"Music/config"
+	"Music/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dhowden/tag"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ArtworkPrefix 封面对象的 key 前缀，封面保存在逻辑桶 artwork 中
+const ArtworkPrefix = "artwork/"
+
+// 封面图片大小上限
+const maxArtworkSize = 20 << 20
+
+// 封面像素数上限；解码后每像素约占 4 字节，高压缩比的大尺寸图片文件很小但解码时会耗尽内存
+const maxArtworkPixels = 6000 * 6000
+
+// 与音频放在同一目录的封面文件名，按顺序查找，不区分大小写
+var sidecarArtworkNames = []string{"cover.jpg", "cover.jpeg", "cover.png", "folder.jpg", "folder.jpeg", "folder.png", "front.jpg", "front.png"}
+
+var artworkIDRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ArtworkSizes 可请求的缩略图边长
+var ArtworkSizes = []int{64, 300, 600}
+
+// ArtworkFormats 缩略图格式 -> 扩展名
+var ArtworkFormats = map[string]string{
+	"jpeg": "jpg",
+	"png":  "png",
+}
+
+// ErrInvalidVariant 不支持的缩略图尺寸或格式
+var ErrInvalidVariant = errors.New("不支持的缩略图尺寸或格式")
+
+// ErrInvalidArtwork 不是图片或超过大小上限
+var ErrInvalidArtwork = errors.New("无效的封面图片")
+
+// Artwork 提取到的封面
+type Artwork struct {
+	Data     []byte
+	MIMEType string
+	Source   string // embedded 或封面文件路径
+}
+
+// ArtworkKey 封面在存储中的对象 key
+func ArtworkKey(id string) string {
+	return ArtworkPrefix + id
+}
+
+// ArtworkVariantKey 缩略图的对象 key，以原图 key 为前缀，删除封面时一并列出
+func ArtworkVariantKey(id string, size int, format string) string {
+	return fmt.Sprintf("%s%s_%d.%s", ArtworkPrefix, id, size, ArtworkFormats[format])
+}
+
+// ArtworkURL 封面的访问地址，id 为空时返回空字符串
+func ArtworkURL(id string) string {
+	if id == "" {
+		return ""
+	}
+	return config.BaseURL() + "/music/v1/artwork/" + id
+}
+
+// ValidArtworkID 判断是否为合法的封面 ID（SHA-256 十六进制）
+func ValidArtworkID(id string) bool {
+	return artworkIDRe.MatchString(id)
+}
+
+// EmbeddedArtwork 读取音频文件内嵌的封面（ID3 APIC / FLAC PICTURE / MP4 covr），没有时返回 nil
+func EmbeddedArtwork(audioPath string) (*Artwork, error) {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tags, err := tag.ReadFrom(f)
+	if err != nil {
+		return nil, nil
+	}
+	pic := tags.Picture()
+	if pic == nil || len(pic.Data) == 0 {
+		return nil, nil
+	}
+	return &Artwork{Data: pic.Data, MIMEType: pic.MIMEType, Source: "embedded"}, nil
+}
+
+// FindArtwork 优先使用内嵌封面，没有时查找同目录下的 cover.jpg / folder.jpg 等，都没有时返回 nil
+func FindArtwork(audioPath string) (*Artwork, error) {
+	art, err := EmbeddedArtwork(audioPath)
+	if err != nil || art != nil {
+		return art, err
+	}
+	dir := filepath.Dir(audioPath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sidecarArtworkNames {
+		for _, e := range entries {
+			if e.IsDir() || !strings.EqualFold(e.Name(), name) {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return &Artwork{Data: data, Source: path}, nil
+		}
+	}
+	return nil, nil
+}
+
+type ArtworkService struct{}
+
+func NewArtworkService() *ArtworkService {
+	return &ArtworkService{}
+}
+
+// Save 按内容哈希保存封面，相同图片只保存一份，返回封面 ID
+func (s *ArtworkService) Save(ctx context.Context, art *Artwork) (string, error) {
+	if len(art.Data) == 0 || len(art.Data) > maxArtworkSize {
+		return "", ErrInvalidArtwork
+	}
+	contentType := http.DetectContentType(art.Data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", ErrInvalidArtwork
+	}
+	// 无法识别的格式（如 webp）不会被解码，照常保存，只是不能生成缩略图
+	if err := checkArtworkDimensions(art.Data); err != nil && !errors.Is(err, image.ErrFormat) {
+		return "", err
+	}
+	id := artworkID(art.Data)
+	bucket := storage.Bucket("artwork")
+	if _, err := bucket.Stat(ctx, ArtworkKey(id)); err == nil {
+		return id, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return "", err
+	}
+	if _, err := bucket.Put(ctx, ArtworkKey(id), bytes.NewReader(art.Data), int64(len(art.Data)), contentType); err != nil {
+		return "", fmt.Errorf("保存封面失败: %v", err)
+	}
+	return id, nil
+}
+
+// Lookup 返回已经保存过的封面 ID，未保存时返回空字符串；不写入存储，供只读的列表接口使用
+func (s *ArtworkService) Lookup(ctx context.Context, art *Artwork) (string, error) {
+	if len(art.Data) == 0 {
+		return "", nil
+	}
+	id := artworkID(art.Data)
+	if _, err := storage.Bucket("artwork").Stat(ctx, ArtworkKey(id)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+func artworkID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveFor 提取并保存音频文件的封面，没有封面时返回空字符串
+func (s *ArtworkService) SaveFor(ctx context.Context, audioPath string) (string, error) {
+	art, err := FindArtwork(audioPath)
+	if err != nil || art == nil {
+		return "", err
+	}
+	return s.Save(ctx, art)
+}
+
+// Open 读取封面
+func (s *ArtworkService) Open(ctx context.Context, id string, rangeHeader string) (*storage.Object, error) {
+	if !ValidArtworkID(id) {
+		return nil, storage.ErrNotFound
+	}
+	return storage.Bucket("artwork").Get(ctx, ArtworkKey(id), rangeHeader)
+}
+
+// OpenVariant 读取缩略图，第一次请求时由原图生成并保存到存储中
+func (s *ArtworkService) OpenVariant(ctx context.Context, id string, size int, format string, rangeHeader string) (*storage.Object, error) {
+	if !ValidArtworkID(id) {
+		return nil, storage.ErrNotFound
+	}
+	if _, ok := ArtworkFormats[format]; !ok || !validArtworkSize(size) {
+		return nil, ErrInvalidVariant
+	}
+	bucket := storage.Bucket("artwork")
+	key := ArtworkVariantKey(id, size, format)
+	obj, err := bucket.Get(ctx, key, rangeHeader)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return obj, err
+	}
+
+	orig, err := bucket.Get(ctx, ArtworkKey(id), "")
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(orig.Body, maxArtworkSize+1))
+	orig.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArtworkSize {
+		return nil, ErrInvalidArtwork
+	}
+	// 先只读取图片头检查尺寸再解码，限制之前保存的封面也要检查
+	if err := checkArtworkDimensions(data); err != nil {
+		if errors.Is(err, ErrInvalidArtwork) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("解码封面失败: %v", err)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码封面失败: %v", err)
+	}
+	data, contentType, err := encodeImage(resizeImage(src, size), format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := bucket.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, fmt.Errorf("保存缩略图失败: %v", err)
+	}
+	return bucket.Get(ctx, key, rangeHeader)
+}
+
+// Delete 删除封面原图及其全部缩略图
+func (s *ArtworkService) Delete(ctx context.Context, id string) error {
+	if !ValidArtworkID(id) {
+		return storage.ErrNotFound
+	}
+	bucket := storage.Bucket("artwork")
+	objects, err := bucket.List(ctx, ArtworkKey(id))
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := bucket.Delete(ctx, o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkArtworkDimensions 只解析图片头，图片头损坏、宽高无效或像素数超过 maxArtworkPixels 时返回 ErrInvalidArtwork，
+// 未注册解码器的格式返回 image.ErrFormat
+func checkArtworkDimensions(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArtwork, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxArtworkPixels {
+		return fmt.Errorf("%w: 尺寸 %dx%d 超出范围", ErrInvalidArtwork, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+func validArtworkSize(size int) bool {
+	for _, s := range ArtworkSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"Music/config"
+	"Music/storage"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// useTestStorage 把全局存储换成临时目录中的本地存储
+func useTestStorage(t *testing.T) storage.Storage {
+	t.Helper()
+	s, err := storage.NewLocalStorage(config.LocalStorageConfig{Root: t.TempDir(), Secret: "test"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := storage.Store
+	storage.Store = s
+	t.Cleanup(func() { storage.Store = old })
+	return s
+}
+
+// pngHeader 只有 IHDR 的 PNG，DecodeConfig 能读出尺寸，完整解码会失败
+func pngHeader(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 2 // 8 位 RGB
+	chunk := append([]byte("IHDR"), ihdr...)
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func smallPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArtworkSaveRejectsHugeDimensions(t *testing.T) {
+	useTestStorage(t)
+	s := NewArtworkService()
+	ctx := context.Background()
+
+	if _, err := s.Save(ctx, &Artwork{Data: pngHeader(30000, 30000)}); !errors.Is(err, ErrInvalidArtwork) {
+		t.Errorf("30000x30000 的图片应被拒绝, err = %v", err)
+	}
+	if _, err := s.Save(ctx, &Artwork{Data: pngHeader(0, 10)}); !errors.Is(err, ErrInvalidArtwork) {
+		t.Errorf("宽度为 0 的图片应被拒绝, err = %v", err)
+	}
+	id, err := s.Save(ctx, &Artwork{Data: smallPNG(t, 800, 600)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := s.OpenVariant(ctx, id, 300, "png", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Body.Close()
+	thumb, err := png.DecodeConfig(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != 300 || thumb.Height != 225 {
+		t.Errorf("缩略图尺寸 = %dx%d", thumb.Width, thumb.Height)
+	}
+}
+
+func TestArtworkVariantChecksStoredOriginal(t *testing.T) {
+	bucket := useTestStorage(t)
+	s := NewArtworkService()
+	ctx := context.Background()
+
+	// 加上尺寸检查之前保存的封面，直接写入存储
+	data := pngHeader(30000, 30000)
+	id := artworkID(data)
+	if _, err := bucket.Put(ctx, ArtworkKey(id), bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.OpenVariant(ctx, id, 64, "jpeg", ""); !errors.Is(err, ErrInvalidArtwork) {
+		t.Errorf("超大原图不应生成缩略图, err = %v", err)
+	}
+	if _, err := bucket.Stat(ctx, ArtworkVariantKey(id, 64, "jpeg")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("不应保存缩略图, err = %v", err)
+	}
+	// 原图仍可按原样读取
+	obj, err := s.Open(ctx, id, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if !bytes.Equal(got, data) {
+		t.Error("原图内容不一致")
+	}
+}
+
+func TestArtworkLookupDoesNotWrite(t *testing.T) {
+	bucket := useTestStorage(t)
+	s := NewArtworkService()
+	ctx := context.Background()
+	data := smallPNG(t, 10, 10)
+
+	id, err := s.Lookup(ctx, &Artwork{Data: data})
+	if err != nil || id != "" {
+		t.Errorf("未保存的封面 Lookup = %q, %v", id, err)
+	}
+	if objects, _ := bucket.List(ctx, ArtworkPrefix); len(objects) != 0 {
+		t.Errorf("Lookup 不应写入存储, objects = %v", objects)
+	}
+	saved, err := s.Save(ctx, &Artwork{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.Lookup(ctx, &Artwork{Data: data}); err != nil || id != saved {
+		t.Errorf("已保存的封面 Lookup = %q, %v, want %q", id, err, saved)
+	}
+}
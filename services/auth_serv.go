@@ -0,0 +1,533 @@
+package services
+
+import (
+	"Music/config"
+	"Music/models"
+	"Music/my_utils"
+	"Music/repositories"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 认证方式
+const (
+	AuthJWT        = "jwt"
+	AuthAPIKey     = "api_key"
+	AuthAdminToken = "admin_token"
+	AuthSubsonic   = "subsonic"
+)
+
+// API 密钥明文的前缀，用于和 JWT 区分
+const apiKeyPrefix = "mk_"
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrInvalidToken       = errors.New("令牌无效或已过期")
+	ErrUserDisabled       = errors.New("用户已停用")
+	ErrUserExists         = errors.New("用户名已存在")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Principal 通过认证的调用方
+type Principal struct {
+	UserID   uint          `json:"user_id"` // 引导令牌为 0
+	Username string        `json:"username"`
+	Role     string        `json:"role"`
+	Scopes   models.Scopes `json:"scopes"` // 角色的权限，通过 API 密钥认证时为密钥的权限
+	Method   string        `json:"method"`
+}
+
+// Has 是否拥有 scope 权限
+func (p *Principal) Has(scope string) bool {
+	return p != nil && p.Scopes.Has(scope)
+}
+
+// Viewer 调用方浏览曲目时的可见范围，拥有 admin 权限时可见全部曲目
+func (p *Principal) Viewer() repositories.Viewer {
+	if p == nil {
+		return repositories.Viewer{}
+	}
+	return repositories.Viewer{UserID: p.UserID, All: p.Has(models.ScopeAdmin)}
+}
+
+// TokenPair 登录或刷新后返回的令牌
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌有效期（秒）
+}
+
+type AuthService struct {
+	users   *repositories.UserRepository
+	keys    *repositories.APIKeyRepository
+	refresh *repositories.RefreshTokenRepository
+}
+
+func NewAuthService() *AuthService {
+	return &AuthService{
+		users:   &repositories.UserRepository{},
+		keys:    &repositories.APIKeyRepository{},
+		refresh: &repositories.RefreshTokenRepository{},
+	}
+}
+
+var (
+	secretOnce      sync.Once
+	generatedSecret []byte
+)
+
+// jwtSecret 配置中的密钥；未配置时随机生成，只在本进程内有效
+func jwtSecret() []byte {
+	if s := config.Config.Auth.JWTSecret; s != "" {
+		return []byte(s)
+	}
+	secretOnce.Do(func() {
+		generatedSecret = make([]byte, 32)
+		if _, err := rand.Read(generatedSecret); err != nil {
+			panic(err)
+		}
+		my_utils.Warn("未配置 auth.jwt_secret，使用随机密钥，重启后需重新登录")
+	})
+	return generatedSecret
+}
+
+func accessTokenTTL() time.Duration {
+	if ttl := config.Config.Auth.AccessTokenTTL; ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
+
+func refreshTokenTTL() time.Duration {
+	if ttl := config.Config.Auth.RefreshTokenTTL; ttl > 0 {
+		return ttl
+	}
+	return 30 * 24 * time.Hour
+}
+
+// NormalizeScopes 校验并去重 API 密钥的权限范围，按 models.AllScopes 的顺序排列；为空时默认 listen
+func NormalizeScopes(scopes []string) (models.Scopes, error) {
+	seen := map[string]bool{}
+	for _, s := range scopes {
+		for _, v := range models.Scopes(s).List() {
+			seen[strings.ToLower(v)] = true
+		}
+	}
+	if len(seen) == 0 {
+		return models.ScopeListen, nil
+	}
+	var list []string
+	for _, s := range models.AllScopes {
+		if seen[s] {
+			list = append(list, s)
+			delete(seen, s)
+		}
+	}
+	for s := range seen {
+		return "", &FieldError{"scopes", fmt.Sprintf("未知的权限 %q，可选 %s", s, strings.Join(models.AllScopes, " / "))}
+	}
+	return models.Scopes(strings.Join(list, ",")), nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < 8 {
+		return "", &FieldError{"password", "至少 8 个字符"}
+	}
+	if len(password) > 72 {
+		return "", &FieldError{"password", "不能超过 72 个字节"}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// normalizeRole 校验角色，为空时默认 listener
+func normalizeRole(role string) (string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role == "" {
+		return models.UserRoleListener, nil
+	}
+	for _, r := range models.UserRoles {
+		if r == role {
+			return role, nil
+		}
+	}
+	return "", &FieldError{"role", fmt.Sprintf("未知的角色 %q，可选 %s", role, strings.Join(models.UserRoles, " / "))}
+}
+
+// CreateUser 创建用户
+func (s *AuthService) CreateUser(username, password, role string) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, &FieldError{"username", "只能包含字母、数字和 _ . -，不超过 64 个字符"}
+	}
+	role, err := normalizeRole(role)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.users.GetByUsername(username); err == nil {
+		return nil, ErrUserExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{Username: username, PasswordHash: hash, Role: role}
+	if err := s.users.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser 按用户名查找用户
+func (s *AuthService) GetUser(username string) (*models.User, error) {
+	return s.users.GetByUsername(username)
+}
+
+func (s *AuthService) ListUsers() ([]models.User, error) {
+	return s.users.List()
+}
+
+// SetPassword 修改密码，已签发的刷新令牌全部作废
+func (s *AuthService) SetPassword(username, password string) error {
+	user, err := s.users.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash, err = hashPassword(password); err != nil {
+		return err
+	}
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.users.WithTx(tx).UpdateFields(user, "PasswordHash"); err != nil {
+			return err
+		}
+		return s.refresh.WithTx(tx).RevokeByUser(user.ID, time.Now())
+	})
+}
+
+// SetRole 修改用户角色；API 密钥的权限同时受角色限制，不需要逐个修改
+func (s *AuthService) SetRole(username, role string) (*models.User, error) {
+	user, err := s.users.GetByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role, err = normalizeRole(role); err != nil {
+		return nil, err
+	}
+	return user, s.users.UpdateFields(user, "Role")
+}
+
+// SetDisabled 停用或启用用户，停用时作废已签发的刷新令牌
+func (s *AuthService) SetDisabled(username string, disabled bool) error {
+	user, err := s.users.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	user.Disabled = disabled
+	if err := s.users.UpdateFields(user, "Disabled"); err != nil {
+		return err
+	}
+	if disabled {
+		return s.refresh.RevokeByUser(user.ID, time.Now())
+	}
+	return nil
+}
+
+// dummyHash 用户不存在时也做一次 bcrypt 比较，避免通过响应时间探测用户名
+var dummyHash = []byte("$2a$10$Sopte2re.zO8UxUeCKgfM.WPuWfE.76Q6y1l9nhttrune.aDhmOEm")
+
+// Login 校验用户名和密码，签发访问令牌和刷新令牌
+func (s *AuthService) Login(username, password string) (*TokenPair, error) {
+	user, err := s.users.GetByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if err := s.refresh.DeleteExpired(time.Now()); err != nil {
+		my_utils.Warn("清理过期刷新令牌失败: %v", err)
+	}
+	return s.issue(user)
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧刷新令牌作废；
+// 已作废的刷新令牌再次使用说明可能被盗用，作废该用户的全部刷新令牌
+func (s *AuthService) Refresh(token string) (*TokenPair, error) {
+	now := time.Now()
+	claims, err := parseJWT(jwtSecret(), token, now)
+	if err != nil || claims.Type != tokenRefresh {
+		return nil, ErrInvalidToken
+	}
+	stored, err := s.refresh.GetByID(claims.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	revoked, err := s.refresh.Revoke(stored.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		my_utils.Warn("用户 %d 的刷新令牌 %s 被重复使用，作废全部刷新令牌", stored.UserID, stored.ID)
+		if err := s.refresh.RevokeByUser(stored.UserID, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	user, err := s.users.GetByID(stored.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return s.issue(user)
+}
+
+// Logout 作废刷新令牌
+func (s *AuthService) Logout(token string) error {
+	claims, err := parseJWT(jwtSecret(), token, time.Now())
+	if err != nil || claims.Type != tokenRefresh {
+		return ErrInvalidToken
+	}
+	_, err = s.refresh.Revoke(claims.ID, time.Now())
+	return err
+}
+
+func (s *AuthService) issue(user *models.User) (*TokenPair, error) {
+	now := time.Now()
+	secret := jwtSecret()
+	access, err := signJWT(secret, jwtClaims{
+		Subject:   user.ID,
+		Type:      tokenAccess,
+		Scope:     string(user.Scopes()),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(accessTokenTTL()).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	stored := &models.RefreshToken{ID: randomHex(16), UserID: user.ID, ExpiresAt: now.Add(refreshTokenTTL())}
+	if err := s.refresh.Create(stored); err != nil {
+		return nil, err
+	}
+	refresh, err := signJWT(secret, jwtClaims{
+		Subject:   user.ID,
+		Type:      tokenRefresh,
+		ID:        stored.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: stored.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL() / time.Second),
+	}, nil
+}
+
+// CreateAPIKey 为用户创建 API 密钥，返回只出现这一次的明文；
+// scopes 为空时继承用户角色的全部权限，ttl 为 0 表示不过期
+func (s *AuthService) CreateAPIKey(userID uint, name string, scopes []string, ttl time.Duration) (string, *models.APIKey, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	granted := user.Scopes()
+	if len(scopes) > 0 {
+		if granted, err = NormalizeScopes(scopes); err != nil {
+			return "", nil, err
+		}
+		for _, scope := range granted.List() {
+			if !user.Scopes().Has(scope) {
+				return "", nil, &FieldError{"scopes", fmt.Sprintf("用户没有 %s 权限", scope)}
+			}
+		}
+	}
+	name = strings.TrimSpace(name)
+	if len([]rune(name)) > 64 {
+		return "", nil, &FieldError{"name", "不能超过 64 个字符"}
+	}
+	plain := apiKeyPrefix + randomHex(24)
+	key := &models.APIKey{
+		UserID:  user.ID,
+		Name:    name,
+		Prefix:  plain[:len(apiKeyPrefix)+6],
+		KeyHash: hashAPIKey(plain),
+		Scopes:  granted,
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		key.ExpiresAt = &expires
+	}
+	if err := s.keys.Create(key); err != nil {
+		return "", nil, err
+	}
+	return plain, key, nil
+}
+
+func (s *AuthService) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	return s.keys.ListByUser(userID)
+}
+
+// RevokeAPIKey 删除用户的 API 密钥
+func (s *AuthService) RevokeAPIKey(userID, id uint) error {
+	return s.keys.Delete(userID, id)
+}
+
+// Authenticate 识别凭据：API 密钥（mk_ 开头）、访问令牌或配置中的引导令牌。
+// 权限以用户当前的角色为准，修改角色或停用用户后立即生效
+func (s *AuthService) Authenticate(token string) (*Principal, error) {
+	if admin := config.Config.Auth.AdminToken; admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return &Principal{Username: "admin", Role: models.UserRoleAdmin, Scopes: models.RoleScopes(models.UserRoleAdmin), Method: AuthAdminToken}, nil
+	}
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return s.authenticateAPIKey(token)
+	}
+	claims, err := parseJWT(jwtSecret(), token, time.Now())
+	if err != nil || claims.Type != tokenAccess {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.activeUser(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{UserID: user.ID, Username: user.Username, Role: user.Role, Scopes: user.Scopes(), Method: AuthJWT}, nil
+}
+
+func (s *AuthService) authenticateAPIKey(token string) (*Principal, error) {
+	key, err := s.keys.GetByHash(hashAPIKey(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.activeUser(key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// 密钥的权限不超过用户当前的权限
+	var scopes []string
+	for _, scope := range key.Scopes.List() {
+		if user.Scopes().Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	// 播放时每个分段请求都会带上密钥，最近使用时间每分钟最多更新一次
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		if err := s.keys.Touch(key.ID, now); err != nil {
+			my_utils.Warn("更新 API 密钥 %d 使用时间失败: %v", key.ID, err)
+		}
+	}
+	return &Principal{UserID: user.ID, Username: user.Username, Role: user.Role, Scopes: models.Scopes(strings.Join(scopes, ",")), Method: AuthAPIKey}, nil
+}
+
+// activeUser 读取未停用的用户，用户已删除时视为令牌无效
+func (s *AuthService) activeUser(id uint) (*models.User, error) {
+	user, err := s.users.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// ResetSubsonicPassword 为用户生成新的 Subsonic 密码，原密码随即失效；返回明文
+func (s *AuthService) ResetSubsonicPassword(userID uint) (string, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return "", err
+	}
+	user.SubsonicPassword = randomHex(8)
+	return user.SubsonicPassword, s.users.UpdateFields(user, "SubsonicPassword")
+}
+
+// ClearSubsonicPassword 删除用户的 Subsonic 密码，之后只能用 API 密钥（apiKey 参数）访问 Subsonic 接口
+func (s *AuthService) ClearSubsonicPassword(userID uint) error {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	user.SubsonicPassword = ""
+	return s.users.UpdateFields(user, "SubsonicPassword")
+}
+
+// AuthenticateSubsonic Subsonic 的用户名认证：token 不为空时校验 token = md5(密码 + salt)，
+// 否则校验 password（明文或 enc: 加十六进制）；比较的是用户的 Subsonic 密码而不是登录密码
+func (s *AuthService) AuthenticateSubsonic(username, password, token, salt string) (*Principal, error) {
+	user, err := s.users.GetByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if user.SubsonicPassword == "" {
+		return nil, ErrInvalidCredentials
+	}
+	expected, given := user.SubsonicPassword, password
+	if token != "" {
+		sum := md5.Sum([]byte(user.SubsonicPassword + salt))
+		expected, given = hex.EncodeToString(sum[:]), strings.ToLower(token)
+	} else if hexPassword, ok := strings.CutPrefix(password, "enc:"); ok {
+		decoded, err := hex.DecodeString(hexPassword)
+		if err != nil {
+			return nil, ErrInvalidCredentials
+		}
+		given = string(decoded)
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return &Principal{UserID: user.ID, Username: user.Username, Role: user.Role, Scopes: user.Scopes(), Method: AuthSubsonic}, nil
+}
+
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"Music/audio_info"
+	"Music/models"
+	"Music/repositories"
+	"Music/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type BackfillFailure struct {
+	MusicID uint   `json:"music_id"`
+	Error   string `json:"error"`
+}
+
+type BackfillReport struct {
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Rows       int               `json:"rows"`
+	Updated    int               `json:"updated"`
+	Failed     []BackfillFailure `json:"failed"`
+}
+
+// BackfillService 为入库时还没有解析技术参数的旧记录补全时长、码率、大小、哈希和内嵌封面
+type BackfillService struct {
+	repo    *repositories.MusicRepository
+	artwork *ArtworkService
+}
+
+func NewBackfillService() *BackfillService {
+	return &BackfillService{
+		repo:    &repositories.MusicRepository{},
+		artwork: NewArtworkService(),
+	}
+}
+
+// Backfill 下载对象重新解析，all 为 false 时只处理缺少参数的记录
+func (s *BackfillService) Backfill(ctx context.Context, all bool) (*BackfillReport, error) {
+	report := &BackfillReport{StartedAt: time.Now()}
+	var rows []models.MusicInfo
+	var err error
+	if all {
+		rows, err = s.repo.ListAll()
+	} else {
+		rows, err = s.repo.ListMissingAudioInfo()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取音乐记录失败: %v", err)
+	}
+	report.Rows = len(rows)
+	for i := range rows {
+		m := &rows[i]
+		if err := s.backfillRow(ctx, m); err != nil {
+			report.Failed = append(report.Failed, BackfillFailure{MusicID: m.ID, Error: err.Error()})
+			continue
+		}
+		report.Updated++
+	}
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+func (s *BackfillService) backfillRow(ctx context.Context, m *models.MusicInfo) error {
+	obj, err := storage.Store.Get(ctx, m.StorageKey(), "")
+	if err != nil {
+		return fmt.Errorf("读取对象失败: %v", err)
+	}
+	defer obj.Body.Close()
+
+	// 格式解析需要随机访问，先下载到临时文件
+	tmp, err := os.CreateTemp("", "backfill-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), obj.Body)
+	if err != nil {
+		return fmt.Errorf("下载对象失败: %v", err)
+	}
+
+	updates := map[string]interface{}{
+		"Size":   size,
+		"SHA256": hex.EncodeToString(h.Sum(nil)),
+	}
+	if audioHash, err := audio_info.AudioHash(tmp.Name()); err == nil {
+		updates["AudioHash"] = audioHash
+	}
+	a, err := audio_info.Parse(tmp, size)
+	if err != nil {
+		return fmt.Errorf("解析音频参数失败: %v", err)
+	}
+	info := &models.MusicInfo{}
+	applyAudioInfo(info, a)
+	updates["Codec"] = info.Codec
+	updates["Bitrate"] = info.Bitrate
+	updates["SampleRate"] = info.SampleRate
+	updates["Channels"] = info.Channels
+	updates["BitDepth"] = info.BitDepth
+	if info.Duration > 0 {
+		updates["Duration"] = info.Duration
+	}
+	// 只能取内嵌封面，临时文件旁边没有 cover.jpg
+	if m.Cover == "" {
+		if art, err := EmbeddedArtwork(tmp.Name()); err == nil && art != nil {
+			if cover, err := s.artwork.Save(ctx, art); err == nil {
+				updates["Cover"] = cover
+			}
+		}
+	}
+	return s.repo.Update(m.ID, updates)
+}
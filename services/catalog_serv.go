@@ -0,0 +1,356 @@
+package services
+
+import (
+	"Music/models"
+	"Music/my_utils"
+	"Music/repositories"
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type CatalogService struct {
+	artists *repositories.ArtistRepository
+	albums  *repositories.AlbumRepository
+	musics  *repositories.MusicRepository
+}
+
+func NewCatalogService() *CatalogService {
+	return &CatalogService{
+		artists: &repositories.ArtistRepository{},
+		albums:  &repositories.AlbumRepository{},
+		musics:  &repositories.MusicRepository{},
+	}
+}
+
+// WithTx 返回在事务 tx 中读写艺人和专辑的服务，事务回滚时新建的艺人、专辑一并撤销
+func (s *CatalogService) WithTx(tx *gorm.DB) *CatalogService {
+	return &CatalogService{
+		artists: s.artists.WithTx(tx),
+		albums:  s.albums.WithTx(tx),
+		musics:  s.musics.WithTx(tx),
+	}
+}
+
+// ResolveArtist 按名称或别名查找艺人，不存在时创建
+func (s *CatalogService) ResolveArtist(name string) (*models.Artist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("艺人名称不能为空")
+	}
+	artist, err := s.artists.FindByName(name)
+	if err == nil {
+		return artist, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	artist = &models.Artist{Name: name, SortName: name}
+	if err := s.artists.Create(artist); err != nil {
+		// 并发导入时可能被其他协程抢先创建
+		if existing, ferr := s.artists.FindByName(name); ferr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return artist, nil
+}
+
+// ResolveAlbum 查找专辑，不存在时创建；已有专辑缺少年份、流派或封面时补全
+func (s *CatalogService) ResolveAlbum(title string, artistID uint, year int, genre, cover string) (*models.Album, error) {
+	title = strings.TrimSpace(title)
+	album, err := s.albums.Find(title, artistID)
+	if err == nil {
+		updates := map[string]interface{}{}
+		if album.Year == 0 && year != 0 {
+			updates["Year"], album.Year = year, year
+		}
+		if album.Genre == "" && genre != "" {
+			updates["Genre"], album.Genre = genre, genre
+		}
+		if album.Cover == "" && cover != "" {
+			updates["Cover"], album.Cover = cover, cover
+		}
+		if len(updates) > 0 {
+			if err := s.albums.Update(album.ID, updates); err != nil {
+				return nil, err
+			}
+		}
+		return album, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	album = &models.Album{Title: title, ArtistID: artistID, Year: year, Genre: genre, Cover: cover}
+	if err := s.albums.Create(album); err != nil {
+		if existing, ferr := s.albums.Find(title, artistID); ferr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return album, nil
+}
+
+// ResolveTrack 根据 info 的 Singer / AlbumArtist / Album 解析艺人署名并关联专辑，
+// 会填充 info.AlbumArtist 与 info.AlbumID，返回待写入的署名
+func (s *CatalogService) ResolveTrack(info *models.MusicInfo) ([]models.TrackArtist, error) {
+	mainNames, featuring := my_utils.SplitArtists(info.Singer)
+	var credits []models.TrackArtist
+	add := func(name, role string) error {
+		artist, err := s.ResolveArtist(name)
+		if err != nil {
+			return err
+		}
+		for _, c := range credits {
+			if c.ArtistID == artist.ID && c.Role == role {
+				return nil
+			}
+		}
+		credits = append(credits, models.TrackArtist{ArtistID: artist.ID, Role: role, Position: len(credits)})
+		return nil
+	}
+	for _, name := range mainNames {
+		if err := add(name, models.RoleMain); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range featuring {
+		if err := add(name, models.RoleFeaturing); err != nil {
+			return nil, err
+		}
+	}
+
+	if info.AlbumArtist == "" && len(mainNames) > 0 {
+		info.AlbumArtist = mainNames[0]
+	}
+	info.AlbumID = nil
+	if strings.TrimSpace(info.Album) == "" || info.AlbumArtist == "" {
+		return credits, nil
+	}
+	albumArtist, err := s.ResolveArtist(info.AlbumArtist)
+	if err != nil {
+		return nil, err
+	}
+	album, err := s.ResolveAlbum(info.Album, albumArtist.ID, info.Year, info.Genre, info.Cover)
+	if err != nil {
+		return nil, err
+	}
+	info.AlbumID = &album.ID
+	return credits, nil
+}
+
+// ListArtists 分页列出 viewer 可见的艺人
+func (s *CatalogService) ListArtists(viewer repositories.Viewer, offset, limit int) ([]models.Artist, int64, error) {
+	return s.artists.ForViewer(viewer).List(offset, limit)
+}
+
+type ArtistDetail struct {
+	models.Artist
+	Aliases []string           `json:"aliases"`
+	Albums  []models.Album     `json:"albums"`
+	Tracks  []models.MusicInfo `json:"tracks"`
+}
+
+// GetArtist 艺人详情，只包含 viewer 可见的专辑和曲目；艺人不可见时返回 gorm.ErrRecordNotFound
+func (s *CatalogService) GetArtist(viewer repositories.Viewer, id uint) (*ArtistDetail, error) {
+	artist, err := s.artists.ForViewer(viewer).GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	detail := &ArtistDetail{Artist: *artist}
+	if detail.Aliases, err = s.artists.Aliases(id); err != nil {
+		return nil, err
+	}
+	if detail.Albums, err = s.albums.ForViewer(viewer).ListByArtist(id); err != nil {
+		return nil, err
+	}
+	if detail.Tracks, err = s.musics.ForViewer(viewer).ListByArtist(id); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// ListAlbums 分页列出 viewer 可见的专辑
+func (s *CatalogService) ListAlbums(viewer repositories.Viewer, offset, limit int) ([]models.Album, int64, error) {
+	return s.albums.ForViewer(viewer).List(offset, limit)
+}
+
+type AlbumDetail struct {
+	models.Album
+	Artist models.Artist      `json:"artist"`
+	Tracks []models.MusicInfo `json:"tracks"`
+}
+
+// GetAlbum 专辑详情，只包含 viewer 可见的曲目；专辑不可见时返回 gorm.ErrRecordNotFound
+func (s *CatalogService) GetAlbum(viewer repositories.Viewer, id uint) (*AlbumDetail, error) {
+	album, err := s.albums.ForViewer(viewer).GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	detail := &AlbumDetail{Album: *album}
+	artist, err := s.artists.GetByID(album.ArtistID)
+	if err != nil {
+		return nil, err
+	}
+	detail.Artist = *artist
+	if detail.Tracks, err = s.musics.ForViewer(viewer).ListByAlbum(id); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// ArtistSummary 艺人及其可见的专辑数
+type ArtistSummary struct {
+	models.Artist
+	AlbumCount int64 `json:"album_count"`
+}
+
+// AlbumSummary 专辑及专辑艺人名称、可见曲目的数量和总时长
+type AlbumSummary struct {
+	models.Album
+	ArtistName string `json:"artist_name"`
+	Tracks     int64  `json:"tracks"`
+	Duration   int64  `json:"duration"` // 毫秒
+}
+
+// SearchPage 搜索结果中一类结果的分页，Limit 为 0 时不搜索这一类
+type SearchPage struct {
+	Offset int
+	Limit  int
+}
+
+// CatalogSearchResult 按艺人、专辑、曲目分别分页的搜索结果
+type CatalogSearchResult struct {
+	Artists []ArtistSummary
+	Albums  []AlbumSummary
+	Tracks  []models.MusicInfo
+}
+
+// AllArtists viewer 可见的全部艺人，供客户端建立索引
+func (s *CatalogService) AllArtists(viewer repositories.Viewer) ([]ArtistSummary, error) {
+	artists, _, err := s.artists.ForViewer(viewer).List(0, -1)
+	if err != nil {
+		return nil, err
+	}
+	return s.summarizeArtists(viewer, artists)
+}
+
+func (s *CatalogService) summarizeArtists(viewer repositories.Viewer, artists []models.Artist) ([]ArtistSummary, error) {
+	ids := make([]uint, 0, len(artists))
+	for _, a := range artists {
+		ids = append(ids, a.ID)
+	}
+	counts, err := s.albums.ForViewer(viewer).CountByArtists(ids)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]ArtistSummary, 0, len(artists))
+	for _, a := range artists {
+		summaries = append(summaries, ArtistSummary{Artist: a, AlbumCount: counts[a.ID]})
+	}
+	return summaries, nil
+}
+
+// SummarizeAlbums 补充专辑艺人名称和 viewer 可见曲目的数量、总时长
+func (s *CatalogService) SummarizeAlbums(viewer repositories.Viewer, albums []models.Album) ([]AlbumSummary, error) {
+	ids := make([]uint, 0, len(albums))
+	artistIDs := make([]uint, 0, len(albums))
+	for _, a := range albums {
+		ids = append(ids, a.ID)
+		artistIDs = append(artistIDs, a.ArtistID)
+	}
+	stats, err := s.musics.ForViewer(viewer).AlbumStats(ids)
+	if err != nil {
+		return nil, err
+	}
+	artists, err := s.artists.FindByIDs(uniqueIDs(artistIDs))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(artists))
+	for _, a := range artists {
+		names[a.ID] = a.Name
+	}
+	summaries := make([]AlbumSummary, 0, len(albums))
+	for _, a := range albums {
+		summaries = append(summaries, AlbumSummary{
+			Album:      a,
+			ArtistName: names[a.ArtistID],
+			Tracks:     stats[a.ID].Tracks,
+			Duration:   stats[a.ID].Duration,
+		})
+	}
+	return summaries, nil
+}
+
+// Search 按关键词分别搜索艺人、专辑和曲目，keyword 为空时分页列出全部
+func (s *CatalogService) Search(viewer repositories.Viewer, keyword string, artists, albums, tracks SearchPage) (*CatalogSearchResult, error) {
+	keyword = strings.TrimSpace(keyword)
+	result := &CatalogSearchResult{Artists: []ArtistSummary{}, Albums: []AlbumSummary{}, Tracks: []models.MusicInfo{}}
+	if artists.Limit > 0 {
+		list, err := s.artists.ForViewer(viewer).Search(keyword, artists.Offset, artists.Limit)
+		if err != nil {
+			return nil, err
+		}
+		if result.Artists, err = s.summarizeArtists(viewer, list); err != nil {
+			return nil, err
+		}
+	}
+	if albums.Limit > 0 {
+		list, err := s.albums.ForViewer(viewer).Search(keyword, albums.Offset, albums.Limit)
+		if err != nil {
+			return nil, err
+		}
+		if result.Albums, err = s.SummarizeAlbums(viewer, list); err != nil {
+			return nil, err
+		}
+	}
+	if tracks.Limit > 0 {
+		list, err := s.musics.ForViewer(viewer).Search(keyword, tracks.Offset, tracks.Limit)
+		if err != nil {
+			return nil, err
+		}
+		result.Tracks = list
+	}
+	return result, nil
+}
+
+// ErrArtistNameTaken 别名已登记在其他艺人名下，应改用合并
+var ErrArtistNameTaken = errors.New("该名称已属于其他艺人，请使用合并")
+
+// AddArtistAlias 为艺人登记别名，例如把 "Jay Chou" 登记为 "周杰伦" 的别名
+func (s *CatalogService) AddArtistAlias(artistID uint, alias string) error {
+	if strings.TrimSpace(alias) == "" {
+		return &FieldError{Field: "alias", Reason: "不能为空"}
+	}
+	if _, err := s.artists.GetByID(artistID); err != nil {
+		return err
+	}
+	existing, err := s.artists.FindByName(alias)
+	switch {
+	case err == nil && existing.ID == artistID:
+		return nil
+	case err == nil:
+		return ErrArtistNameTaken
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	return s.artists.AddAlias(artistID, alias)
+}
+
+// MergeArtists 把 from 合并到 into，from 的名称会成为 into 的别名
+func (s *CatalogService) MergeArtists(into, from uint) error {
+	if from == 0 {
+		return &FieldError{Field: "from", Reason: "不能为空"}
+	}
+	if into == from {
+		return &FieldError{Field: "from", Reason: "不能与目标艺人相同"}
+	}
+	if _, err := s.artists.GetByID(into); err != nil {
+		return err
+	}
+	if _, err := s.artists.GetByID(from); err != nil {
+		return err
+	}
+	return s.artists.Merge(into, from)
+}
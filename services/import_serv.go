@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 导入结果
+const (
+	ImportCreated     = "created"      // 新建了曲目
+	ImportDuplicate   = "duplicate"    // 内容与已有曲目相同，跳过
+	ImportFailed      = "failed"       // 出错，原因见 Error
+	ImportResumed     = "resumed"      // 日志显示上次已处理过，跳过
+	ImportWouldCreate = "would_create" // 预演：将会新建
+)
+
+// DefaultImportExtensions 未指定 include 时导入的文件扩展名
+var DefaultImportExtensions = []string{".mp3", ".flac", ".m4a", ".ogg", ".opus", ".wav"}
+
+// ImportOptions 批量导入选项
+type ImportOptions struct {
+	Sources     []string // 文件或目录
+	Include     []string // 文件名通配符；含 / 时匹配相对路径；为空时按 DefaultImportExtensions
+	Exclude     []string
+	Concurrency int
+	DryRun      bool   // 只识别曲目信息和判断是否重复，不上传、不写日志
+	JournalPath string // 导入日志路径，为空时不续传
+	Templates   []*PathTemplate
+	// Progress 每处理完一个文件调用一次，可能并发调用
+	Progress func(ImportEntry)
+}
+
+type ImportEntry struct {
+	Path        string     `json:"path"`
+	Status      string     `json:"status"`
+	MusicID     uint       `json:"music_id,omitempty"`
+	DuplicateOf uint       `json:"duplicate_of,omitempty"` // 重复时为已有曲目的 ID
+	Error       string     `json:"error,omitempty"`
+	Meta        *TrackMeta `json:"meta,omitempty"`
+}
+
+type ImportReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	DryRun     bool           `json:"dry_run"`
+	Summary    map[string]int `json:"summary"`
+	Entries    []ImportEntry  `json:"entries"`
+}
+
+// Text 生成给人看的摘要
+func (r *ImportReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "处理 %d 个文件，耗时 %s\n", len(r.Entries), r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+	for _, status := range []string{ImportCreated, ImportWouldCreate, ImportDuplicate, ImportResumed, ImportFailed} {
+		if n := r.Summary[status]; n > 0 {
+			fmt.Fprintf(&b, "  %-13s %d\n", status, n)
+		}
+	}
+	for _, e := range r.Entries {
+		if e.Status == ImportFailed {
+			fmt.Fprintf(&b, "  失败 %s: %s\n", e.Path, e.Error)
+		}
+	}
+	return b.String()
+}
+
+type ImportService struct {
+	music *MusicService
+}
+
+func NewImportService() *ImportService {
+	return &ImportService{
+		music: NewMusicService(),
+	}
+}
+
+// importFile 待导入的文件，root 为路径模板匹配的起点
+type importFile struct {
+	path    string
+	root    string
+	size    int64
+	modTime time.Time
+}
+
+// Import 遍历源路径并发导入，同一文件在日志中记为已完成时不再处理
+func (s *ImportService) Import(opts ImportOptions) (*ImportReport, error) {
+	report := &ImportReport{StartedAt: time.Now(), DryRun: opts.DryRun, Summary: map[string]int{}}
+	files, err := collectImportFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var journal *importJournal
+	if opts.JournalPath != "" && !opts.DryRun {
+		journal, err = openImportJournal(opts.JournalPath)
+		if err != nil {
+			return nil, fmt.Errorf("打开导入日志失败: %v", err)
+		}
+		defer journal.Close()
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan importFile)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				entry := s.importOne(f, journal, opts)
+				if journal != nil && entry.Status != ImportResumed {
+					if err := journal.Record(f, entry); err != nil {
+						entry.Error = strings.TrimSpace(entry.Error + " 写入导入日志失败: " + err.Error())
+					}
+				}
+				mu.Lock()
+				report.Entries = append(report.Entries, entry)
+				report.Summary[entry.Status]++
+				mu.Unlock()
+				if opts.Progress != nil {
+					opts.Progress(entry)
+				}
+			}
+		}()
+	}
+	for _, f := range files {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(report.Entries, func(i, j int) bool { return report.Entries[i].Path < report.Entries[j].Path })
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+func (s *ImportService) importOne(f importFile, journal *importJournal, opts ImportOptions) ImportEntry {
+	entry := ImportEntry{Path: f.path}
+	if journal != nil {
+		if prev, ok := journal.Done(f); ok {
+			entry.Status, entry.MusicID = ImportResumed, prev.MusicID
+			return entry
+		}
+	}
+	meta, err := ReadTrackMeta(f.path, f.root, opts.Templates)
+	if err != nil {
+		entry.Status, entry.Error = ImportFailed, "读取曲目信息失败: "+err.Error()
+		return entry
+	}
+	entry.Meta = meta
+	info := meta.MusicInfo()
+
+	if opts.DryRun {
+		dup, err := s.music.FindDuplicate(f.path)
+		switch {
+		case err != nil:
+			entry.Status, entry.Error = ImportFailed, err.Error()
+		case dup != nil:
+			entry.Status, entry.DuplicateOf = ImportDuplicate, dup.ExistingID
+		default:
+			entry.Status = ImportWouldCreate
+		}
+		return entry
+	}
+
+	err = s.music.CreateMusic(info, f.path)
+	var dup *DuplicateError
+	switch {
+	case errors.As(err, &dup):
+		entry.Status, entry.DuplicateOf = ImportDuplicate, dup.ExistingID
+	case err != nil:
+		entry.Status, entry.Error = ImportFailed, err.Error()
+	default:
+		entry.Status, entry.MusicID = ImportCreated, info.ID
+	}
+	return entry
+}
+
+// collectImportFiles 展开源路径并按 include / exclude 过滤
+func collectImportFiles(opts ImportOptions) ([]importFile, error) {
+	var files []importFile
+	seen := map[string]bool{}
+	for _, src := range opts.Sources {
+		src, err := filepath.Abs(src)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := os.Stat(src)
+		if err != nil {
+			return nil, fmt.Errorf("读取源路径失败: %v", err)
+		}
+		root := src
+		if !fi.IsDir() {
+			root = filepath.Dir(src)
+		}
+		err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || seen[path] {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if !wantImportFile(filepath.ToSlash(rel), opts) {
+				return nil
+			}
+			seen[path] = true
+			files = append(files, importFile{path: path, root: root, size: info.Size(), modTime: info.ModTime()})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("遍历目录出错: %v", err)
+		}
+	}
+	return files, nil
+}
+
+func wantImportFile(rel string, opts ImportOptions) bool {
+	if matchAnyGlob(opts.Exclude, rel) {
+		return false
+	}
+	if len(opts.Include) > 0 {
+		return matchAnyGlob(opts.Include, rel)
+	}
+	return isAudioFile(rel)
+}
+
+// isAudioFile 按扩展名判断是否为支持导入的音频文件
+func isAudioFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range DefaultImportExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyGlob 含 / 的模式匹配完整相对路径，否则匹配文件名或任意一级目录名
+func matchAnyGlob(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if strings.Contains(p, "/") {
+			if ok, _ := filepath.Match(p, rel); ok {
+				return true
+			}
+			continue
+		}
+		for _, part := range strings.Split(rel, "/") {
+			if ok, _ := filepath.Match(p, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// importJournal 追加写入的导入日志（每行一个 JSON），中断后重新运行时跳过已完成的文件
+type importJournal struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[string]journalEntry
+}
+
+type journalEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Status  string    `json:"status"`
+	MusicID uint      `json:"music_id,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+func openImportJournal(path string) (*importJournal, error) {
+	j := &importJournal{done: map[string]journalEntry{}}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e journalEntry
+			// 中途崩溃可能留下写了一半的最后一行，忽略即可
+			if json.Unmarshal(scanner.Bytes(), &e) != nil {
+				continue
+			}
+			j.done[e.Path] = e
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+	return j, nil
+}
+
+// Done 文件在日志中已成功导入或确认重复，且大小和修改时间没有变化
+func (j *importJournal) Done(f importFile) (journalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.done[f.path]
+	if !ok || (e.Status != ImportCreated && e.Status != ImportDuplicate) {
+		return e, false
+	}
+	return e, e.Size == f.size && e.ModTime.Equal(f.modTime)
+}
+
+func (j *importJournal) Record(f importFile, entry ImportEntry) error {
+	e := journalEntry{
+		Path:    f.path,
+		Size:    f.size,
+		ModTime: f.modTime,
+		Status:  entry.Status,
+		MusicID: entry.MusicID,
+		Error:   entry.Error,
+		At:      time.Now(),
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done[e.Path] = e
+	_, err = j.f.Write(append(data, '\n'))
+	return err
+}
+
+func (j *importJournal) Close() error {
+	return j.f.Close()
+}
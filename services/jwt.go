@@ -0,0 +1,79 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 令牌类型，防止把刷新令牌当作访问令牌使用
+const (
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+)
+
+var errInvalidJWT = errors.New("invalid token")
+
+// jwtClaims 签发的 JWT 载荷，只使用 HS256
+type jwtClaims struct {
+	Subject   uint   `json:"sub"`
+	Type      string `json:"typ"`
+	Scope     string `json:"scope,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func signJWT(secret []byte, claims jwtClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + jwtSignature(secret, unsigned), nil
+}
+
+// parseJWT 校验签名、算法和有效期
+func parseJWT(secret []byte, token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(jwtSignature(secret, parts[0]+"."+parts[1]))) {
+		return nil, errInvalidJWT
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, errInvalidJWT
+	}
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errInvalidJWT
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+	return &claims, nil
+}
+
+func jwtSignature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"Music/models"
+	"Music/repositories"
+	"time"
+)
+
+const maxPlayClient = 128
+
+// TrackFeedback 当前用户对曲目的收藏状态和评分，未评分时 Rating 为 0
+type TrackFeedback struct {
+	Liked  bool `json:"liked"`
+	Rating int  `json:"rating"`
+}
+
+type FavoriteTrack struct {
+	Track   *models.MusicInfo `json:"track"`
+	LikedAt time.Time         `json:"liked_at"`
+	TrackFeedback
+}
+
+type PlayedTrack struct {
+	ID       uint              `json:"id"`
+	Track    *models.MusicInfo `json:"track"`
+	PlayedAt time.Time         `json:"played_at"`
+	Client   string            `json:"client"`
+	Partial  bool              `json:"partial"`
+	TrackFeedback
+}
+
+type TopTrack struct {
+	Track        *models.MusicInfo `json:"track"`
+	Plays        int64             `json:"plays"`
+	LastPlayedAt time.Time         `json:"last_played_at"`
+	TrackFeedback
+}
+
+type LibraryService struct {
+	repo      *repositories.LibraryRepository
+	musics    *repositories.MusicRepository
+	scrobbles *ScrobbleService
+}
+
+func NewLibraryService() *LibraryService {
+	return &LibraryService{
+		repo:      &repositories.LibraryRepository{},
+		musics:    &repositories.MusicRepository{},
+		scrobbles: NewScrobbleService(),
+	}
+}
+
+// ParseRating 校验评分，须为 1 到 5
+func ParseRating(stars int) error {
+	if stars < 1 || stars > 5 {
+		return &FieldError{Field: "rating", Reason: "须为 1 到 5 的整数"}
+	}
+	return nil
+}
+
+// RecordPlay 记录一次播放请求，从头开始的播放同时交给 scrobble 队列；client 为客户端名称，过长时截断
+func (s *LibraryService) RecordPlay(userID uint, music *models.MusicInfo, client string, partial bool) error {
+	e := &models.PlayEvent{
+		UserID:   userID,
+		MusicID:  music.ID,
+		PlayedAt: time.Now(),
+		Client:   truncateRunes(client, maxPlayClient),
+		Partial:  partial,
+	}
+	if err := s.repo.RecordPlay(e); err != nil {
+		return err
+	}
+	if partial {
+		return nil
+	}
+	return s.scrobbles.OnPlay(e, music)
+}
+
+// Scrobble 记录客户端播放完成后上报的收听（如 Subsonic 的 scrobble），playedAt 为开始播放的时间
+func (s *LibraryService) Scrobble(userID uint, music *models.MusicInfo, client string, playedAt time.Time) error {
+	e := &models.PlayEvent{
+		UserID:   userID,
+		MusicID:  music.ID,
+		PlayedAt: playedAt,
+		Client:   truncateRunes(client, maxPlayClient),
+	}
+	if err := s.repo.RecordPlay(e); err != nil {
+		return err
+	}
+	return s.scrobbles.OnListen(e, music)
+}
+
+// NowPlaying 客户端上报正在播放，只转发给关联的 scrobble 服务，不记录播放
+func (s *LibraryService) NowPlaying(userID uint, music *models.MusicInfo) error {
+	return s.scrobbles.NowPlaying(userID, music)
+}
+
+// TrackAnnotations 用户对一组曲目的收藏时间和评分，不检查曲目是否可见
+func (s *LibraryService) TrackAnnotations(userID uint, ids []uint) (map[uint]time.Time, map[uint]int, error) {
+	return s.repo.Feedback(userID, uniqueIDs(ids))
+}
+
+// Feedback 当前用户对曲目的收藏状态和评分，曲目不可见时返回 gorm.ErrRecordNotFound
+func (s *LibraryService) Feedback(viewer repositories.Viewer, id uint) (*TrackFeedback, error) {
+	if _, err := s.musics.ForViewer(viewer).GetByID(id); err != nil {
+		return nil, err
+	}
+	return s.feedback(viewer.UserID, id)
+}
+
+func (s *LibraryService) feedback(userID, id uint) (*TrackFeedback, error) {
+	liked, ratings, err := s.repo.Feedback(userID, []uint{id})
+	if err != nil {
+		return nil, err
+	}
+	_, ok := liked[id]
+	return &TrackFeedback{Liked: ok, Rating: ratings[id]}, nil
+}
+
+// Like 收藏曲目，重复收藏不报错
+func (s *LibraryService) Like(viewer repositories.Viewer, id uint) (*TrackFeedback, error) {
+	if _, err := s.musics.ForViewer(viewer).GetByID(id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.AddFavorite(viewer.UserID, id); err != nil {
+		return nil, err
+	}
+	return s.feedback(viewer.UserID, id)
+}
+
+// Unlike 取消收藏；曲目已不可见时也允许取消
+func (s *LibraryService) Unlike(viewer repositories.Viewer, id uint) (*TrackFeedback, error) {
+	if err := s.repo.RemoveFavorite(viewer.UserID, id); err != nil {
+		return nil, err
+	}
+	return s.feedback(viewer.UserID, id)
+}
+
+// Rate 给曲目评分，覆盖之前的评分
+func (s *LibraryService) Rate(viewer repositories.Viewer, id uint, stars int) (*TrackFeedback, error) {
+	if err := ParseRating(stars); err != nil {
+		return nil, err
+	}
+	if _, err := s.musics.ForViewer(viewer).GetByID(id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetRating(viewer.UserID, id, stars); err != nil {
+		return nil, err
+	}
+	return s.feedback(viewer.UserID, id)
+}
+
+// Unrate 清除评分；曲目已不可见时也允许清除
+func (s *LibraryService) Unrate(viewer repositories.Viewer, id uint) (*TrackFeedback, error) {
+	if err := s.repo.RemoveRating(viewer.UserID, id); err != nil {
+		return nil, err
+	}
+	return s.feedback(viewer.UserID, id)
+}
+
+// Favorites 收藏的曲目，最近收藏的在前
+func (s *LibraryService) Favorites(viewer repositories.Viewer, offset, limit int) ([]FavoriteTrack, int64, error) {
+	favorites, total, err := s.repo.ForViewer(viewer).Favorites(viewer.UserID, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]uint, 0, len(favorites))
+	for _, f := range favorites {
+		ids = append(ids, f.MusicID)
+	}
+	tracks, feedback, err := s.tracks(viewer, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]FavoriteTrack, 0, len(favorites))
+	for _, f := range favorites {
+		if t := tracks[f.MusicID]; t != nil {
+			items = append(items, FavoriteTrack{Track: t, LikedAt: f.CreatedAt, TrackFeedback: feedback(f.MusicID)})
+		}
+	}
+	return items, total, nil
+}
+
+// RecentPlays 最近的播放记录，includePartial 为 false 时不含拖动进度等 Range 请求
+func (s *LibraryService) RecentPlays(viewer repositories.Viewer, includePartial bool, offset, limit int) ([]PlayedTrack, int64, error) {
+	plays, total, err := s.repo.ForViewer(viewer).RecentPlays(viewer.UserID, includePartial, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]uint, 0, len(plays))
+	for _, p := range plays {
+		ids = append(ids, p.MusicID)
+	}
+	tracks, feedback, err := s.tracks(viewer, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]PlayedTrack, 0, len(plays))
+	for _, p := range plays {
+		if t := tracks[p.MusicID]; t != nil {
+			items = append(items, PlayedTrack{ID: p.ID, Track: t, PlayedAt: p.PlayedAt, Client: p.Client,
+				Partial: p.Partial, TrackFeedback: feedback(p.MusicID)})
+		}
+	}
+	return items, total, nil
+}
+
+// MostPlayed 播放次数最多的曲目；days 大于 0 时只统计最近 days 天
+func (s *LibraryService) MostPlayed(viewer repositories.Viewer, days, offset, limit int) ([]TopTrack, int64, error) {
+	var since time.Time
+	if days > 0 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	counts, total, err := s.repo.ForViewer(viewer).MostPlayed(viewer.UserID, since, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]uint, 0, len(counts))
+	lastIDs := make([]uint, 0, len(counts))
+	for _, c := range counts {
+		ids = append(ids, c.MusicID)
+		lastIDs = append(lastIDs, c.LastPlayID)
+	}
+	tracks, feedback, err := s.tracks(viewer, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	last, err := s.repo.PlaysByIDs(lastIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	playedAt := make(map[uint]time.Time, len(last))
+	for _, p := range last {
+		playedAt[p.ID] = p.PlayedAt
+	}
+	items := make([]TopTrack, 0, len(counts))
+	for _, c := range counts {
+		if t := tracks[c.MusicID]; t != nil {
+			items = append(items, TopTrack{Track: t, Plays: c.Plays, LastPlayedAt: playedAt[c.LastPlayID],
+				TrackFeedback: feedback(c.MusicID)})
+		}
+	}
+	return items, total, nil
+}
+
+// tracks 批量读取曲目及当前用户的收藏和评分
+func (s *LibraryService) tracks(viewer repositories.Viewer, ids []uint) (map[uint]*models.MusicInfo, func(uint) TrackFeedback, error) {
+	ids = uniqueIDs(ids)
+	list, err := s.musics.ForViewer(viewer).FindByIDs(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracks := make(map[uint]*models.MusicInfo, len(list))
+	for i := range list {
+		tracks[list[i].ID] = &list[i]
+	}
+	liked, ratings, err := s.repo.Feedback(viewer.UserID, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	feedback := func(id uint) TrackFeedback {
+		_, ok := liked[id]
+		return TrackFeedback{Liked: ok, Rating: ratings[id]}
+	}
+	return tracks, feedback, nil
+}
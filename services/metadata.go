@@ -0,0 +1,246 @@
+package services
+
+import (
+	"Music/models"
+	"fmt"
+	"github.com/dhowden/tag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 字段来源
+const (
+	SourceTag      = "tag"      // 文件内的 ID3 / Vorbis / MP4 标签
+	SourcePath     = "path"     // 路径模板
+	SourceFilename = "filename" // 标签和模板都没有时，标题取文件名
+	SourceOverride = "override" // 上传时指定
+)
+
+// DefaultPathTemplates 未配置 import.templates 时使用的路径模板
+var DefaultPathTemplates = []string{
+	"{artist}/{album}/{disc}-{track} - {title}",
+	"{artist}/{album}/{track} - {title}",
+	"{album}/{artist} - {title}",
+	"{artist} - {title}",
+}
+
+// TrackMeta 导入时识别出的曲目信息，Sources 记录每个字段的来源
+type TrackMeta struct {
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Track       int    `json:"track,omitempty"`
+	Disc        int    `json:"disc,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+
+	Sources map[string]string `json:"sources"`
+}
+
+// MusicInfo 转换为待入库的记录
+func (m *TrackMeta) MusicInfo() *models.MusicInfo {
+	return &models.MusicInfo{
+		Name:        m.Title,
+		Singer:      m.Artist,
+		AlbumArtist: m.AlbumArtist,
+		Album:       m.Album,
+		TrackNumber: m.Track,
+		DiscNumber:  m.Disc,
+		Year:        m.Year,
+		Genre:       m.Genre,
+	}
+}
+
+// SourceSummary 按字段名排序的来源说明，如 "album=path artist=tag title=tag"
+func (m *TrackMeta) SourceSummary() string {
+	fields := make([]string, 0, len(m.Sources))
+	for field, source := range m.Sources {
+		fields = append(fields, field+"="+source)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// set 只填写尚未识别的字段
+func (m *TrackMeta) set(field, value, source string) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" || m.Sources[field] != "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	switch field {
+	case "title":
+		m.Title = value
+	case "artist":
+		m.Artist = value
+	case "albumartist":
+		m.AlbumArtist = value
+	case "album":
+		m.Album = value
+	case "genre":
+		m.Genre = value
+	case "track", "disc", "year":
+		if err != nil || n <= 0 {
+			return
+		}
+		switch field {
+		case "track":
+			m.Track = n
+		case "disc":
+			m.Disc = n
+		case "year":
+			m.Year = n
+		}
+	default:
+		return
+	}
+	m.Sources[field] = source
+}
+
+// Override 用 value 覆盖字段，不论之前来自哪里
+func (m *TrackMeta) Override(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	prevSource := m.Sources[field]
+	delete(m.Sources, field)
+	m.set(field, value, SourceOverride)
+	if m.Sources[field] == "" && prevSource != "" {
+		// 值不合法（如非数字的音轨号）时保留原值
+		m.Sources[field] = prevSource
+	}
+}
+
+// PathTemplate 形如 {artist}/{album}/{track} - {title} 的路径模板
+type PathTemplate struct {
+	raw    string
+	re     *regexp.Regexp
+	fields []string
+}
+
+var placeholderRe = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// 数字字段只匹配数字，避免 "01 - 晴天" 被当成艺人
+var templateFields = map[string]string{
+	"artist":      `[^/]+?`,
+	"albumartist": `[^/]+?`,
+	"album":       `[^/]+?`,
+	"title":       `[^/]+?`,
+	"genre":       `[^/]+?`,
+	"track":       `\d+`,
+	"disc":        `\d+`,
+	"year":        `\d{4}`,
+}
+
+// CompilePathTemplate 解析路径模板，模板匹配相对路径的末尾若干级
+func CompilePathTemplate(s string) (*PathTemplate, error) {
+	t := &PathTemplate{raw: s}
+	var b strings.Builder
+	b.WriteString(`(?:^|/)`)
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringSubmatchIndex(s, -1) {
+		name := s[loc[2]:loc[3]]
+		pattern, ok := templateFields[name]
+		if !ok {
+			return nil, fmt.Errorf("路径模板 %q 中有未知的占位符 {%s}", s, name)
+		}
+		b.WriteString(regexp.QuoteMeta(s[last:loc[0]]))
+		b.WriteString("(" + pattern + ")")
+		t.fields = append(t.fields, name)
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(s[last:]))
+	b.WriteString("$")
+	if len(t.fields) == 0 {
+		return nil, fmt.Errorf("路径模板 %q 中没有占位符", s)
+	}
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+	t.re = re
+	return t, nil
+}
+
+// CompilePathTemplates 依次解析多个模板，为空时使用 DefaultPathTemplates
+func CompilePathTemplates(templates []string) ([]*PathTemplate, error) {
+	if len(templates) == 0 {
+		templates = DefaultPathTemplates
+	}
+	var compiled []*PathTemplate
+	for _, s := range templates {
+		t, err := CompilePathTemplate(s)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, t)
+	}
+	return compiled, nil
+}
+
+func (t *PathTemplate) String() string {
+	return t.raw
+}
+
+// Match 匹配不含扩展名、以 / 分隔的相对路径，返回占位符的值
+func (t *PathTemplate) Match(rel string) (map[string]string, bool) {
+	m := t.re.FindStringSubmatch(rel)
+	if m == nil {
+		return nil, false
+	}
+	values := make(map[string]string, len(t.fields))
+	for i, name := range t.fields {
+		values[name] = m[i+1]
+	}
+	return values, true
+}
+
+// ReadTrackMeta 先读取文件标签，缺失的字段再按路径模板从相对于 root 的路径中补全，
+// 仍没有标题时使用文件名
+func ReadTrackMeta(path, root string, templates []*PathTemplate) (*TrackMeta, error) {
+	meta := &TrackMeta{Sources: map[string]string{}}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// 没有标签或标签损坏时仍然可以按路径导入
+	tags, err := tag.ReadFrom(f)
+	f.Close()
+	if err == nil {
+		track, _ := tags.Track()
+		disc, _ := tags.Disc()
+		meta.set("title", tags.Title(), SourceTag)
+		meta.set("artist", tags.Artist(), SourceTag)
+		meta.set("albumartist", tags.AlbumArtist(), SourceTag)
+		meta.set("album", tags.Album(), SourceTag)
+		meta.set("track", strconv.Itoa(track), SourceTag)
+		meta.set("disc", strconv.Itoa(disc), SourceTag)
+		meta.set("year", strconv.Itoa(tags.Year()), SourceTag)
+		meta.set("genre", tags.Genre(), SourceTag)
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	rel = filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+	for _, t := range templates {
+		values, ok := t.Match(rel)
+		if !ok {
+			continue
+		}
+		for field, value := range values {
+			meta.set(field, value, SourcePath)
+		}
+		break
+	}
+
+	meta.set("title", filepath.Base(rel), SourceFilename)
+	return meta, nil
+}
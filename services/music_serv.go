@@ -1,57 +1,279 @@
 package services
 
 import (
+	"Music/audio_info"
+	"Music/config"
 	"Music/models"
+	"Music/my_utils"
 	"Music/repositories"
-	"Music/tengcent_cos"
+	"Music/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 type MusicService struct {
-	repo *repositories.MusicRepository
+	repo    *repositories.MusicRepository
+	catalog *CatalogService
+	artwork *ArtworkService
+	tags    *TagService
 }
 
 // 创建一个新的 MusicService 实例
 func NewMusicService() *MusicService {
 	return &MusicService{
-		repo: &repositories.MusicRepository{},
+		repo:    &repositories.MusicRepository{},
+		catalog: NewCatalogService(),
+		artwork: NewArtworkService(),
+		tags:    NewTagService(),
 	}
 }
 
-// 创建音乐记录（带去重判断）
-func (s *MusicService) CreateMusic(info *models.MusicInfo, filepath string) error {
-	// 检查是否已存在同名歌曲（可选逻辑）
-	exists, err := s.repo.ExistsByFields(info.Name, info.Album, info.Singer)
+// ErrMusicExists 曲目已存在，导入时计为跳过而不是失败；具体重复的曲目见 DuplicateError
+var ErrMusicExists = errors.New("音乐记录已存在")
+
+// DuplicateError 文件内容与已有曲目相同
+type DuplicateError struct {
+	ExistingID uint
+	By         string // sha256：文件完全相同；audio_hash：仅标签不同
+}
+
+func (e *DuplicateError) Error() string {
+	if e.By == "audio_hash" {
+		return fmt.Sprintf("与曲目 %d 的音频相同（仅标签不同）", e.ExistingID)
+	}
+	return fmt.Sprintf("与曲目 %d 重复", e.ExistingID)
+}
+
+// Is 使 errors.Is(err, ErrMusicExists) 成立
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrMusicExists
+}
+
+// 暂存对象的 key 前缀，入库成功或失败后都会被删除；残留的暂存对象说明导入过程中途崩溃
+const StagingPrefix = "staging/"
+
+// AudioPrefix 音频对象的 key 前缀，key 为 audio/<sha256><扩展名>，相同内容只存一份
+const AudioPrefix = "audio/"
+
+// AudioObjectKey 由文件内容哈希决定的对象 key
+func AudioObjectKey(sha256, filePath string) string {
+	return AudioPrefix + sha256 + strings.ToLower(filepath.Ext(filePath))
+}
+
+// 同一内容的文件串行入库，避免并发导入时重复创建；按哈希前缀分段加锁，
+// 锁的数量固定，不同内容偶尔落在同一段只会多等一会
+var ingestLocks [256]sync.Mutex
+
+func lockContent(sha256 string) func() {
+	var stripe uint64
+	if len(sha256) >= 2 {
+		stripe, _ = strconv.ParseUint(sha256[:2], 16, 8)
+	}
+	mu := &ingestLocks[stripe]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// 创建音乐记录（按内容哈希去重）
+//
+// 先把文件上传到暂存 key 并复制到正式 key，再在数据库事务中解析艺人、专辑并写入记录；
+// 任一步失败都会回滚记录、删除已写入的对象并释放新提取的封面，不会留下 Location 为空的记录。
+// 文件或去掉标签后的音频与已有曲目相同时返回 *DuplicateError
+func (s *MusicService) CreateMusic(info *models.MusicInfo, filePath string) (err error) {
+	sum, audioHash, err := contentHashes(filePath)
 	if err != nil {
 		return err
 	}
-	if exists {
-		return errors.New("音乐记录已存在")
+	unlock := lockContent(sum)
+	defer unlock()
+	if err := s.checkDuplicate(s.duplicateScope(info.OwnerID), sum, audioHash); err != nil {
+		return err
+	}
+	info.AudioHash = audioHash
+	if info.Visibility == "" {
+		info.Visibility = models.VisibilityShared
+	}
+	ctx := context.Background()
+
+	// 解析时长、码率等技术参数，无法识别的格式只记录警告
+	if a, err := audio_info.ParseFile(filePath); err != nil {
+		my_utils.Warn("解析音频参数失败 %s: %v", filePath, err)
+	} else {
+		applyAudioInfo(info, a)
+	}
+
+	// 提取封面；封面按内容去重、可被多条曲目共享，入库失败时只在没有其他引用时删除
+	var extractedCover, finalKey string
+	if info.Cover == "" {
+		cover, err := s.artwork.SaveFor(ctx, filePath)
+		if err != nil {
+			my_utils.Warn("提取封面失败 %s: %v", filePath, err)
+		}
+		info.Cover, extractedCover = cover, cover
 	}
-	// 存储到数据库
-	id, err := s.repo.Create(info)
+	defer func() {
+		if err == nil {
+			return
+		}
+		// 补偿：事务已回滚，删除已经复制到正式 key 的对象；其他用户的同内容曲目仍在引用时保留
+		if finalKey != "" {
+			if refs, cerr := s.repo.CountByObjectKey(finalKey); cerr == nil && refs == 0 {
+				if derr := storage.Store.Delete(ctx, finalKey); derr != nil {
+					my_utils.Error("回滚时删除对象 %s 失败: %v", finalKey, derr)
+				}
+			}
+		}
+		if extractedCover != "" {
+			s.release(ctx, nil, map[string]bool{extractedCover: true})
+		}
+		info.ID, info.Location, info.AlbumID = 0, "", nil
+	}()
+
+	// 上传到暂存 key
+	stagingKey, err := newStagingKey()
 	if err != nil {
 		return err
 	}
-	// 存储文件内容到云存储，得到url
-	client, err := tengcent_cos.InitClient()
+	info.Size, info.SHA256, _, err = uploadFile(ctx, stagingKey, filePath)
 	if err != nil {
-		return errors.New("New tengcent client error")
+		return fmt.Errorf("上传音频失败: %v", err)
 	}
-	location := client.Upload(strconv.Itoa(int(info.ID)), filepath)
-	fmt.Println(location)
-	info.Location = location
-	// 跟新数据库
-	updates := map[string]interface{}{
-		"Location": location,
+	defer func() {
+		if err := storage.Store.Delete(ctx, stagingKey); err != nil {
+			my_utils.Warn("删除暂存对象 %s 失败: %v", stagingKey, err)
+		}
+	}()
+	if info.SHA256 != sum {
+		return errors.New("文件在导入过程中被修改")
+	}
+
+	// 暂存对象转正；复制可能较慢，放在事务之外
+	info.ObjectKey = AudioObjectKey(sum, filePath)
+	finalKey = info.ObjectKey
+	if info.Location, err = storage.Store.Copy(ctx, stagingKey, finalKey); err != nil {
+		return fmt.Errorf("保存音频失败: %v", err)
+	}
+
+	// 在同一事务中解析艺人和专辑并写入记录
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		credits, err := s.catalog.WithTx(tx).ResolveTrack(info)
+		if err != nil {
+			return fmt.Errorf("解析艺人和专辑失败: %v", err)
+		}
+		repo := s.repo.WithTx(tx)
+		id, err := repo.Create(info)
+		if err != nil {
+			return err
+		}
+		return repo.SetCredits(id, credits)
+	})
+}
+
+// FindDuplicate 判断文件是否与已有曲目重复，供导入预演使用；不重复时返回 nil
+func (s *MusicService) FindDuplicate(filePath string) (*DuplicateError, error) {
+	sum, audioHash, err := contentHashes(filePath)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkDuplicate(s.repo, sum, audioHash)
+	var dup *DuplicateError
+	if errors.As(err, &dup) {
+		return dup, nil
+	}
+	return nil, err
+}
+
+// duplicateScope 上传的曲目只与所有者可见的曲目比较，其他用户的私有曲目不算重复，也不会在错误中暴露其 ID；
+// 相同内容的音频对象 key 相同，新记录与已有曲目共用一个对象。没有所有者时（命令行导入）与全部曲目比较
+func (s *MusicService) duplicateScope(ownerID *uint) *repositories.MusicRepository {
+	if ownerID == nil {
+		return s.repo
+	}
+	return s.repo.ForViewer(repositories.Viewer{UserID: *ownerID})
+}
+
+func (s *MusicService) checkDuplicate(repo *repositories.MusicRepository, sum, audioHash string) error {
+	existing, err := repo.FindByHash(sum, audioHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
 	}
-	err = s.repo.Update(id, updates)
 	if err != nil {
 		return err
 	}
-	return nil
+	by := "sha256"
+	if existing.SHA256 != sum {
+		by = "audio_hash"
+	}
+	return &DuplicateError{ExistingID: existing.ID, By: by}
+}
+
+// contentHashes 计算文件的 SHA-256 和去掉标签后的音频哈希（不支持的格式为空）
+func contentHashes(filePath string) (string, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	sum, err := hashReader(f)
+	f.Close()
+	if err != nil {
+		return "", "", err
+	}
+	audioHash, err := audio_info.AudioHash(filePath)
+	if err != nil {
+		audioHash = ""
+	}
+	return sum, audioHash, nil
+}
+
+// applyAudioInfo 把解析出的技术参数写入记录
+func applyAudioInfo(info *models.MusicInfo, a *audio_info.Info) {
+	info.Codec = a.Codec
+	info.Bitrate = a.Bitrate
+	info.SampleRate = a.SampleRate
+	info.Channels = a.Channels
+	info.BitDepth = a.BitDepth
+	if a.Duration > 0 {
+		info.Duration = a.Duration.Milliseconds()
+	}
+}
+
+// newStagingKey 生成随机的暂存 key
+func newStagingKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return StagingPrefix + hex.EncodeToString(b), nil
+}
+
+// 把本地文件上传到存储后端，同时计算文件大小和 SHA-256
+func uploadFile(ctx context.Context, key string, filePath string) (int64, string, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, "", "", err
+	}
+	h := sha256.New()
+	location, err := storage.Store.Put(ctx, key, io.TeeReader(f, h), fi.Size(), storage.ContentType(filePath))
+	if err != nil {
+		return 0, "", "", err
+	}
+	return fi.Size(), hex.EncodeToString(h.Sum(nil)), location, nil
 }
 
 // 根据 ID 获取音乐记录
@@ -59,14 +281,49 @@ func (s *MusicService) GetMusic(id uint) (*models.MusicInfo, error) {
 	return s.repo.GetByID(id)
 }
 
-// 更新音乐信息
-func (s *MusicService) UpdateMusic(id uint, updates map[string]interface{}) error {
-	return s.repo.Update(id, updates)
-}
-
-// 删除音乐记录
+// 删除音乐记录；没有其他曲目引用同一存储对象时一并删除对象，
+// 专辑因此变空时删除专辑，封面不再被引用时删除封面
 func (s *MusicService) DeleteMusic(id uint) error {
-	return s.repo.Delete(id)
+	music, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.repo.WithTx(tx)
+		if err := repo.SetCredits(id, nil); err != nil {
+			return err
+		}
+		if err := (&repositories.PlaylistRepository{}).WithTx(tx).RemoveMusic(id); err != nil {
+			return err
+		}
+		if err := (&repositories.LibraryRepository{}).WithTx(tx).RemoveMusic(id); err != nil {
+			return err
+		}
+		return repo.Delete(id)
+	})
+	if err != nil {
+		return err
+	}
+	key := music.StorageKey()
+	refs, err := s.repo.CountByObjectKey(key)
+	if err != nil {
+		return err
+	}
+	if refs == 0 {
+		if err := storage.Store.Delete(context.Background(), key); err != nil {
+			// 记录已删除，残留的对象可由 verify -delete-orphans 清理
+			my_utils.Warn("删除对象 %s 失败: %v", key, err)
+		}
+	}
+	albums, covers := map[uint]bool{}, map[string]bool{}
+	if music.AlbumID != nil {
+		albums[*music.AlbumID] = true
+	}
+	if music.Cover != "" {
+		covers[music.Cover] = true
+	}
+	s.release(context.Background(), albums, covers)
+	return nil
 }
 
 // 搜索结果结构体（前端需要的结构）
@@ -78,44 +335,63 @@ func (s *MusicService) DeleteMusic(id uint) error {
 //	}
 type SearchResult struct {
 	ID       string `json:"id"`
-	Name     string `json:"name"`  // 临时存储Location, 也就是腾讯云对象存储的路径
+	Name     string `json:"name"`  // 歌曲名，不再返回存储路径
 	Title    string `json:"title"` // title 是歌曲名，前端忘记怎么写的了
 	Platform string `json:"platform"`
 	Artist   string `json:"artist"`
 	Album    string `json:"album"`
 	Artwork  string `json:"artwork"`
 	URL      string `json:"url"`
+
+	Duration   int64  `json:"duration,omitempty"` // 毫秒
+	Bitrate    int    `json:"bitrate,omitempty"`  // kbps
+	SampleRate int    `json:"sampleRate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	Codec      string `json:"codec,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Hash       string `json:"hash,omitempty"` // SHA-256
 }
 
-func (s *MusicService) SearchMusic(keyword string) ([]SearchResult, error) {
+// SearchMusic 在 viewer 可见的曲目中模糊搜索
+func (s *MusicService) SearchMusic(viewer repositories.Viewer, keyword string) ([]SearchResult, error) {
 	// 模糊查询
-	musics, err := s.repo.SearchByKeyword(keyword)
+	musics, err := s.repo.ForViewer(viewer).SearchByKeyword(keyword)
 	if err != nil {
 		return nil, err
 	}
 	// 转换为 SearchResult 结构
 	var results []SearchResult
-	//client, err := tengcent_cos.InitClient()
 	for _, m := range musics {
-		//url, err := client.GetPresignedURL(strconv.Itoa(int(m.ID)), 1000*time.Minute)
-		if err != nil {
-			return nil, err
-		}
+		id := strconv.Itoa(int(m.ID))
 		results = append(results, SearchResult{
-			ID:       strconv.Itoa(int(m.ID)),
-			Name:     m.Location,
+			ID:       id,
+			Name:     m.Name,
 			Title:    m.Name,
 			Platform: "shenzaoyi",
 			Artist:   m.Singer,
 			Album:    m.Album,
-			Artwork:  m.Cover,
-			URL:      m.Location,
-			//URL:      config.PLAYBASEURL + strconv.Itoa(int(m.ID)),
-			//URL: url,
+			Artwork:  ArtworkURL(m.Cover),
+			// 通过播放接口读取，不暴露存储地址，私有曲目也要经过权限检查
+			URL: config.BaseURL() + "/music/v1/play?id=" + id,
+
+			Duration:   m.Duration,
+			Bitrate:    m.Bitrate,
+			SampleRate: m.SampleRate,
+			Channels:   m.Channels,
+			Codec:      m.Codec,
+			Size:       m.Size,
+			Hash:       m.SHA256,
 		})
 	}
 	return results, nil
 }
-func (s *MusicService) GetByID(id uint) (*models.MusicInfo, error) {
-	return s.repo.GetByID(id)
+
+// GetByID 读取 viewer 可见的曲目，不可见时返回 gorm.ErrRecordNotFound
+func (s *MusicService) GetByID(viewer repositories.Viewer, id uint) (*models.MusicInfo, error) {
+	return s.repo.ForViewer(viewer).GetByID(id)
+}
+
+// GetVisibleTrack 读取 viewer 可见的曲目及艺人署名，不可见时返回 gorm.ErrRecordNotFound
+func (s *MusicService) GetVisibleTrack(viewer repositories.Viewer, id uint) (*models.MusicInfo, error) {
+	return s.repo.ForViewer(viewer).GetWithCredits(id)
 }
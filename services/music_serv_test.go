@@ -0,0 +1,174 @@
+package services
+
+import (
+	"Music/models"
+	"Music/storage"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingCopyStorage Copy 可以按需失败的存储
+type failingCopyStorage struct {
+	storage.Storage
+	failCopy atomic.Bool
+}
+
+func (s *failingCopyStorage) Copy(ctx context.Context, srcKey, dstKey string) (string, error) {
+	if s.failCopy.Load() {
+		return "", errors.New("storage unavailable")
+	}
+	return s.Storage.Copy(ctx, srcKey, dstKey)
+}
+
+// writeTestWAV 在 dir 中写入一秒的 16 位单声道 WAV，内容随 seed 变化
+func writeTestWAV(t *testing.T, dir, name string, seed byte) string {
+	t.Helper()
+	const rate = 8000
+	samples := make([]byte, rate*2)
+	for i := range samples {
+		samples[i] = byte(i*7) + seed
+	}
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(samples)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []any{uint32(16), uint16(1), uint16(1), uint32(rate), uint32(rate * 2), uint16(2), uint16(16)})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(samples)))
+	buf.Write(samples)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// countRows 表中的记录数
+func countRows(t *testing.T, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := models.DB.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCreateMusicRollsBackFailedIngest(t *testing.T) {
+	useTestDB(t)
+	store := &failingCopyStorage{Storage: useTestStorage(t)}
+	storage.Store = store
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cover.png"), smallPNG(t, 8, 8), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestWAV(t, dir, "a.wav", 0)
+	s := NewMusicService()
+	newInfo := func() *models.MusicInfo {
+		return &models.MusicInfo{Name: "十年", Singer: "陈奕迅 feat. 王菲", Album: "黑白灰"}
+	}
+	assertClean := func(stage string) {
+		t.Helper()
+		for _, model := range []interface{}{&models.MusicInfo{}, &models.Artist{}, &models.ArtistAlias{}, &models.Album{}} {
+			if n := countRows(t, model); n != 0 {
+				t.Errorf("%s: %T 留下了 %d 条记录", stage, model, n)
+			}
+		}
+		if objects, err := store.List(ctx, ""); err != nil || len(objects) != 0 {
+			t.Errorf("%s: 存储中留下了对象 %v, %v", stage, objects, err)
+		}
+	}
+
+	store.failCopy.Store(true)
+	info := newInfo()
+	if err := s.CreateMusic(info, path); err == nil {
+		t.Fatal("复制失败时 CreateMusic 应返回错误")
+	}
+	if info.ID != 0 || info.Location != "" || info.AlbumID != nil {
+		t.Errorf("失败后 info = %+v", info)
+	}
+	assertClean("复制失败")
+	store.failCopy.Store(false)
+
+	// 写入记录失败：事务回滚，新建的艺人和专辑一并撤销
+	failInsert := errors.New("insert failed")
+	cb := models.DB.Callback().Create()
+	if err := cb.Before("gorm:create").Register("test:fail_music", func(db *gorm.DB) {
+		if db.Statement.Table == "music_infos" {
+			db.AddError(failInsert)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateMusic(newInfo(), path); !errors.Is(err, failInsert) {
+		t.Fatalf("写入失败时 err = %v", err)
+	}
+	cb.Remove("test:fail_music")
+	assertClean("写入失败")
+
+	info = newInfo()
+	if err := s.CreateMusic(info, path); err != nil {
+		t.Fatal(err)
+	}
+	if info.ID == 0 || info.AlbumID == nil || info.Cover == "" {
+		t.Fatalf("入库后 info = %+v", info)
+	}
+	if n := countRows(t, &models.Artist{}); n != 2 {
+		t.Errorf("艺人数 = %d, want 2", n)
+	}
+	obj, err := store.Get(ctx, info.ObjectKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Body.Close()
+	if _, err := storage.Bucket("artwork").Stat(ctx, ArtworkKey(info.Cover)); err != nil {
+		t.Errorf("封面应已保存: %v", err)
+	}
+
+	// 共用同一封面的另一首曲目入库失败，不应删除仍被引用的封面
+	other := writeTestWAV(t, dir, "b.wav", 1)
+	store.failCopy.Store(true)
+	if err := s.CreateMusic(newInfo(), other); err == nil {
+		t.Fatal("复制失败时 CreateMusic 应返回错误")
+	}
+	if _, err := storage.Bucket("artwork").Stat(ctx, ArtworkKey(info.Cover)); err != nil {
+		t.Errorf("仍被引用的封面不应被删除: %v", err)
+	}
+	if _, err := store.Stat(ctx, info.ObjectKey); err != nil {
+		t.Errorf("已入库曲目的对象不应被删除: %v", err)
+	}
+}
+
+func TestLockContentSerializesSameHash(t *testing.T) {
+	a := strings.Repeat("ab", 32)
+	unlock := lockContent(a)
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		lockContent(a)()
+	}()
+	// 其他内容不受影响
+	lockContent(strings.Repeat("cd", 32))()
+	lockContent("")()
+	select {
+	case <-acquired:
+		t.Fatal("相同内容的导入应等待前一个完成")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("释放后应能获得锁")
+	}
+}
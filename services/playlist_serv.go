@@ -0,0 +1,547 @@
+package services
+
+import (
+	"Music/config"
+	"Music/models"
+	"Music/repositories"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 歌单的长度上限
+const (
+	maxPlaylistTracks = 10000
+	maxPlaylistAdd    = 500 // 单次添加的曲目数
+)
+
+var ErrPlaylistForbidden = errors.New("没有权限修改歌单")
+
+// RevisionConflictError 提交的版本号与歌单当前版本不一致，客户端需重新读取后再修改
+type RevisionConflictError struct {
+	Current int
+}
+
+func (e *RevisionConflictError) Error() string {
+	return fmt.Sprintf("歌单已被修改，当前版本为 %d", e.Current)
+}
+
+// 调用方对歌单的权限，依次递增
+const (
+	playlistNone  = iota
+	playlistEdit  // 协作者：修改名称和曲目
+	playlistOwner // 所有者和管理员：另可删除、分享、管理协作者
+)
+
+type PlaylistMember struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// PlaylistDetail 歌单及其曲目；分享链接中不包含协作者
+type PlaylistDetail struct {
+	models.Playlist
+	Owner         PlaylistMember         `json:"owner"`
+	Collaborators []PlaylistMember       `json:"collaborators,omitempty"`
+	ShareURL      string                 `json:"share_url,omitempty"`
+	CanEdit       bool                   `json:"can_edit"`
+	Tracks        []models.PlaylistTrack `json:"tracks"`
+}
+
+type PlaylistService struct {
+	repo   *repositories.PlaylistRepository
+	musics *repositories.MusicRepository
+	users  *repositories.UserRepository
+}
+
+func NewPlaylistService() *PlaylistService {
+	return &PlaylistService{
+		repo:   &repositories.PlaylistRepository{},
+		musics: &repositories.MusicRepository{},
+		users:  &repositories.UserRepository{},
+	}
+}
+
+// PlaylistShareURL 歌单的公开分享地址
+func PlaylistShareURL(token string) string {
+	return config.BaseURL() + "/music/v1/shared/playlists/" + token
+}
+
+// List 调用方拥有或参与协作的歌单
+func (s *PlaylistService) List(viewer repositories.Viewer, offset, limit int) ([]models.Playlist, int64, error) {
+	return s.repo.ListForUser(viewer.UserID, offset, limit)
+}
+
+// PlaylistSummary 歌单及所有者、调用方可见曲目的数量和总时长
+type PlaylistSummary struct {
+	models.Playlist
+	Owner    PlaylistMember `json:"owner"`
+	Tracks   int64          `json:"tracks"`
+	Duration int64          `json:"duration"` // 毫秒
+}
+
+// Summaries 补充歌单的所有者和曲目统计
+func (s *PlaylistService) Summaries(viewer repositories.Viewer, playlists []models.Playlist) ([]PlaylistSummary, error) {
+	ids := make([]uint, 0, len(playlists))
+	for _, p := range playlists {
+		ids = append(ids, p.ID)
+	}
+	stats, err := s.repo.Stats(ids, viewer)
+	if err != nil {
+		return nil, err
+	}
+	owners := map[uint]PlaylistMember{}
+	summaries := make([]PlaylistSummary, 0, len(playlists))
+	for _, p := range playlists {
+		owner, ok := owners[p.OwnerID]
+		if !ok {
+			if u, err := s.users.GetByID(p.OwnerID); err == nil {
+				owner = PlaylistMember{ID: u.ID, Username: u.Username}
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			owners[p.OwnerID] = owner
+		}
+		summaries = append(summaries, PlaylistSummary{
+			Playlist: p,
+			Owner:    owner,
+			Tracks:   stats[p.ID].Tracks,
+			Duration: stats[p.ID].Duration,
+		})
+	}
+	return summaries, nil
+}
+
+// Create 创建空歌单；歌单必须属于某个用户，引导令牌不能创建
+func (s *PlaylistService) Create(viewer repositories.Viewer, name, description string) (*PlaylistDetail, error) {
+	if viewer.UserID == 0 {
+		return nil, ErrPlaylistForbidden
+	}
+	p := &models.Playlist{OwnerID: viewer.UserID, Name: name, Description: description, Revision: 1}
+	if err := validatePlaylist(&p.Name, &p.Description); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(p); err != nil {
+		return nil, err
+	}
+	return s.detail(viewer, p, playlistOwner)
+}
+
+// Get 读取歌单；调用方既不是所有者也不是协作者时返回 gorm.ErrRecordNotFound
+func (s *PlaylistService) Get(viewer repositories.Viewer, id uint) (*PlaylistDetail, error) {
+	p, access, err := s.load(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(viewer, p, access)
+}
+
+// GetShared 通过分享令牌读取歌单，只包含共享的曲目
+func (s *PlaylistService) GetShared(token string) (*PlaylistDetail, error) {
+	p, err := s.repo.GetByShareToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(repositories.Viewer{}, p, playlistNone)
+}
+
+// Update 修改名称或描述，nil 表示不修改
+func (s *PlaylistService) Update(viewer repositories.Viewer, id uint, revision int, name, description *string) (*PlaylistDetail, error) {
+	if name == nil && description == nil {
+		return nil, ErrEmptyUpdate
+	}
+	return s.mutate(viewer, id, revision, func(repo *repositories.PlaylistRepository, p *models.Playlist) error {
+		if name != nil {
+			p.Name = *name
+		}
+		if description != nil {
+			p.Description = *description
+		}
+		if err := validatePlaylist(&p.Name, &p.Description); err != nil {
+			return err
+		}
+		return repo.UpdateFields(p, "Name", "Description")
+	})
+}
+
+// Delete 删除歌单，只有所有者可以删除
+func (s *PlaylistService) Delete(viewer repositories.Viewer, id uint) error {
+	_, access, err := s.load(viewer, id)
+	if err != nil {
+		return err
+	}
+	if access < playlistOwner {
+		return ErrPlaylistForbidden
+	}
+	return s.repo.Delete(id)
+}
+
+// AddTracks 在 position 处插入曲目（nil 表示末尾），曲目需对调用方可见
+func (s *PlaylistService) AddTracks(viewer repositories.Viewer, id uint, revision int, trackIDs []uint, position *int) (*PlaylistDetail, error) {
+	if len(trackIDs) == 0 {
+		return nil, &FieldError{"track_ids", "不能为空"}
+	}
+	if len(trackIDs) > maxPlaylistAdd {
+		return nil, &FieldError{"track_ids", fmt.Sprintf("一次最多添加 %d 首", maxPlaylistAdd)}
+	}
+	visible, err := s.musics.ForViewer(viewer).FindByIDs(trackIDs)
+	if err != nil {
+		return nil, err
+	}
+	found := map[uint]bool{}
+	for _, m := range visible {
+		found[m.ID] = true
+	}
+	for _, tid := range trackIDs {
+		if !found[tid] {
+			return nil, &FieldError{"track_ids", fmt.Sprintf("曲目 %d 不存在", tid)}
+		}
+	}
+	return s.mutate(viewer, id, revision, func(repo *repositories.PlaylistRepository, p *models.Playlist) error {
+		entries, err := repo.Entries(id)
+		if err != nil {
+			return err
+		}
+		if len(entries)+len(trackIDs) > maxPlaylistTracks {
+			return &FieldError{"track_ids", fmt.Sprintf("歌单最多 %d 首曲目", maxPlaylistTracks)}
+		}
+		at := len(entries)
+		if position != nil {
+			if *position < 0 || *position > len(entries) {
+				return &FieldError{"position", fmt.Sprintf("应在 0-%d 之间", len(entries))}
+			}
+			at = *position
+		}
+		now := time.Now()
+		added := make([]models.PlaylistTrack, len(trackIDs))
+		for i, tid := range trackIDs {
+			added[i] = models.PlaylistTrack{PlaylistID: id, MusicID: tid, Position: at + i, AddedBy: viewer.UserID, AddedAt: now}
+		}
+		if err := repo.AddEntries(added); err != nil {
+			return err
+		}
+		// 删除曲目后位置可能不连续，插入点前后都重新编号
+		if err := renumber(repo, entries[:at], 0); err != nil {
+			return err
+		}
+		return renumber(repo, entries[at:], at+len(added))
+	})
+}
+
+// RemoveTracks 删除歌单中的指定项（歌单项 ID，而非曲目 ID）
+func (s *PlaylistService) RemoveTracks(viewer repositories.Viewer, id uint, revision int, entryIDs []uint) (*PlaylistDetail, error) {
+	if len(entryIDs) == 0 {
+		return nil, &FieldError{"entry_ids", "不能为空"}
+	}
+	unique := uniqueIDs(entryIDs)
+	return s.mutate(viewer, id, revision, func(repo *repositories.PlaylistRepository, p *models.Playlist) error {
+		n, err := repo.DeleteEntries(id, unique)
+		if err != nil {
+			return err
+		}
+		if n != int64(len(unique)) {
+			return &FieldError{"entry_ids", "包含不属于该歌单的项"}
+		}
+		entries, err := repo.Entries(id)
+		if err != nil {
+			return err
+		}
+		return renumber(repo, entries, 0)
+	})
+}
+
+// Reorder 按 entryIDs 的顺序重排歌单，entryIDs 需包含歌单的全部项
+func (s *PlaylistService) Reorder(viewer repositories.Viewer, id uint, revision int, entryIDs []uint) (*PlaylistDetail, error) {
+	return s.mutate(viewer, id, revision, func(repo *repositories.PlaylistRepository, p *models.Playlist) error {
+		entries, err := repo.Entries(id)
+		if err != nil {
+			return err
+		}
+		byID := make(map[uint]models.PlaylistTrack, len(entries))
+		for _, e := range entries {
+			byID[e.ID] = e
+		}
+		if len(entryIDs) != len(entries) || len(uniqueIDs(entryIDs)) != len(entryIDs) {
+			return &FieldError{"entry_ids", "需按新顺序列出歌单的全部项"}
+		}
+		ordered := make([]models.PlaylistTrack, 0, len(entryIDs))
+		for _, eid := range entryIDs {
+			e, ok := byID[eid]
+			if !ok {
+				return &FieldError{"entry_ids", fmt.Sprintf("项 %d 不属于该歌单", eid)}
+			}
+			ordered = append(ordered, e)
+		}
+		return renumber(repo, ordered, 0)
+	})
+}
+
+// Duplicate 复制歌单为调用方的新歌单，只复制调用方可见的曲目；name 为空时在原名后加“(副本)”
+func (s *PlaylistService) Duplicate(viewer repositories.Viewer, id uint, name string) (*PlaylistDetail, error) {
+	if viewer.UserID == 0 {
+		return nil, ErrPlaylistForbidden
+	}
+	src, err := s.Get(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(name) == "" {
+		name = truncateRunes(src.Name, 250) + " (副本)"
+	}
+	p := &models.Playlist{OwnerID: viewer.UserID, Name: name, Description: src.Description, Revision: 1}
+	if err := validatePlaylist(&p.Name, &p.Description); err != nil {
+		return nil, err
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.repo.WithTx(tx)
+		if err := repo.Create(p); err != nil {
+			return err
+		}
+		now := time.Now()
+		var entries []models.PlaylistTrack
+		for _, e := range src.Tracks {
+			if e.Track != nil {
+				entries = append(entries, models.PlaylistTrack{PlaylistID: p.ID, MusicID: e.MusicID, Position: len(entries), AddedBy: viewer.UserID, AddedAt: now})
+			}
+		}
+		return repo.AddEntries(entries)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(viewer, p, playlistOwner)
+}
+
+// Share 生成公开分享链接，已分享时返回原链接
+func (s *PlaylistService) Share(viewer repositories.Viewer, id uint) (*PlaylistDetail, error) {
+	p, err := s.loadOwned(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.ShareToken == nil {
+		token := randomHex(16)
+		p.ShareToken = &token
+		if err := s.repo.UpdateFields(p, "ShareToken"); err != nil {
+			return nil, err
+		}
+	}
+	return s.detail(viewer, p, playlistOwner)
+}
+
+// Unshare 取消分享，原链接失效
+func (s *PlaylistService) Unshare(viewer repositories.Viewer, id uint) (*PlaylistDetail, error) {
+	p, err := s.loadOwned(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.ShareToken != nil {
+		p.ShareToken = nil
+		if err := s.repo.UpdateFields(p, "ShareToken"); err != nil {
+			return nil, err
+		}
+	}
+	return s.detail(viewer, p, playlistOwner)
+}
+
+// AddCollaborator 邀请用户共同编辑歌单
+func (s *PlaylistService) AddCollaborator(viewer repositories.Viewer, id uint, username string) (*PlaylistDetail, error) {
+	p, err := s.loadOwned(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &FieldError{"username", "用户不存在"}
+	} else if err != nil {
+		return nil, err
+	}
+	if user.ID == p.OwnerID {
+		return nil, &FieldError{"username", "不能添加歌单的所有者"}
+	}
+	exists, err := s.repo.IsCollaborator(id, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := s.repo.AddCollaborator(id, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return s.detail(viewer, p, playlistOwner)
+}
+
+// RemoveCollaborator 移除协作者；协作者也可以移除自己（退出协作）
+func (s *PlaylistService) RemoveCollaborator(viewer repositories.Viewer, id, userID uint) error {
+	_, access, err := s.load(viewer, id)
+	if err != nil {
+		return err
+	}
+	if access < playlistOwner && userID != viewer.UserID {
+		return ErrPlaylistForbidden
+	}
+	return s.repo.RemoveCollaborator(id, userID)
+}
+
+// load 读取歌单及调用方的权限；没有权限的调用方看不到歌单
+func (s *PlaylistService) load(viewer repositories.Viewer, id uint) (*models.Playlist, int, error) {
+	p, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, playlistNone, err
+	}
+	if viewer.All || (viewer.UserID != 0 && p.OwnerID == viewer.UserID) {
+		return p, playlistOwner, nil
+	}
+	if viewer.UserID != 0 {
+		ok, err := s.repo.IsCollaborator(id, viewer.UserID)
+		if err != nil {
+			return nil, playlistNone, err
+		}
+		if ok {
+			return p, playlistEdit, nil
+		}
+	}
+	return nil, playlistNone, gorm.ErrRecordNotFound
+}
+
+func (s *PlaylistService) loadOwned(viewer repositories.Viewer, id uint) (*models.Playlist, error) {
+	p, access, err := s.load(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if access < playlistOwner {
+		return nil, ErrPlaylistForbidden
+	}
+	return p, nil
+}
+
+// mutate 检查权限和版本号后在一个事务中修改歌单，版本号加一；返回修改后的歌单
+func (s *PlaylistService) mutate(viewer repositories.Viewer, id uint, revision int, fn func(repo *repositories.PlaylistRepository, p *models.Playlist) error) (*PlaylistDetail, error) {
+	p, access, err := s.load(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if access < playlistEdit {
+		return nil, ErrPlaylistForbidden
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.repo.WithTx(tx)
+		ok, err := repo.BumpRevision(id, revision)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			current, err := repo.GetByID(id)
+			if err != nil {
+				return err
+			}
+			return &RevisionConflictError{Current: current.Revision}
+		}
+		return fn(repo, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p, err = s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	return s.detail(viewer, p, access)
+}
+
+// detail 组装歌单详情，调用方看不到的曲目只保留歌单项
+func (s *PlaylistService) detail(viewer repositories.Viewer, p *models.Playlist, access int) (*PlaylistDetail, error) {
+	d := &PlaylistDetail{Playlist: *p, CanEdit: access >= playlistEdit}
+	if owner, err := s.users.GetByID(p.OwnerID); err == nil {
+		d.Owner = PlaylistMember{ID: owner.ID, Username: owner.Username}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if access > playlistNone {
+		users, err := s.repo.Collaborators(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		d.Collaborators = make([]PlaylistMember, 0, len(users))
+		for _, u := range users {
+			d.Collaborators = append(d.Collaborators, PlaylistMember{ID: u.ID, Username: u.Username})
+		}
+		if p.ShareToken != nil {
+			d.ShareURL = PlaylistShareURL(*p.ShareToken)
+		}
+	}
+	entries, err := s.repo.Entries(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.MusicID)
+	}
+	tracks, err := s.musics.ForViewer(viewer).FindByIDs(uniqueIDs(ids))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*models.MusicInfo, len(tracks))
+	for i := range tracks {
+		byID[tracks[i].ID] = &tracks[i]
+	}
+	// 能编辑的用户需要看到全部项才能按 entry id 重排；其他人只看到自己能播放的曲目
+	d.Tracks = entries[:0]
+	for _, e := range entries {
+		e.Track = byID[e.MusicID]
+		if e.Track == nil && access == playlistNone {
+			continue
+		}
+		d.Tracks = append(d.Tracks, e)
+	}
+	return d, nil
+}
+
+// renumber 从 start 开始依次设置各项的位置，只写入有变化的项
+func renumber(repo *repositories.PlaylistRepository, entries []models.PlaylistTrack, start int) error {
+	for i, e := range entries {
+		if e.Position == start+i {
+			continue
+		}
+		if err := repo.SetPosition(e.ID, start+i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePlaylist(name, description *string) error {
+	*name = strings.TrimSpace(*name)
+	*description = strings.TrimSpace(*description)
+	if *name == "" {
+		return &FieldError{"name", "不能为空"}
+	}
+	if utf8.RuneCountInString(*name) > maxTrackTextLen {
+		return &FieldError{"name", fmt.Sprintf("不能超过 %d 个字符", maxTrackTextLen)}
+	}
+	if utf8.RuneCountInString(*description) > 1000 {
+		return &FieldError{"description", "不能超过 1000 个字符"}
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
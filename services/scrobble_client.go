@@ -0,0 +1,308 @@
+package services
+
+import (
+	"Music/config"
+	"Music/models"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 提交时上报的客户端名称
+const scrobbleClientName = "Music"
+
+// ErrScrobbleAuth 远端服务拒绝了令牌或密码，需要用户重新关联账号
+var ErrScrobbleAuth = errors.New("scrobble 账号验证失败")
+
+// scrobbleRejectedError 远端服务认为数据无效，重试也不会成功，这批记录直接丢弃
+type scrobbleRejectedError struct {
+	msg string
+}
+
+func (e *scrobbleRejectedError) Error() string { return e.msg }
+
+var scrobbleHTTP = &http.Client{Timeout: 15 * time.Second}
+
+// ScrobbleTrack 提交给远端服务的一次收听
+type ScrobbleTrack struct {
+	Artist     string
+	Track      string
+	Album      string
+	DurationMs int64
+	ListenedAt time.Time
+}
+
+// scrobbleClient 一种 scrobble 协议的客户端
+type scrobbleClient interface {
+	NowPlaying(ctx context.Context, token string, t ScrobbleTrack) error
+	Submit(ctx context.Context, token string, listens []ScrobbleTrack) error
+	// BatchSize 单次提交的最大记录数
+	BatchSize() int
+}
+
+// readScrobbleResponse 读取响应体；429 和 5xx 返回普通错误以便重试
+func readScrobbleResponse(resp *http.Response, service string) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("%s: HTTP %d", service, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// listenBrainzClient ListenBrainz API，见 https://listenbrainz.readthedocs.io/en/latest/users/api/
+type listenBrainzClient struct {
+	baseURL string
+}
+
+type lbTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info"`
+}
+
+type lbListen struct {
+	ListenedAt    int64           `json:"listened_at,omitempty"`
+	TrackMetadata lbTrackMetadata `json:"track_metadata"`
+}
+
+func (c *listenBrainzClient) BatchSize() int { return 100 }
+
+func (c *listenBrainzClient) do(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.baseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := scrobbleHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	data, err := readScrobbleResponse(resp, "listenbrainz")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrScrobbleAuth
+	}
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(data, &e)
+		return &scrobbleRejectedError{msg: fmt.Sprintf("listenbrainz: HTTP %d: %s", resp.StatusCode, e.Error)}
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// Validate 校验用户令牌，返回 ListenBrainz 用户名
+func (c *listenBrainzClient) Validate(ctx context.Context, token string) (string, error) {
+	var result struct {
+		Valid    bool   `json:"valid"`
+		UserName string `json:"user_name"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/1/validate-token", token, nil, &result); err != nil {
+		return "", err
+	}
+	if !result.Valid {
+		return "", ErrScrobbleAuth
+	}
+	return result.UserName, nil
+}
+
+func (c *listenBrainzClient) listen(t ScrobbleTrack, withTime bool) lbListen {
+	info := map[string]interface{}{"media_player": scrobbleClientName, "submission_client": scrobbleClientName}
+	if t.DurationMs > 0 {
+		info["duration_ms"] = t.DurationMs
+	}
+	l := lbListen{TrackMetadata: lbTrackMetadata{
+		ArtistName: t.Artist, TrackName: t.Track, ReleaseName: t.Album, AdditionalInfo: info,
+	}}
+	if withTime {
+		l.ListenedAt = t.ListenedAt.Unix()
+	}
+	return l
+}
+
+func (c *listenBrainzClient) NowPlaying(ctx context.Context, token string, t ScrobbleTrack) error {
+	payload := map[string]interface{}{"listen_type": "playing_now", "payload": []lbListen{c.listen(t, false)}}
+	return c.do(ctx, http.MethodPost, "/1/submit-listens", token, payload, nil)
+}
+
+func (c *listenBrainzClient) Submit(ctx context.Context, token string, listens []ScrobbleTrack) error {
+	listenType := "single"
+	if len(listens) > 1 {
+		listenType = "import"
+	}
+	items := make([]lbListen, 0, len(listens))
+	for _, t := range listens {
+		items = append(items, c.listen(t, true))
+	}
+	payload := map[string]interface{}{"listen_type": listenType, "payload": items}
+	return c.do(ctx, http.MethodPost, "/1/submit-listens", token, payload, nil)
+}
+
+// lastFMClient Last.fm 2.0 API（Audioscrobbler），见 https://www.last.fm/api/scrobbling
+type lastFMClient struct {
+	baseURL string
+	apiKey  string
+	secret  string
+}
+
+func (c *lastFMClient) BatchSize() int { return 50 }
+
+// sign 计算 api_sig：参数按名称排序后拼接名称和值，加上密钥取 MD5
+func (c *lastFMClient) sign(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "format" && k != "callback" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(params.Get(k))
+	}
+	b.WriteString(c.secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *lastFMClient) call(ctx context.Context, params url.Values, out interface{}) error {
+	params.Set("api_key", c.apiKey)
+	params.Set("api_sig", c.sign(params))
+	params.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := scrobbleHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	data, err := readScrobbleResponse(resp, "lastfm")
+	if err != nil {
+		return err
+	}
+	var e struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return fmt.Errorf("lastfm: 无法解析响应 (HTTP %d)", resp.StatusCode)
+	}
+	switch e.Error {
+	case 0:
+	case 4, 9, 14: // 验证失败、会话失效、令牌未授权
+		return ErrScrobbleAuth
+	case 6: // 参数无效
+		return &scrobbleRejectedError{msg: "lastfm: " + e.Message}
+	default: // 服务暂不可用、限流，以及 api_key 配置错误等，稍后重试
+		return fmt.Errorf("lastfm: %d %s", e.Error, e.Message)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// Login 用用户名和密码换取会话密钥（auth.getMobileSession），返回会话密钥和用户名
+func (c *lastFMClient) Login(ctx context.Context, username, password string) (string, string, error) {
+	var result struct {
+		Session struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"session"`
+	}
+	params := url.Values{"method": {"auth.getMobileSession"}, "username": {username}, "password": {password}}
+	if err := c.call(ctx, params, &result); err != nil {
+		return "", "", err
+	}
+	if result.Session.Key == "" {
+		return "", "", ErrScrobbleAuth
+	}
+	return result.Session.Key, result.Session.Name, nil
+}
+
+func (c *lastFMClient) NowPlaying(ctx context.Context, token string, t ScrobbleTrack) error {
+	params := url.Values{"method": {"track.updateNowPlaying"}, "sk": {token}, "artist": {t.Artist}, "track": {t.Track}}
+	if t.Album != "" {
+		params.Set("album", t.Album)
+	}
+	if t.DurationMs > 0 {
+		params.Set("duration", strconv.FormatInt(t.DurationMs/1000, 10))
+	}
+	return c.call(ctx, params, nil)
+}
+
+func (c *lastFMClient) Submit(ctx context.Context, token string, listens []ScrobbleTrack) error {
+	params := url.Values{"method": {"track.scrobble"}, "sk": {token}}
+	for i, t := range listens {
+		n := "[" + strconv.Itoa(i) + "]"
+		params.Set("artist"+n, t.Artist)
+		params.Set("track"+n, t.Track)
+		params.Set("timestamp"+n, strconv.FormatInt(t.ListenedAt.Unix(), 10))
+		if t.Album != "" {
+			params.Set("album"+n, t.Album)
+		}
+		if t.DurationMs > 0 {
+			params.Set("duration"+n, strconv.FormatInt(t.DurationMs/1000, 10))
+		}
+	}
+	return c.call(ctx, params, nil)
+}
+
+// newScrobbleClient 按配置创建 service 的客户端
+func newScrobbleClient(service string) (scrobbleClient, error) {
+	cfg := config.Config.Scrobble
+	switch service {
+	case models.ScrobbleListenBrainz:
+		baseURL := cfg.ListenBrainzURL
+		if baseURL == "" {
+			baseURL = "https://api.listenbrainz.org"
+		}
+		return &listenBrainzClient{baseURL: baseURL}, nil
+	case models.ScrobbleLastFM:
+		if cfg.LastFMAPIKey == "" || cfg.LastFMSecret == "" {
+			return nil, &FieldError{Field: "service", Reason: "服务器未配置 Last.fm 的 api_key"}
+		}
+		baseURL := cfg.LastFMURL
+		if baseURL == "" {
+			baseURL = "https://ws.audioscrobbler.com/2.0/"
+		}
+		return &lastFMClient{baseURL: baseURL, apiKey: cfg.LastFMAPIKey, secret: cfg.LastFMSecret}, nil
+	}
+	return nil, &FieldError{Field: "service", Reason: "须为 listenbrainz 或 lastfm"}
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"Music/config"
+	"Music/models"
+	"Music/my_utils"
+	"Music/repositories"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	// 短于该时长的曲目不提交（Last.fm 的规则）
+	scrobbleMinDuration = 30 * time.Second
+	// 播放超过曲目一半或该时长算一次完整收听（ListenBrainz / Last.fm 的规则）
+	scrobbleMaxThreshold = 4 * time.Minute
+	// 每轮最多处理的队列记录数
+	scrobbleBatchLimit = 500
+	// 重试间隔从 1 分钟开始翻倍，最长 6 小时
+	scrobbleMinBackoff = time.Minute
+	scrobbleMaxBackoff = 6 * time.Hour
+)
+
+// ScrobbleCredentials 关联账号时提交的凭据：ListenBrainz 用 Token，Last.fm 用 Username 和 Password
+type ScrobbleCredentials struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// ScrobbleAccountInfo 账号及其待提交的记录数
+type ScrobbleAccountInfo struct {
+	models.ScrobbleAccount
+	Pending int64 `json:"pending"`
+}
+
+type ScrobbleService struct {
+	repo *repositories.ScrobbleRepository
+}
+
+func NewScrobbleService() *ScrobbleService {
+	return &ScrobbleService{repo: &repositories.ScrobbleRepository{}}
+}
+
+func scrobblePollInterval() time.Duration {
+	if config.Config.Scrobble.PollInterval > 0 {
+		return config.Config.Scrobble.PollInterval
+	}
+	return 30 * time.Second
+}
+
+func scrobbleMaxAttempts() int {
+	if config.Config.Scrobble.MaxAttempts > 0 {
+		return config.Config.Scrobble.MaxAttempts
+	}
+	return 50
+}
+
+// Accounts 用户关联的账号
+func (s *ScrobbleService) Accounts(userID uint) ([]ScrobbleAccountInfo, error) {
+	accounts, err := s.repo.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(accounts))
+	for _, a := range accounts {
+		ids = append(ids, a.ID)
+	}
+	pending, err := s.repo.PendingCounts(ids)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ScrobbleAccountInfo, 0, len(accounts))
+	for _, a := range accounts {
+		infos = append(infos, ScrobbleAccountInfo{ScrobbleAccount: a, Pending: pending[a.ID]})
+	}
+	return infos, nil
+}
+
+// Link 校验凭据后关联账号；已关联时替换凭据并重新启用，停用期间积压的记录会继续提交。
+// Last.fm 只保存换得的会话密钥，不保存密码
+func (s *ScrobbleService) Link(ctx context.Context, userID uint, service string, cred ScrobbleCredentials) (*ScrobbleAccountInfo, error) {
+	client, err := newScrobbleClient(service)
+	if err != nil {
+		return nil, err
+	}
+	var token, username string
+	switch c := client.(type) {
+	case *listenBrainzClient:
+		if cred.Token == "" {
+			return nil, &FieldError{Field: "token", Reason: "不能为空"}
+		}
+		token = cred.Token
+		username, err = c.Validate(ctx, token)
+	case *lastFMClient:
+		if cred.Username == "" || cred.Password == "" {
+			return nil, &FieldError{Field: "password", Reason: "需要 Last.fm 用户名和密码"}
+		}
+		token, username, err = c.Login(ctx, cred.Username, cred.Password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.repo.GetAccount(userID, service)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		account, err = &models.ScrobbleAccount{UserID: userID, Service: service}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	account.Token = token
+	account.Username = username
+	account.Enabled = true
+	account.LastError = ""
+	if err := s.repo.SaveAccount(account); err != nil {
+		return nil, err
+	}
+	pending, err := s.repo.PendingCounts([]uint{account.ID})
+	if err != nil {
+		return nil, err
+	}
+	return &ScrobbleAccountInfo{ScrobbleAccount: *account, Pending: pending[account.ID]}, nil
+}
+
+// Unlink 取消关联，丢弃未提交的记录；未关联时返回 gorm.ErrRecordNotFound
+func (s *ScrobbleService) Unlink(userID uint, service string) error {
+	account, err := s.repo.GetAccount(userID, service)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteAccount(account.ID)
+}
+
+// OnPlay 用户从头开始播放一首曲目：上一首还没播放到一半的不再提交，
+// 向各账号发送正在播放，并为这首曲目排队，到期后由 Run 提交
+func (s *ScrobbleService) OnPlay(e *models.PlayEvent, music *models.MusicInfo) error {
+	accounts, err := s.repo.EnabledAccounts(e.UserID)
+	if err != nil || len(accounts) == 0 {
+		return err
+	}
+	ids := make([]uint, 0, len(accounts))
+	for _, a := range accounts {
+		ids = append(ids, a.ID)
+	}
+	if err := s.repo.CancelPending(ids, e.PlayedAt); err != nil {
+		return err
+	}
+	track, threshold, ok := scrobbleTrack(music, e.PlayedAt)
+	if !ok {
+		return nil
+	}
+	if err := s.enqueue(accounts, e, track, e.PlayedAt.Add(threshold)); err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		go s.nowPlaying(a, track)
+	}
+	return nil
+}
+
+// OnListen 客户端播放完成后上报的收听（如 Subsonic 的 scrobble），是否听够由客户端判断，立即排队提交
+func (s *ScrobbleService) OnListen(e *models.PlayEvent, music *models.MusicInfo) error {
+	accounts, err := s.repo.EnabledAccounts(e.UserID)
+	if err != nil || len(accounts) == 0 {
+		return err
+	}
+	track, _, ok := scrobbleTrack(music, e.PlayedAt)
+	if !ok {
+		return nil
+	}
+	return s.enqueue(accounts, e, track, time.Now())
+}
+
+// NowPlaying 只向用户的各账号发送正在播放，不排队
+func (s *ScrobbleService) NowPlaying(userID uint, music *models.MusicInfo) error {
+	accounts, err := s.repo.EnabledAccounts(userID)
+	if err != nil || len(accounts) == 0 {
+		return err
+	}
+	track, _, ok := scrobbleTrack(music, time.Now())
+	if !ok {
+		return nil
+	}
+	for _, a := range accounts {
+		go s.nowPlaying(a, track)
+	}
+	return nil
+}
+
+// scrobbleTrack 转换为提交的收听，并返回算作完整收听的播放时长；
+// 缺少艺人或标题的曲目远端服务不接受，过短的曲目不提交
+func scrobbleTrack(music *models.MusicInfo, listenedAt time.Time) (ScrobbleTrack, time.Duration, bool) {
+	duration := time.Duration(music.Duration) * time.Millisecond
+	if music.Singer == "" || music.Name == "" || (duration > 0 && duration < scrobbleMinDuration) {
+		return ScrobbleTrack{}, 0, false
+	}
+	threshold := scrobbleMaxThreshold
+	if duration > 0 && duration/2 < threshold {
+		threshold = duration / 2
+	}
+	return ScrobbleTrack{
+		Artist:     truncateRunes(music.Singer, 255),
+		Track:      truncateRunes(music.Name, 255),
+		Album:      truncateRunes(music.Album, 255),
+		DurationMs: music.Duration,
+		ListenedAt: listenedAt,
+	}, threshold, true
+}
+
+// enqueue 为每个账号排队一条记录，dueAt 之后提交
+func (s *ScrobbleService) enqueue(accounts []models.ScrobbleAccount, e *models.PlayEvent, track ScrobbleTrack, dueAt time.Time) error {
+	jobs := make([]models.ScrobbleJob, 0, len(accounts))
+	for _, a := range accounts {
+		jobs = append(jobs, models.ScrobbleJob{
+			AccountID:   a.ID,
+			PlayEventID: e.ID,
+			Artist:      track.Artist,
+			Track:       track.Track,
+			Album:       track.Album,
+			DurationMs:  track.DurationMs,
+			ListenedAt:  track.ListenedAt,
+			DueAt:       dueAt,
+		})
+	}
+	return s.repo.AddJobs(jobs)
+}
+
+// nowPlaying 发送正在播放，只尝试一次，失败不影响收听记录的提交
+func (s *ScrobbleService) nowPlaying(account models.ScrobbleAccount, track ScrobbleTrack) {
+	client, err := newScrobbleClient(account.Service)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = client.NowPlaying(ctx, account.Token, track)
+	}
+	if err != nil {
+		my_utils.Warn("发送正在播放到 %s 失败（用户 %d）: %v", account.Service, account.UserID, err)
+	}
+}
+
+// Run 定期提交到期的记录，直到 ctx 结束
+func (s *ScrobbleService) Run(ctx context.Context) {
+	ticker := time.NewTicker(scrobblePollInterval())
+	defer ticker.Stop()
+	for {
+		if _, err := s.Flush(ctx); err != nil {
+			my_utils.Error("提交 scrobble 队列失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush 提交一轮到期的记录，返回提交成功的数量
+func (s *ScrobbleService) Flush(ctx context.Context) (int, error) {
+	now := time.Now()
+	jobs, err := s.repo.DueJobs(now, scrobbleBatchLimit)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for start := 0; start < len(jobs); {
+		end := start
+		for end < len(jobs) && jobs[end].AccountID == jobs[start].AccountID {
+			end++
+		}
+		n, err := s.flushAccount(ctx, jobs[start].AccountID, jobs[start:end], now)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+		start = end
+	}
+	return sent, nil
+}
+
+// flushAccount 分批提交一个账号的记录；只有数据库错误会返回错误，远端服务的错误按类型处理
+func (s *ScrobbleService) flushAccount(ctx context.Context, accountID uint, jobs []models.ScrobbleJob, now time.Time) (int, error) {
+	account, err := s.repo.GetAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+	client, err := newScrobbleClient(account.Service)
+	if err != nil {
+		// 服务器配置被改动，暂时无法提交，保留记录
+		my_utils.Warn("无法提交到 %s: %v", account.Service, err)
+		return 0, nil
+	}
+	sent := 0
+	for start := 0; start < len(jobs); start += client.BatchSize() {
+		batch := jobs[start:min(start+client.BatchSize(), len(jobs))]
+		listens := make([]ScrobbleTrack, 0, len(batch))
+		ids := make([]uint, 0, len(batch))
+		for _, j := range batch {
+			listens = append(listens, ScrobbleTrack{Artist: j.Artist, Track: j.Track, Album: j.Album,
+				DurationMs: j.DurationMs, ListenedAt: j.ListenedAt})
+			ids = append(ids, j.ID)
+		}
+		err := client.Submit(ctx, account.Token, listens)
+		var rejected *scrobbleRejectedError
+		switch {
+		case err == nil:
+			if err := s.repo.DeleteJobs(ids); err != nil {
+				return sent, err
+			}
+			sent += len(batch)
+		case errors.Is(err, ErrScrobbleAuth):
+			my_utils.Warn("%s 账号验证失败，已停用（用户 %d）", account.Service, account.UserID)
+			return sent, s.repo.DisableAccount(account.ID, truncateRunes(err.Error(), 500))
+		case errors.As(err, &rejected):
+			my_utils.Warn("%s 拒绝了 %d 条收听记录，已丢弃: %v", account.Service, len(batch), err)
+			if err := s.repo.DeleteJobs(ids); err != nil {
+				return sent, err
+			}
+		default:
+			if err := s.reschedule(batch, err, now); err != nil {
+				return sent, err
+			}
+			// 远端服务不可用时本轮不再提交这个账号的其他批次
+			return sent, nil
+		}
+	}
+	return sent, nil
+}
+
+// reschedule 提交失败的记录按指数退避推迟，超过最多次数的丢弃
+func (s *ScrobbleService) reschedule(jobs []models.ScrobbleJob, cause error, now time.Time) error {
+	msg := truncateRunes(cause.Error(), 500)
+	var expired []uint
+	for _, j := range jobs {
+		attempts := j.Attempts + 1
+		if attempts >= scrobbleMaxAttempts() {
+			expired = append(expired, j.ID)
+			continue
+		}
+		backoff := scrobbleMaxBackoff
+		if attempts <= 10 {
+			backoff = min(scrobbleMinBackoff<<(attempts-1), scrobbleMaxBackoff)
+		}
+		if err := s.repo.RescheduleJob(j.ID, attempts, now.Add(backoff), msg); err != nil {
+			return err
+		}
+	}
+	if len(expired) > 0 {
+		my_utils.Warn("%d 条收听记录多次提交失败，已丢弃: %v", len(expired), cause)
+	}
+	return s.repo.DeleteJobs(expired)
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+	"Music/config"
+	"Music/models"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testLBToken      = "lb-token"
+	testLastFMKey    = "lastfm-key"
+	testLastFMSecret = "lastfm-secret"
+	testLastFMSK     = "lastfm-session"
+)
+
+// lbStub 模拟 ListenBrainz 的 /1/validate-token 和 /1/submit-listens
+type lbStub struct {
+	mu       sync.Mutex
+	status   int // submit-listens 的响应状态，0 为 200
+	requests []map[string]interface{}
+}
+
+func (s *lbStub) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *lbStub) submitted() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.requests...)
+}
+
+func (s *lbStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/1/validate-token":
+		if token != testLBToken {
+			w.Write([]byte(`{"code":200,"valid":false,"message":"Token invalid."}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"valid":true,"user_name":"lb-user"}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/1/submit-listens":
+		if token != testLBToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"error":"Invalid authorization token."}`))
+			return
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":400,"error":"Invalid JSON document submitted."}`))
+			return
+		}
+		s.mu.Lock()
+		status := s.status
+		s.requests = append(s.requests, payload)
+		s.mu.Unlock()
+		switch {
+		case status == 0:
+			w.Write([]byte(`{"status":"ok"}`))
+		case status < 500:
+			w.WriteHeader(status)
+			w.Write([]byte(`{"code":` + strconv.Itoa(status) + `,"error":"Invalid listen."}`))
+		default:
+			w.WriteHeader(status)
+			w.Write([]byte(`<html>Bad Gateway</html>`))
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// lastFMStub 模拟 Last.fm 2.0 API，按文档独立计算并校验 api_sig
+type lastFMStub struct {
+	mu        sync.Mutex
+	status    int // track.scrobble 的 HTTP 状态，0 为 200
+	errorCode int // track.scrobble 返回的 Last.fm 错误码，0 为成功
+	scrobbles []url.Values
+}
+
+func (s *lastFMStub) set(status, errorCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.errorCode = status, errorCode
+}
+
+func (s *lastFMStub) submitted() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.scrobbles...)
+}
+
+func lastFMSignature(form url.Values, secret string) string {
+	var keys []string
+	for k := range form {
+		if k != "format" && k != "callback" && k != "api_sig" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + form.Get(k))
+	}
+	sum := md5.Sum([]byte(b.String() + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *lastFMStub) fail(w http.ResponseWriter, status, code int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": code, "message": message})
+}
+
+func (s *lastFMStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		s.fail(w, http.StatusBadRequest, 3, "Invalid Method")
+		return
+	}
+	form := r.PostForm
+	if form.Get("format") != "json" {
+		s.fail(w, http.StatusBadRequest, 6, "Invalid format")
+		return
+	}
+	if form.Get("api_key") != testLastFMKey {
+		s.fail(w, http.StatusForbidden, 10, "Invalid API key")
+		return
+	}
+	if form.Get("api_sig") != lastFMSignature(form, testLastFMSecret) {
+		s.fail(w, http.StatusForbidden, 13, "Invalid method signature supplied")
+		return
+	}
+	switch form.Get("method") {
+	case "auth.getMobileSession":
+		if form.Get("password") != "secret" {
+			s.fail(w, http.StatusForbidden, 4, "Authentication Failed")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"session": map[string]interface{}{"name": form.Get("username"), "key": testLastFMSK, "subscriber": 0},
+		})
+	case "track.scrobble":
+		if form.Get("sk") != testLastFMSK {
+			s.fail(w, http.StatusForbidden, 9, "Invalid session key - Please re-authenticate")
+			return
+		}
+		s.mu.Lock()
+		status, code := s.status, s.errorCode
+		s.scrobbles = append(s.scrobbles, form)
+		s.mu.Unlock()
+		switch {
+		case status >= 500:
+			w.WriteHeader(status)
+		case code != 0:
+			s.fail(w, http.StatusBadRequest, code, "Error "+form.Get("method"))
+		default:
+			w.Write([]byte(`{"scrobbles":{"@attr":{"accepted":1,"ignored":0}}}`))
+		}
+	default:
+		s.fail(w, http.StatusBadRequest, 3, "Invalid Method")
+	}
+}
+
+// newScrobbleTest 启动两个桩服务并把配置指向它们
+func newScrobbleTest(t *testing.T) (*lbStub, *lastFMStub) {
+	t.Helper()
+	lb, lastfm := &lbStub{}, &lastFMStub{}
+	lbServer, lastfmServer := httptest.NewServer(lb), httptest.NewServer(lastfm)
+	t.Cleanup(lbServer.Close)
+	t.Cleanup(lastfmServer.Close)
+
+	oldCfg := config.Config.Scrobble
+	t.Cleanup(func() { config.Config.Scrobble = oldCfg })
+	config.Config.Scrobble = config.ScrobbleConfig{
+		ListenBrainzURL: lbServer.URL,
+		LastFMURL:       lastfmServer.URL + "/2.0/",
+		LastFMAPIKey:    testLastFMKey,
+		LastFMSecret:    testLastFMSecret,
+	}
+	useTestDB(t)
+	return lb, lastfm
+}
+
+var testListens = []ScrobbleTrack{
+	{Artist: "陈奕迅", Track: "十年", Album: "黑白灰", DurationMs: 205000, ListenedAt: time.Unix(1700000000, 0)},
+	{Artist: "Radiohead", Track: "Airbag", DurationMs: 0, ListenedAt: time.Unix(1700000300, 0)},
+}
+
+func TestListenBrainzClient(t *testing.T) {
+	lb, _ := newScrobbleTest(t)
+	ctx := context.Background()
+	client, err := newScrobbleClient(models.ScrobbleListenBrainz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.(*listenBrainzClient)
+
+	if name, err := c.Validate(ctx, testLBToken); err != nil || name != "lb-user" {
+		t.Errorf("Validate = %q, %v", name, err)
+	}
+	if _, err := c.Validate(ctx, "wrong"); !errors.Is(err, ErrScrobbleAuth) {
+		t.Errorf("无效令牌 Validate err = %v", err)
+	}
+
+	if err := c.Submit(ctx, testLBToken, testListens); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.NowPlaying(ctx, testLBToken, testListens[0]); err != nil {
+		t.Fatal(err)
+	}
+	reqs := lb.submitted()
+	if len(reqs) != 2 {
+		t.Fatalf("submit-listens 收到 %d 个请求", len(reqs))
+	}
+	if reqs[0]["listen_type"] != "import" {
+		t.Errorf("多条记录的 listen_type = %v", reqs[0]["listen_type"])
+	}
+	items := reqs[0]["payload"].([]interface{})
+	first := items[0].(map[string]interface{})
+	meta := first["track_metadata"].(map[string]interface{})
+	if first["listened_at"] != float64(1700000000) || meta["artist_name"] != "陈奕迅" ||
+		meta["track_name"] != "十年" || meta["release_name"] != "黑白灰" {
+		t.Errorf("提交的记录 = %v", first)
+	}
+	if info := meta["additional_info"].(map[string]interface{}); info["duration_ms"] != float64(205000) {
+		t.Errorf("additional_info = %v", info)
+	}
+	if reqs[1]["listen_type"] != "playing_now" {
+		t.Errorf("正在播放的 listen_type = %v", reqs[1]["listen_type"])
+	}
+	if now := reqs[1]["payload"].([]interface{})[0].(map[string]interface{}); now["listened_at"] != nil {
+		t.Errorf("正在播放不应带 listened_at: %v", now)
+	}
+
+	tests := []struct {
+		status int
+		check  func(error) bool
+	}{
+		{http.StatusBadRequest, func(err error) bool { var r *scrobbleRejectedError; return errors.As(err, &r) }},
+		{http.StatusTooManyRequests, func(err error) bool { var r *scrobbleRejectedError; return err != nil && !errors.As(err, &r) }},
+		{http.StatusBadGateway, func(err error) bool { var r *scrobbleRejectedError; return err != nil && !errors.As(err, &r) }},
+	}
+	for _, tt := range tests {
+		lb.setStatus(tt.status)
+		if err := c.Submit(ctx, testLBToken, testListens[:1]); !tt.check(err) {
+			t.Errorf("HTTP %d: err = %v", tt.status, err)
+		}
+	}
+	if err := c.Submit(ctx, "wrong", testListens[:1]); !errors.Is(err, ErrScrobbleAuth) {
+		t.Errorf("HTTP 401: err = %v", err)
+	}
+}
+
+func TestLastFMClientSignsRequests(t *testing.T) {
+	_, lastfm := newScrobbleTest(t)
+	ctx := context.Background()
+	client, err := newScrobbleClient(models.ScrobbleLastFM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.(*lastFMClient)
+
+	sk, name, err := c.Login(ctx, "fm-user", "secret")
+	if err != nil || sk != testLastFMSK || name != "fm-user" {
+		t.Fatalf("Login = %q, %q, %v", sk, name, err)
+	}
+	if _, _, err := c.Login(ctx, "fm-user", "wrong"); !errors.Is(err, ErrScrobbleAuth) {
+		t.Errorf("密码错误 Login err = %v", err)
+	}
+
+	if err := c.Submit(ctx, sk, testListens); err != nil {
+		t.Fatal(err)
+	}
+	got := lastfm.submitted()
+	if len(got) != 1 {
+		t.Fatalf("track.scrobble 收到 %d 个请求", len(got))
+	}
+	form := got[0]
+	want := map[string]string{
+		"artist[0]": "陈奕迅", "track[0]": "十年", "album[0]": "黑白灰", "timestamp[0]": "1700000000", "duration[0]": "205",
+		"artist[1]": "Radiohead", "track[1]": "Airbag", "timestamp[1]": "1700000300",
+	}
+	for k, v := range want {
+		if form.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, form.Get(k), v)
+		}
+	}
+	if form.Has("album[1]") || form.Has("duration[1]") {
+		t.Errorf("空字段不应提交: %v", form)
+	}
+
+	// 密钥不一致时签名校验失败，属于配置错误，稍后重试而不是停用账号
+	c.secret = "other"
+	if err := c.Submit(ctx, sk, testListens); err == nil || errors.Is(err, ErrScrobbleAuth) {
+		t.Errorf("签名错误 err = %v", err)
+	}
+	c.secret = testLastFMSecret
+
+	tests := []struct {
+		status, code int
+		check        func(error) bool
+	}{
+		{0, 6, func(err error) bool { var r *scrobbleRejectedError; return errors.As(err, &r) }},
+		{0, 9, func(err error) bool { return errors.Is(err, ErrScrobbleAuth) }},
+		{0, 11, func(err error) bool {
+			var r *scrobbleRejectedError
+			return err != nil && !errors.As(err, &r) && !errors.Is(err, ErrScrobbleAuth)
+		}},
+		{http.StatusServiceUnavailable, 0, func(err error) bool { var r *scrobbleRejectedError; return err != nil && !errors.As(err, &r) }},
+	}
+	for _, tt := range tests {
+		lastfm.set(tt.status, tt.code)
+		if err := c.Submit(ctx, sk, testListens[:1]); !tt.check(err) {
+			t.Errorf("HTTP %d 错误码 %d: err = %v", tt.status, tt.code, err)
+		}
+	}
+}
+
+// queueJob 为账号排队一条已到期的记录
+func queueJob(t *testing.T, s *ScrobbleService, accountID uint, attempts int) models.ScrobbleJob {
+	t.Helper()
+	job := models.ScrobbleJob{AccountID: accountID, Artist: "陈奕迅", Track: "十年", DurationMs: 205000,
+		ListenedAt: time.Now().Add(-10 * time.Minute), DueAt: time.Now().Add(-time.Minute), Attempts: attempts}
+	jobs := []models.ScrobbleJob{job}
+	if err := s.repo.AddJobs(jobs); err != nil {
+		t.Fatal(err)
+	}
+	return jobs[0]
+}
+
+// findJob 读取队列中的记录，不存在时返回 false
+func findJob(t *testing.T, id uint) (models.ScrobbleJob, bool) {
+	t.Helper()
+	var jobs []models.ScrobbleJob
+	if err := models.DB.Where("id = ?", id).Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) == 0 {
+		return models.ScrobbleJob{}, false
+	}
+	return jobs[0], true
+}
+
+func linkTestAccounts(t *testing.T, s *ScrobbleService) (lb, lastfm *ScrobbleAccountInfo) {
+	t.Helper()
+	ctx := context.Background()
+	lb, err := s.Link(ctx, 1, models.ScrobbleListenBrainz, ScrobbleCredentials{Token: testLBToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastfm, err = s.Link(ctx, 1, models.ScrobbleLastFM, ScrobbleCredentials{Username: "fm-user", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.Username != "lb-user" || lastfm.Username != "fm-user" || lastfm.Token != testLastFMSK {
+		t.Fatalf("关联的账号 = %+v, %+v", lb.ScrobbleAccount, lastfm.ScrobbleAccount)
+	}
+	return lb, lastfm
+}
+
+func TestScrobbleFlushSubmitsDueJobs(t *testing.T) {
+	lbStub, lastfmStub := newScrobbleTest(t)
+	s := NewScrobbleService()
+	lb, lastfm := linkTestAccounts(t, s)
+	ctx := context.Background()
+
+	a := queueJob(t, s, lb.ID, 0)
+	b := queueJob(t, s, lastfm.ID, 3)
+	// 还没到期的记录不提交
+	later := []models.ScrobbleJob{{AccountID: lb.ID, Artist: "a", Track: "b", ListenedAt: time.Now(), DueAt: time.Now().Add(time.Hour)}}
+	if err := s.repo.AddJobs(later); err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := s.Flush(ctx)
+	if err != nil || sent != 2 {
+		t.Fatalf("Flush = %d, %v", sent, err)
+	}
+	if len(lbStub.submitted()) != 1 || len(lastfmStub.submitted()) != 1 {
+		t.Errorf("提交次数 listenbrainz = %d, lastfm = %d", len(lbStub.submitted()), len(lastfmStub.submitted()))
+	}
+	for _, id := range []uint{a.ID, b.ID} {
+		if _, ok := findJob(t, id); ok {
+			t.Errorf("提交成功的记录 %d 应从队列删除", id)
+		}
+	}
+	if _, ok := findJob(t, later[0].ID); !ok {
+		t.Error("未到期的记录不应提交")
+	}
+}
+
+func TestScrobbleFlushBacksOffOnServerError(t *testing.T) {
+	lbStub, _ := newScrobbleTest(t)
+	s := NewScrobbleService()
+	lb, _ := linkTestAccounts(t, s)
+	ctx := context.Background()
+
+	lbStub.setStatus(http.StatusBadGateway)
+	first := queueJob(t, s, lb.ID, 0)
+	retried := queueJob(t, s, lb.ID, 4)
+	before := time.Now()
+	if sent, err := s.Flush(ctx); err != nil || sent != 0 {
+		t.Fatalf("Flush = %d, %v", sent, err)
+	}
+
+	for _, tt := range []struct {
+		id       uint
+		attempts int
+		backoff  time.Duration
+	}{
+		{first.ID, 1, time.Minute},
+		{retried.ID, 5, 16 * time.Minute},
+	} {
+		job, ok := findJob(t, tt.id)
+		if !ok {
+			t.Fatalf("5xx 后记录 %d 不应被删除", tt.id)
+		}
+		if job.Attempts != tt.attempts || !strings.Contains(job.LastError, "HTTP 502") {
+			t.Errorf("记录 %d: attempts = %d, last_error = %q", tt.id, job.Attempts, job.LastError)
+		}
+		if due := job.DueAt.Sub(before); due < tt.backoff-time.Second || due > tt.backoff+5*time.Second {
+			t.Errorf("记录 %d 推迟了 %v, want %v", tt.id, due, tt.backoff)
+		}
+	}
+	if account, _ := s.repo.GetAccountByID(lb.ID); !account.Enabled {
+		t.Error("5xx 不应停用账号")
+	}
+	// 推迟后本轮不再到期
+	if sent, err := s.Flush(ctx); err != nil || sent != 0 || len(lbStub.submitted()) != 1 {
+		t.Errorf("重试前再次 Flush = %d, %v, 请求数 %d", sent, err, len(lbStub.submitted()))
+	}
+}
+
+func TestScrobbleFlushExpiresAfterMaxAttempts(t *testing.T) {
+	lbStub, _ := newScrobbleTest(t)
+	config.Config.Scrobble.MaxAttempts = 3
+	s := NewScrobbleService()
+	lb, _ := linkTestAccounts(t, s)
+
+	lbStub.setStatus(http.StatusServiceUnavailable)
+	last := queueJob(t, s, lb.ID, 2)
+	kept := queueJob(t, s, lb.ID, 1)
+	if _, err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findJob(t, last.ID); ok {
+		t.Error("达到最多提交次数的记录应被丢弃")
+	}
+	if job, ok := findJob(t, kept.ID); !ok || job.Attempts != 2 {
+		t.Errorf("未达到最多次数的记录 = %+v, %v", job, ok)
+	}
+}
+
+func TestScrobbleFlushDropsRejectedBatch(t *testing.T) {
+	lbStub, lastfmStub := newScrobbleTest(t)
+	s := NewScrobbleService()
+	lb, lastfm := linkTestAccounts(t, s)
+
+	lbStub.setStatus(http.StatusBadRequest)
+	lastfmStub.set(0, 6)
+	jobs := []models.ScrobbleJob{queueJob(t, s, lb.ID, 0), queueJob(t, s, lb.ID, 0), queueJob(t, s, lastfm.ID, 0)}
+	if sent, err := s.Flush(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("Flush = %d, %v", sent, err)
+	}
+	for _, j := range jobs {
+		if _, ok := findJob(t, j.ID); ok {
+			t.Errorf("被拒绝的记录 %d 应被丢弃", j.ID)
+		}
+	}
+	for _, id := range []uint{lb.ID, lastfm.ID} {
+		if account, _ := s.repo.GetAccountByID(id); !account.Enabled {
+			t.Errorf("数据被拒绝不应停用账号 %d", id)
+		}
+	}
+}
+
+func TestScrobbleFlushDisablesAccountOnAuthError(t *testing.T) {
+	newScrobbleTest(t)
+	s := NewScrobbleService()
+	lb, lastfm := linkTestAccounts(t, s)
+	ctx := context.Background()
+
+	// 远端令牌失效：ListenBrainz 返回 401，Last.fm 返回错误码 9
+	for _, id := range []uint{lb.ID, lastfm.ID} {
+		account, _ := s.repo.GetAccountByID(id)
+		account.Token = "revoked"
+		if err := s.repo.SaveAccount(account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs := []models.ScrobbleJob{queueJob(t, s, lb.ID, 0), queueJob(t, s, lastfm.ID, 0)}
+	if sent, err := s.Flush(ctx); err != nil || sent != 0 {
+		t.Fatalf("Flush = %d, %v", sent, err)
+	}
+	for _, id := range []uint{lb.ID, lastfm.ID} {
+		account, _ := s.repo.GetAccountByID(id)
+		if account.Enabled || account.LastError == "" {
+			t.Errorf("账号 %s 应被停用: %+v", account.Service, account)
+		}
+	}
+	for _, j := range jobs {
+		job, ok := findJob(t, j.ID)
+		if !ok || job.Attempts != 0 {
+			t.Errorf("停用账号的记录应原样保留: %+v, %v", job, ok)
+		}
+	}
+	if due, err := s.repo.DueJobs(time.Now(), 10); err != nil || len(due) != 0 {
+		t.Errorf("停用账号的记录不应到期: %v, %v", due, err)
+	}
+
+	// 重新关联后继续提交积压的记录
+	linkTestAccounts(t, s)
+	if sent, err := s.Flush(ctx); err != nil || sent != 2 {
+		t.Errorf("重新关联后 Flush = %d, %v", sent, err)
+	}
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"Music/models"
+	"Music/repositories"
+	"sort"
+	"time"
+)
+
+// 排行榜长度
+const (
+	defaultStatsTop = 10
+	maxStatsTop     = 100
+)
+
+// RankedItem 排行榜中的一项：曲目、艺人或专辑。没有规范化艺人信息的曲目按署名文本统计，此时 ID 为 0
+type RankedItem struct {
+	ID          uint   `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Artist      string `json:"artist,omitempty"` // 曲目和专辑的艺人
+	Plays       int64  `json:"plays"`
+	ListeningMs int64  `json:"listening_ms"`
+}
+
+// ListeningStats 一段时间内的收听统计，只计算从头开始的播放，收听时长按曲目时长累计
+type ListeningStats struct {
+	From        *time.Time   `json:"from"` // 为空表示不限开始时间
+	To          time.Time    `json:"to"`
+	Timezone    string       `json:"timezone"`
+	Plays       int64        `json:"plays"`
+	ListeningMs int64        `json:"listening_ms"`
+	Tracks      int          `json:"tracks"` // 听过的不同曲目数
+	Artists     int          `json:"artists"`
+	Albums      int          `json:"albums"`
+	TopTracks   []RankedItem `json:"top_tracks"`
+	TopArtists  []RankedItem `json:"top_artists"`
+	TopAlbums   []RankedItem `json:"top_albums"`
+	ByHour      [24]int64    `json:"by_hour"`    // 按当地时间的小时统计播放次数
+	ByWeekday   [7]int64     `json:"by_weekday"` // 0 为星期日
+	// 第一次播放落在这段时间内的曲目和艺人
+	NewTracks     int          `json:"new_tracks"`
+	NewArtists    int          `json:"new_artists"`
+	TopNewTracks  []RankedItem `json:"top_new_tracks"`
+	TopNewArtists []RankedItem `json:"top_new_artists"`
+}
+
+// DayStats 某一天的播放
+type DayStats struct {
+	Date        string `json:"date"` // YYYY-MM-DD
+	Plays       int64  `json:"plays"`
+	ListeningMs int64  `json:"listening_ms"`
+}
+
+// FirstPlay 一年中的第一次播放
+type FirstPlay struct {
+	TrackID  uint      `json:"track_id"`
+	Name     string    `json:"name"`
+	Artist   string    `json:"artist,omitempty"`
+	PlayedAt time.Time `json:"played_at"`
+}
+
+// YearInReview 年度回顾
+type YearInReview struct {
+	Year        int       `json:"year"`
+	Username    string    `json:"username"`
+	GeneratedAt time.Time `json:"generated_at"`
+	ListeningStats
+	ByMonth       [12]int64  `json:"by_month"` // 每月播放次数，0 为一月
+	ActiveDays    int        `json:"active_days"`
+	LongestStreak int        `json:"longest_streak"` // 连续有播放的最长天数
+	TopDay        *DayStats  `json:"top_day,omitempty"`
+	FirstPlay     *FirstPlay `json:"first_play,omitempty"`
+}
+
+type StatsService struct {
+	library *repositories.LibraryRepository
+	musics  *repositories.MusicRepository
+	users   *repositories.UserRepository
+}
+
+func NewStatsService() *StatsService {
+	return &StatsService{
+		library: &repositories.LibraryRepository{},
+		musics:  &repositories.MusicRepository{},
+		users:   &repositories.UserRepository{},
+	}
+}
+
+// ParseTimezone 解析 IANA 时区名，为空时使用服务器本地时区
+func ParseTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, &FieldError{Field: "tz", Reason: "不是有效的时区"}
+	}
+	return loc, nil
+}
+
+// StatsRange 计算统计区间 [from, to)。period 为 week / month / year（截至 now 的最近 7 / 30 / 365 天）
+// 或 all；指定 fromDate / toDate（YYYY-MM-DD，含当天）时忽略 period。from 为零值表示不限开始时间
+func StatsRange(period, fromDate, toDate string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	if fromDate != "" || toDate != "" {
+		var from time.Time
+		to := now
+		if fromDate != "" {
+			d, err := time.ParseInLocation("2006-01-02", fromDate, loc)
+			if err != nil {
+				return time.Time{}, time.Time{}, &FieldError{Field: "from", Reason: "须为 YYYY-MM-DD"}
+			}
+			from = d
+		}
+		if toDate != "" {
+			d, err := time.ParseInLocation("2006-01-02", toDate, loc)
+			if err != nil {
+				return time.Time{}, time.Time{}, &FieldError{Field: "to", Reason: "须为 YYYY-MM-DD"}
+			}
+			to = d.AddDate(0, 0, 1)
+		}
+		if !from.IsZero() && !from.Before(to) {
+			return time.Time{}, time.Time{}, &FieldError{Field: "to", Reason: "不能早于 from"}
+		}
+		return from, to, nil
+	}
+	switch period {
+	case "week":
+		return now.AddDate(0, 0, -7), now, nil
+	case "", "month":
+		return now.AddDate(0, 0, -30), now, nil
+	case "year":
+		return now.AddDate(0, 0, -365), now, nil
+	case "all":
+		return time.Time{}, now, nil
+	}
+	return time.Time{}, time.Time{}, &FieldError{Field: "period", Reason: "须为 week / month / year / all"}
+}
+
+// Stats 统计 [from, to) 内的收听情况，top 为排行榜长度
+func (s *StatsService) Stats(viewer repositories.Viewer, from, to time.Time, loc *time.Location, top int) (*ListeningStats, error) {
+	data, err := s.collect(viewer, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return data.summarize(from, to, loc, top), nil
+}
+
+// YearInReview 生成 year 年（按 loc 的日历年）的年度回顾
+func (s *StatsService) YearInReview(viewer repositories.Viewer, year int, loc *time.Location, top int) (*YearInReview, error) {
+	if year < 1970 || year > 9999 {
+		return nil, &FieldError{Field: "year", Reason: "不是有效的年份"}
+	}
+	user, err := s.users.GetByID(viewer.UserID)
+	if err != nil {
+		return nil, err
+	}
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(1, 0, 0)
+	data, err := s.collect(viewer, from, to)
+	if err != nil {
+		return nil, err
+	}
+	review := &YearInReview{
+		Year:           year,
+		Username:       user.Username,
+		GeneratedAt:    time.Now().In(loc),
+		ListeningStats: *data.summarize(from, to, loc, top),
+	}
+
+	days := map[string]*DayStats{}
+	var dates []string
+	for _, p := range data.plays {
+		t := data.tracks[p.MusicID]
+		local := p.PlayedAt.In(loc)
+		review.ByMonth[local.Month()-1]++
+		date := local.Format("2006-01-02")
+		d := days[date]
+		if d == nil {
+			d = &DayStats{Date: date}
+			days[date] = d
+			dates = append(dates, date)
+		}
+		d.Plays++
+		d.ListeningMs += t.Duration
+		if review.FirstPlay == nil {
+			review.FirstPlay = &FirstPlay{TrackID: t.ID, Name: t.Name, Artist: t.Singer, PlayedAt: local}
+		}
+	}
+	review.ActiveDays = len(dates)
+	streak := 0
+	var prev time.Time
+	for _, date := range dates {
+		day, _ := time.ParseInLocation("2006-01-02", date, loc)
+		if streak > 0 && prev.AddDate(0, 0, 1).Equal(day) {
+			streak++
+		} else {
+			streak = 1
+		}
+		prev = day
+		if streak > review.LongestStreak {
+			review.LongestStreak = streak
+		}
+		if d := days[date]; review.TopDay == nil || d.Plays > review.TopDay.Plays {
+			review.TopDay = d
+		}
+	}
+	return review, nil
+}
+
+// statsData 统计用的播放记录及相关曲目
+type statsData struct {
+	plays  []models.PlayEvent
+	tracks map[uint]*models.MusicInfo // 所有播放过的可见曲目，含署名
+	first  map[uint]models.PlayEvent  // 每首曲目第一次播放的记录
+}
+
+func (s *StatsService) collect(viewer repositories.Viewer, from, to time.Time) (*statsData, error) {
+	plays, err := s.library.PlaysBetween(viewer.UserID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	first, err := s.library.FirstPlays(viewer.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(first))
+	for id := range first {
+		ids = append(ids, id)
+	}
+	list, err := s.musics.ForViewer(viewer).FindByIDsWithCredits(ids)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make(map[uint]*models.MusicInfo, len(list))
+	for i := range list {
+		tracks[list[i].ID] = &list[i]
+	}
+	// 他人已改为私有的曲目不计入统计
+	visible := plays[:0]
+	for _, p := range plays {
+		if tracks[p.MusicID] != nil {
+			visible = append(visible, p)
+		}
+	}
+	return &statsData{plays: visible, tracks: tracks, first: first}, nil
+}
+
+// ranking 按键累计播放次数和时长
+type ranking map[interface{}]*RankedItem
+
+func (r ranking) add(key interface{}, item RankedItem, ms int64) {
+	it := r[key]
+	if it == nil {
+		it = &item
+		r[key] = it
+	}
+	it.Plays++
+	it.ListeningMs += ms
+}
+
+// top 播放次数最多的 n 项，次数相同时按时长、名称排序
+func (r ranking) top(n int) []RankedItem {
+	items := make([]RankedItem, 0, len(r))
+	for _, it := range r {
+		items = append(items, *it)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Plays != items[j].Plays {
+			return items[i].Plays > items[j].Plays
+		}
+		if items[i].ListeningMs != items[j].ListeningMs {
+			return items[i].ListeningMs > items[j].ListeningMs
+		}
+		return items[i].Name < items[j].Name
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+func (d *statsData) summarize(from, to time.Time, loc *time.Location, top int) *ListeningStats {
+	if top <= 0 || top > maxStatsTop {
+		top = defaultStatsTop
+	}
+	st := &ListeningStats{To: to, Timezone: loc.String()}
+	if !from.IsZero() {
+		st.From = &from
+	}
+
+	// 艺人第一次播放的记录，用于判断是否为新发现的艺人
+	artistFirst := map[interface{}]models.PlayEvent{}
+	for id, t := range d.tracks {
+		for _, key := range artistKeys(t) {
+			if f, ok := artistFirst[key]; !ok || playedBefore(d.first[id], f) {
+				artistFirst[key] = d.first[id]
+			}
+		}
+	}
+
+	inPeriod := make(map[uint]bool, len(d.plays))
+	for _, p := range d.plays {
+		inPeriod[p.ID] = true
+	}
+
+	tracks, artists, albums := ranking{}, ranking{}, ranking{}
+	newTracks, newArtists := ranking{}, ranking{}
+	for _, p := range d.plays {
+		t := d.tracks[p.MusicID]
+		ms := t.Duration
+		st.Plays++
+		st.ListeningMs += ms
+		local := p.PlayedAt.In(loc)
+		st.ByHour[local.Hour()]++
+		st.ByWeekday[local.Weekday()]++
+
+		tracks.add(t.ID, trackItem(t), ms)
+		if inPeriod[d.first[t.ID].ID] {
+			newTracks.add(t.ID, trackItem(t), ms)
+		}
+		for i, key := range artistKeys(t) {
+			item := artistItem(t, i)
+			artists.add(key, item, ms)
+			if inPeriod[artistFirst[key].ID] {
+				newArtists.add(key, item, ms)
+			}
+		}
+		if t.AlbumID != nil {
+			albums.add(*t.AlbumID, RankedItem{ID: *t.AlbumID, Name: t.Album, Artist: t.AlbumArtist}, ms)
+		}
+	}
+	st.Tracks, st.Artists, st.Albums = len(tracks), len(artists), len(albums)
+	st.NewTracks, st.NewArtists = len(newTracks), len(newArtists)
+	st.TopTracks = tracks.top(top)
+	st.TopArtists = artists.top(top)
+	st.TopAlbums = albums.top(top)
+	st.TopNewTracks = newTracks.top(top)
+	st.TopNewArtists = newArtists.top(top)
+	return st
+}
+
+// playedBefore a 是否早于 b，时间相同时按记录 ID
+func playedBefore(a, b models.PlayEvent) bool {
+	if !a.PlayedAt.Equal(b.PlayedAt) {
+		return a.PlayedAt.Before(b.PlayedAt)
+	}
+	return a.ID < b.ID
+}
+
+// mainCredits 曲目的主要艺人
+func mainCredits(t *models.MusicInfo) []models.TrackArtist {
+	var credits []models.TrackArtist
+	for _, c := range t.Credits {
+		if c.Role == models.RoleMain {
+			credits = append(credits, c)
+		}
+	}
+	return credits
+}
+
+// artistKeys 统计艺人用的键：有署名时为艺人 ID，否则为署名文本
+func artistKeys(t *models.MusicInfo) []interface{} {
+	credits := mainCredits(t)
+	if len(credits) == 0 {
+		if t.Singer == "" {
+			return nil
+		}
+		return []interface{}{t.Singer}
+	}
+	keys := make([]interface{}, 0, len(credits))
+	for _, c := range credits {
+		keys = append(keys, c.ArtistID)
+	}
+	return keys
+}
+
+// artistItem artistKeys(t)[i] 对应的排行项
+func artistItem(t *models.MusicInfo, i int) RankedItem {
+	credits := mainCredits(t)
+	if len(credits) == 0 {
+		return RankedItem{Name: t.Singer}
+	}
+	return RankedItem{ID: credits[i].ArtistID, Name: credits[i].Artist.Name}
+}
+
+func trackItem(t *models.MusicInfo) RankedItem {
+	return RankedItem{ID: t.ID, Name: t.Name, Artist: t.Singer}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"Music/audio_info"
+	"Music/models"
+	"Music/my_utils"
+	"Music/repositories"
+	"Music/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dhowden/tag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 写回标签的结果
+const (
+	TagsUpdated     = "updated"      // 已改写文件
+	TagsUnchanged   = "unchanged"    // 文件中的标签已与数据库一致
+	TagsWouldUpdate = "would_update" // 预演：将会改写
+	TagsUnsupported = "unsupported"  // 不是 MP3 / FLAC，跳过
+	TagsFailed      = "failed"
+)
+
+type TagSyncEntry struct {
+	MusicID   uint   `json:"music_id"`
+	Status    string `json:"status"`
+	OldSHA256 string `json:"old_sha256,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type TagSyncReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	DryRun     bool           `json:"dry_run"`
+	Summary    map[string]int `json:"summary"`
+	Entries    []TagSyncEntry `json:"entries"`
+}
+
+// TagService 把数据库中的曲目信息写回存储中的音频文件标签
+type TagService struct {
+	repo    *repositories.MusicRepository
+	artwork *ArtworkService
+}
+
+func NewTagService() *TagService {
+	return &TagService{
+		repo:    &repositories.MusicRepository{},
+		artwork: NewArtworkService(),
+	}
+}
+
+// SyncAll 检查全部曲目（不含 broken 记录），标签与数据库不一致的 MP3 / FLAC 文件重写后替换存储对象
+func (s *TagService) SyncAll(ctx context.Context, concurrency int, dryRun bool) (*TagSyncReport, error) {
+	report := &TagSyncReport{StartedAt: time.Now(), DryRun: dryRun, Summary: map[string]int{}}
+	rows, err := s.repo.ListAll()
+	if err != nil {
+		return nil, fmt.Errorf("读取音乐记录失败: %v", err)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan *models.MusicInfo)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range jobs {
+				entry := s.Sync(ctx, m, dryRun)
+				mu.Lock()
+				report.Entries = append(report.Entries, entry)
+				report.Summary[entry.Status]++
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range rows {
+		if !rows[i].Broken {
+			jobs <- &rows[i]
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(report.Entries, func(i, j int) bool { return report.Entries[i].MusicID < report.Entries[j].MusicID })
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// Sync 下载曲目的音频文件，标签与数据库不一致时重写并上传到新的按哈希命名的 key，
+// 更新记录的哈希、大小和对象 key；旧对象不再被引用时删除。去掉标签后的音频哈希不变
+func (s *TagService) Sync(ctx context.Context, m *models.MusicInfo, dryRun bool) TagSyncEntry {
+	entry := TagSyncEntry{MusicID: m.ID, OldSHA256: m.SHA256}
+	status, err := s.sync(ctx, m, dryRun)
+	entry.Status = status
+	if err != nil {
+		entry.Status, entry.Error = TagsFailed, err.Error()
+	}
+	if entry.Status == TagsUpdated {
+		entry.SHA256 = m.SHA256
+	}
+	return entry
+}
+
+func (s *TagService) sync(ctx context.Context, m *models.MusicInfo, dryRun bool) (string, error) {
+	oldKey := m.StorageKey()
+	obj, err := storage.Store.Get(ctx, oldKey, "")
+	if err != nil {
+		return "", fmt.Errorf("读取对象失败: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "tags-*")
+	if err != nil {
+		obj.Body.Close()
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	// 扩展名决定新对象 key 的后缀；按 ID 存储的旧记录没有扩展名，按编码补上
+	ext := filepath.Ext(oldKey)
+	if ext == "" && (m.Codec == "mp3" || m.Codec == "flac") {
+		ext = "." + m.Codec
+	}
+	path := filepath.Join(dir, "track"+ext)
+	err = downloadTo(path, obj.Body)
+	obj.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("下载对象失败: %v", err)
+	}
+
+	tags, err := s.tagsFor(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	if tagsInSync(path, tags) {
+		return TagsUnchanged, nil
+	}
+	// 预演时也改写临时文件，以便报告不支持的格式
+	if err := audio_info.WriteTags(path, tags); errors.Is(err, audio_info.ErrTagsUnsupported) {
+		return TagsUnsupported, nil
+	} else if err != nil {
+		return "", fmt.Errorf("写入标签失败: %v", err)
+	}
+	if dryRun {
+		return TagsWouldUpdate, nil
+	}
+
+	sum, audioHash, err := contentHashes(path)
+	if err != nil {
+		return "", err
+	}
+	newKey := AudioObjectKey(sum, path)
+	size, uploaded, location, err := uploadFile(ctx, newKey, path)
+	if err != nil {
+		return "", fmt.Errorf("上传音频失败: %v", err)
+	}
+	if uploaded != sum {
+		return "", errors.New("文件在上传过程中被修改")
+	}
+	m.Size, m.SHA256, m.AudioHash, m.ObjectKey, m.Location = size, sum, audioHash, newKey, location
+	if err := s.repo.UpdateFields(m, "Size", "SHA256", "AudioHash", "ObjectKey", "Location"); err != nil {
+		return "", err
+	}
+	if newKey != oldKey {
+		if refs, err := s.repo.CountByObjectKey(oldKey); err == nil && refs == 0 {
+			if err := storage.Store.Delete(ctx, oldKey); err != nil {
+				my_utils.Warn("删除对象 %s 失败: %v", oldKey, err)
+			}
+		}
+	}
+	return TagsUpdated, nil
+}
+
+// tagsFor 由数据库记录生成要写入的标签，封面从存储中读取
+func (s *TagService) tagsFor(ctx context.Context, m *models.MusicInfo) (audio_info.Tags, error) {
+	tags := audio_info.Tags{
+		Title:       m.Name,
+		Artist:      m.Singer,
+		AlbumArtist: m.AlbumArtist,
+		Album:       m.Album,
+		Genre:       m.Genre,
+		Track:       m.TrackNumber,
+		Disc:        m.DiscNumber,
+		Year:        m.Year,
+	}
+	if m.Cover == "" {
+		return tags, nil
+	}
+	obj, err := s.artwork.Open(ctx, m.Cover, "")
+	if err != nil {
+		return tags, fmt.Errorf("读取封面失败: %v", err)
+	}
+	defer obj.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(obj.Body, maxArtworkSize+1))
+	if err != nil {
+		return tags, fmt.Errorf("读取封面失败: %v", err)
+	}
+	tags.Picture = &audio_info.Picture{MIMEType: http.DetectContentType(data), Data: data}
+	return tags, nil
+}
+
+// tagsInSync 文件中的标签和封面是否已与 tags 一致；无法读取标签时视为不一致
+func tagsInSync(path string, tags audio_info.Tags) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return false
+	}
+	track, _ := m.Track()
+	disc, _ := m.Disc()
+	if strings.TrimSpace(m.Title()) != tags.Title || strings.TrimSpace(m.Artist()) != tags.Artist ||
+		strings.TrimSpace(m.AlbumArtist()) != tags.AlbumArtist || strings.TrimSpace(m.Album()) != tags.Album ||
+		strings.TrimSpace(m.Genre()) != tags.Genre || track != tags.Track || disc != tags.Disc || m.Year() != tags.Year {
+		return false
+	}
+	pic := m.Picture()
+	if tags.Picture == nil || pic == nil {
+		return tags.Picture == nil && pic == nil
+	}
+	return bytes.Equal(pic.Data, tags.Picture.Data)
+}
+
+func downloadTo(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"Music/models"
+	"Music/my_utils"
+	"Music/repositories"
+	"Music/storage"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"unicode/utf8"
+)
+
+// 文本字段的长度上限（字符）
+const maxTrackTextLen = 255
+
+var (
+	ErrEmptyUpdate = errors.New("没有要修改的字段")
+	ErrEmptyFilter = errors.New("筛选条件不能为空")
+	ErrNotOwner    = errors.New("只有曲目的所有者可以修改")
+)
+
+// FieldError 修改曲目时字段不合法
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("字段 %s %s", e.Field, e.Reason)
+}
+
+// TrackUpdate 管理接口可修改的曲目字段，nil 表示不修改；JSON 字段名与 MusicInfo 一致
+type TrackUpdate struct {
+	Name        *string `json:"name"`
+	Singer      *string `json:"singer"`
+	Album       *string `json:"album"`
+	AlbumArtist *string `json:"album_artist"`
+	TrackNumber *int    `json:"track_number"`
+	DiscNumber  *int    `json:"disc_number"`
+	Year        *int    `json:"year"`
+	Genre       *string `json:"genre"`
+	Cover       *string `json:"cover"` // 封面 ID，空字符串表示去掉封面
+	Visibility  *string `json:"visibility"`
+}
+
+// Empty 没有要修改的字段
+func (u *TrackUpdate) Empty() bool {
+	return u.Name == nil && u.Singer == nil && u.Album == nil && u.AlbumArtist == nil &&
+		u.TrackNumber == nil && u.DiscNumber == nil && u.Year == nil && u.Genre == nil && u.Cover == nil && u.Visibility == nil
+}
+
+// Validate 检查字段取值，封面需已保存在存储中
+func (u *TrackUpdate) Validate(ctx context.Context) error {
+	if u.Empty() {
+		return ErrEmptyUpdate
+	}
+	for _, f := range []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"name", u.Name, maxTrackTextLen},
+		{"singer", u.Singer, maxTrackTextLen},
+		{"album", u.Album, maxTrackTextLen},
+		{"album_artist", u.AlbumArtist, maxTrackTextLen},
+		{"genre", u.Genre, 64},
+	} {
+		if f.value == nil {
+			continue
+		}
+		*f.value = strings.TrimSpace(*f.value)
+		if utf8.RuneCountInString(*f.value) > f.max {
+			return &FieldError{f.name, fmt.Sprintf("不能超过 %d 个字符", f.max)}
+		}
+	}
+	if u.Name != nil && *u.Name == "" {
+		return &FieldError{"name", "不能为空"}
+	}
+	if u.TrackNumber != nil && (*u.TrackNumber < 0 || *u.TrackNumber > 999) {
+		return &FieldError{"track_number", "应在 0-999 之间"}
+	}
+	if u.DiscNumber != nil && (*u.DiscNumber < 0 || *u.DiscNumber > 999) {
+		return &FieldError{"disc_number", "应在 0-999 之间"}
+	}
+	if u.Year != nil && *u.Year != 0 && (*u.Year < 1000 || *u.Year > 9999) {
+		return &FieldError{"year", "应为四位年份或 0"}
+	}
+	if u.Visibility != nil {
+		if strings.TrimSpace(*u.Visibility) == "" {
+			return &FieldError{"visibility", "不能为空"}
+		}
+		v, err := ParseVisibility(*u.Visibility)
+		if err != nil {
+			return err
+		}
+		*u.Visibility = v
+	}
+	if u.Cover != nil && *u.Cover != "" {
+		*u.Cover = strings.ToLower(strings.TrimSpace(*u.Cover))
+		if !ValidArtworkID(*u.Cover) {
+			return &FieldError{"cover", "不是合法的封面 ID"}
+		}
+		if _, err := storage.Bucket("artwork").Stat(ctx, ArtworkKey(*u.Cover)); errors.Is(err, storage.ErrNotFound) {
+			return &FieldError{"cover", "封面不存在"}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOwner 没有所有者的曲目设为私有后谁也看不到，只能保持共享
+func (u *TrackUpdate) checkOwner(m *models.MusicInfo) error {
+	if u.Visibility != nil && *u.Visibility == models.VisibilityPrivate && m.OwnerID == nil {
+		return &FieldError{"visibility", fmt.Sprintf("曲目 %d 没有所有者，不能设为私有", m.ID)}
+	}
+	return nil
+}
+
+// apply 把修改写入 m，返回修改过的字段名；catalog 为 true 表示需要重新解析艺人和专辑
+func (u *TrackUpdate) apply(m *models.MusicInfo) (fields []string, catalog bool) {
+	setString := func(field string, dst *string, v *string, affectsCatalog bool) {
+		if v != nil && *dst != *v {
+			*dst = *v
+			fields = append(fields, field)
+			catalog = catalog || affectsCatalog
+		}
+	}
+	setInt := func(field string, dst *int, v *int, affectsCatalog bool) {
+		if v != nil && *dst != *v {
+			*dst = *v
+			fields = append(fields, field)
+			catalog = catalog || affectsCatalog
+		}
+	}
+	setString("Name", &m.Name, u.Name, false)
+	setString("Singer", &m.Singer, u.Singer, true)
+	setString("Album", &m.Album, u.Album, true)
+	setString("AlbumArtist", &m.AlbumArtist, u.AlbumArtist, true)
+	setInt("TrackNumber", &m.TrackNumber, u.TrackNumber, false)
+	setInt("DiscNumber", &m.DiscNumber, u.DiscNumber, false)
+	setInt("Year", &m.Year, u.Year, true)
+	setString("Genre", &m.Genre, u.Genre, true)
+	setString("Cover", &m.Cover, u.Cover, false)
+	setString("Visibility", &m.Visibility, u.Visibility, false)
+	return fields, catalog
+}
+
+// GetTrack 读取曲目及艺人署名
+func (s *MusicService) GetTrack(id uint) (*models.MusicInfo, error) {
+	return s.repo.GetWithCredits(id)
+}
+
+// SetVisibility 修改曲目的可见范围，只有所有者和管理员可以修改；viewer 看不到的曲目返回 gorm.ErrRecordNotFound
+func (s *MusicService) SetVisibility(viewer repositories.Viewer, id uint, visibility string) (*models.MusicInfo, error) {
+	m, err := s.repo.ForViewer(viewer).GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.All && (m.OwnerID == nil || *m.OwnerID != viewer.UserID) {
+		return nil, ErrNotOwner
+	}
+	update := TrackUpdate{Visibility: &visibility}
+	if err := update.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := update.checkOwner(m); err != nil {
+		return nil, err
+	}
+	if fields, _ := update.apply(m); len(fields) > 0 {
+		if err := s.repo.UpdateFields(m, fields...); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// EditResult 修改曲目的结果，Tags 为写回文件标签的结果（未要求写回时为空）
+type EditResult struct {
+	Tracks []models.MusicInfo
+	Tags   []TagSyncEntry
+}
+
+// UpdateMusic 修改一首曲目，艺人或专辑变化时重新关联；writeTags 为 true 时把修改写回音频文件标签
+func (s *MusicService) UpdateMusic(ctx context.Context, id uint, update TrackUpdate, writeTags bool) (*models.MusicInfo, *TagSyncEntry, error) {
+	result, err := s.BulkUpdate(ctx, repositories.TrackFilter{IDs: []uint{id}}, update, writeTags)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(result.Tracks) == 0 {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+	var entry *TagSyncEntry
+	if len(result.Tags) > 0 {
+		entry = &result.Tags[0]
+	}
+	track, err := s.repo.GetWithCredits(id)
+	return track, entry, err
+}
+
+// BulkUpdate 对符合条件的所有曲目应用同一修改（如专辑改名），在一个事务中写入；
+// writeTags 为 true 时随后逐个写回有变化的曲目的文件标签，写回失败不影响已提交的修改
+func (s *MusicService) BulkUpdate(ctx context.Context, filter repositories.TrackFilter, update TrackUpdate, writeTags bool) (*EditResult, error) {
+	if filter.Empty() {
+		return nil, ErrEmptyFilter
+	}
+	if err := update.Validate(ctx); err != nil {
+		return nil, err
+	}
+	tracks, err := s.repo.FindByFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tracks {
+		if err := update.checkOwner(&tracks[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	type change struct {
+		fields  []string
+		credits []models.TrackArtist
+		catalog bool
+	}
+	changes := make([]change, len(tracks))
+	oldAlbums := map[uint]bool{}
+	oldCovers := map[string]bool{}
+	for i := range tracks {
+		m := &tracks[i]
+		oldAlbum, oldCover := m.AlbumID, m.Cover
+		fields, catalog := update.apply(m)
+		if catalog {
+			credits, err := s.catalog.ResolveTrack(m)
+			if err != nil {
+				return nil, fmt.Errorf("曲目 %d 关联艺人和专辑失败: %v", m.ID, err)
+			}
+			// ResolveTrack 可能补全专辑艺人
+			fields = append(fields, "AlbumArtist", "AlbumID")
+			changes[i].credits = credits
+			if oldAlbum != nil && (m.AlbumID == nil || *m.AlbumID != *oldAlbum) {
+				oldAlbums[*oldAlbum] = true
+			}
+		}
+		if oldCover != "" && oldCover != m.Cover {
+			oldCovers[oldCover] = true
+		}
+		changes[i].fields, changes[i].catalog = fields, catalog
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.repo.WithTx(tx)
+		for i := range tracks {
+			if len(changes[i].fields) == 0 {
+				continue
+			}
+			if err := repo.UpdateFields(&tracks[i], changes[i].fields...); err != nil {
+				return err
+			}
+			if changes[i].catalog {
+				if err := repo.SetCredits(tracks[i].ID, changes[i].credits); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.release(ctx, oldAlbums, oldCovers)
+
+	result := &EditResult{Tracks: tracks}
+	if writeTags {
+		for i := range tracks {
+			if len(changes[i].fields) > 0 {
+				result.Tags = append(result.Tags, s.tags.Sync(ctx, &tracks[i], false))
+			}
+		}
+	}
+	return result, nil
+}
+
+// release 删除不再有曲目的专辑，以及不再被任何曲目或专辑引用的封面；失败只记录警告
+func (s *MusicService) release(ctx context.Context, albums map[uint]bool, covers map[string]bool) {
+	albumRepo := &repositories.AlbumRepository{}
+	for id := range albums {
+		n, err := s.repo.CountByAlbum(id)
+		if err != nil || n > 0 {
+			continue
+		}
+		album, err := albumRepo.GetByID(id)
+		if err != nil {
+			continue
+		}
+		if err := albumRepo.Delete(id); err != nil {
+			my_utils.Warn("删除空专辑 %d 失败: %v", id, err)
+			continue
+		}
+		if album.Cover != "" {
+			covers[album.Cover] = true
+		}
+	}
+	for cover := range covers {
+		tracks, err := s.repo.CountByCover(cover)
+		if err != nil || tracks > 0 {
+			continue
+		}
+		albums, err := albumRepo.CountByCover(cover)
+		if err != nil || albums > 0 {
+			continue
+		}
+		if err := s.artwork.Delete(ctx, cover); err != nil {
+			// 残留的封面可由 verify -delete-orphans 清理
+			my_utils.Warn("删除封面 %s 失败: %v", cover, err)
+		}
+	}
+}
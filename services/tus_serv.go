@@ -0,0 +1,346 @@
+package services
+
+import (
+	"Music/config"
+	"Music/my_utils"
+	"Music/repositories"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TusVersion 支持的 tus 协议版本
+const TusVersion = "1.0.0"
+
+// 未完成的上传超过该时长没有新数据即被清理
+const tusExpiration = 24 * time.Hour
+
+var (
+	ErrUploadNotFound = errors.New("上传不存在")
+	ErrOffsetMismatch = errors.New("Upload-Offset 与已接收的长度不一致")
+	ErrUploadTooLarge = errors.New("数据超出 Upload-Length")
+	ErrUploadLocked   = errors.New("上传正在被另一个请求写入")
+	ErrUploadComplete = errors.New("上传已完成")
+)
+
+var tusIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// TusUpload 一次可续传上传的状态，保存在 <dir>/<id>.info
+type TusUpload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	OwnerID   uint              `json:"owner_id,omitempty"` // 创建上传的用户，入库后为曲目的所有者
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Completed bool              `json:"completed"`
+	Result    *UploadResult     `json:"result,omitempty"` // 上传完成并入库后的结果
+}
+
+// Filename 客户端在 Upload-Metadata 中提交的文件名
+func (u *TusUpload) Filename() string {
+	name := u.Metadata["filename"]
+	if name == "" {
+		name = u.Metadata["name"]
+	}
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return "upload"
+	}
+	return name
+}
+
+// OwnedBy 上传是否由 v 创建，管理员可以访问全部上传
+func (u *TusUpload) OwnedBy(v repositories.Viewer) bool {
+	return v.All || u.OwnerID == v.UserID
+}
+
+// TusService 把上传中的数据暂存在本地目录，全部收到后交给上传流程入库
+type TusService struct {
+	upload *UploadService
+	locks  sync.Map // id -> *sync.Mutex
+}
+
+func NewTusService() *TusService {
+	return &TusService{upload: NewUploadService()}
+}
+
+// dir 暂存目录，取自 server.tus_dir
+func (s *TusService) dir() string {
+	if dir := config.Config.Server.TusDir; dir != "" {
+		return dir
+	}
+	return "data/tus"
+}
+
+func (s *TusService) infoPath(id string) string  { return filepath.Join(s.dir(), id+".info") }
+func (s *TusService) dataPath(id string) string  { return filepath.Join(s.dir(), id+".bin") }
+func (s *TusService) ingestDir(id string) string { return filepath.Join(s.dir(), id+".ingest") }
+
+// ParseTusMetadata 解析 Upload-Metadata 请求头（逗号分隔的 "key base64(value)"）
+func ParseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("无效的 Upload-Metadata: %q", pair)
+		}
+		value := ""
+		if len(parts) == 2 {
+			b, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("无效的 Upload-Metadata: %q", pair)
+			}
+			value = string(b)
+		}
+		meta[parts[0]] = value
+	}
+	return meta, nil
+}
+
+// EncodeTusMetadata 生成 Upload-Metadata 响应头
+func EncodeTusMetadata(meta map[string]string) string {
+	pairs := make([]string, 0, len(meta))
+	for k, v := range meta {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Create 创建上传并分配 ID，Upload-Metadata 中的 visibility 为入库后曲目的可见范围
+func (s *TusService) Create(length int64, meta map[string]string, ownerID uint) (*TusUpload, error) {
+	if _, err := ParseOwnership(ownerID, meta["visibility"]); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir(), 0755); err != nil {
+		return nil, err
+	}
+	s.cleanupExpired()
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	u := &TusUpload{ID: hex.EncodeToString(b), Length: length, Metadata: meta, OwnerID: ownerID, CreatedAt: now, UpdatedAt: now}
+	f, err := os.OpenFile(s.dataPath(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := s.save(u); err != nil {
+		os.Remove(s.dataPath(u.ID))
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get 读取上传状态，未完成时 Offset 取暂存文件的实际长度
+func (s *TusService) Get(id string) (*TusUpload, error) {
+	if !tusIDRe.MatchString(id) {
+		return nil, ErrUploadNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var u TusUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	if !u.Completed {
+		fi, err := os.Stat(s.dataPath(id))
+		if err != nil {
+			return nil, ErrUploadNotFound
+		}
+		u.Offset = fi.Size()
+	}
+	return &u, nil
+}
+
+// lock 取得上传的写锁，已被其他请求持有时返回 ErrUploadLocked
+func (s *TusService) lock(id string) (func(), error) {
+	v, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, ErrUploadLocked
+	}
+	return mu.Unlock, nil
+}
+
+// Append 从 offset 处追加数据；收到全部数据后入库，返回更新后的状态。
+// 入库失败时上传保持未完成，数据保留，在最终 offset 处发送空的 PATCH 即可重新入库
+func (s *TusService) Append(id string, offset int64, r io.Reader) (*TusUpload, error) {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Completed {
+		return u, ErrUploadComplete
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	remaining := u.Length - u.Offset
+	// 连接中断时保留已写入的部分，客户端可从新的 offset 继续
+	n, copyErr := io.Copy(f, io.LimitReader(r, remaining))
+	if copyErr == nil && n == remaining {
+		if extra, _ := r.Read(make([]byte, 1)); extra > 0 {
+			f.Truncate(u.Offset)
+			f.Close()
+			return u, ErrUploadTooLarge
+		}
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	u.Offset += n
+	u.UpdatedAt = time.Now()
+	if copyErr != nil {
+		s.save(u)
+		return u, copyErr
+	}
+	if u.Offset == u.Length {
+		s.complete(u)
+	}
+	return u, s.save(u)
+}
+
+// complete 以原始文件名硬链接到单独的目录中入库，暂存数据留在原处，入库期间 HEAD 仍能读到完整的 offset；
+// 入库成功后删除暂存数据，失败时上传保持未完成，客户端可以重试或终止
+func (s *TusService) complete(u *TusUpload) {
+	dir := s.ingestDir(u.ID)
+	path := filepath.Join(dir, u.Filename())
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		u.Result = &UploadResult{File: u.Filename(), Status: ImportFailed, Error: err.Error()}
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err := linkOrCopy(s.dataPath(u.ID), path); err != nil {
+		u.Result = &UploadResult{File: u.Filename(), Status: ImportFailed, Error: err.Error()}
+		return
+	}
+	overrides := UploadOverrides{}
+	for _, field := range UploadOverrideFields {
+		overrides[field] = u.Metadata[field]
+	}
+	result := s.upload.Ingest(path, overrides, "", Ownership{OwnerID: u.OwnerID, Visibility: u.Metadata["visibility"]})
+	u.Result = &result
+	if result.Status == ImportFailed {
+		return
+	}
+	// 先记下已完成再删除数据，并发的 HEAD 不会遇到既未完成又没有数据的状态
+	u.Completed = true
+	if err := s.save(u); err != nil {
+		my_utils.Error("保存上传 %s 的状态失败: %v", u.ID, err)
+		return
+	}
+	os.Remove(s.dataPath(u.ID))
+	s.locks.Delete(u.ID)
+}
+
+// linkOrCopy 把 src 硬链接到 dst，文件系统不支持硬链接时复制
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Delete 终止上传并删除暂存数据；正在写入的上传返回 ErrUploadLocked
+func (s *TusService) Delete(id string) error {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+// remove 删除上传的全部文件，调用方需持有写锁
+func (s *TusService) remove(id string) {
+	os.Remove(s.dataPath(id))
+	os.RemoveAll(s.ingestDir(id))
+	os.Remove(s.infoPath(id))
+	s.locks.Delete(id)
+}
+
+func (s *TusService) save(u *TusUpload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(u.ID))
+}
+
+// cleanupExpired 删除长时间没有更新的上传（包括已完成的上传记录）
+func (s *TusService) cleanupExpired() {
+	entries, err := os.ReadDir(s.dir())
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".info")
+		if !ok {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || time.Since(fi.ModTime()) < tusExpiration {
+			continue
+		}
+		unlock, err := s.lock(id)
+		if err != nil {
+			continue
+		}
+		s.remove(id)
+		unlock()
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"Music/config"
+	"Music/models"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// UploadOverrides 上传时指定的曲目信息，非空字段覆盖标签和文件名中识别出的值
+type UploadOverrides map[string]string
+
+// UploadOverrideFields 可以覆盖的字段，与路径模板的占位符一致
+var UploadOverrideFields = []string{"title", "artist", "albumartist", "album", "track", "disc", "year", "genre"}
+
+type UploadResult struct {
+	File        string            `json:"file"`
+	Status      string            `json:"status"` // created / duplicate / failed
+	Track       *models.MusicInfo `json:"track,omitempty"`
+	DuplicateOf uint              `json:"duplicate_of,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Sources     map[string]string `json:"sources,omitempty"`
+}
+
+// Ownership 上传曲目的所有者和可见范围
+type Ownership struct {
+	OwnerID    uint   // 0 表示没有所有者（使用引导令牌上传）
+	Visibility string // 为空时为 shared
+}
+
+// ParseVisibility 校验可见范围，为空时为 shared
+func ParseVisibility(v string) (string, error) {
+	switch v = strings.ToLower(strings.TrimSpace(v)); v {
+	case "":
+		return models.VisibilityShared, nil
+	case models.VisibilityShared, models.VisibilityPrivate:
+		return v, nil
+	}
+	return "", &FieldError{"visibility", "应为 shared 或 private"}
+}
+
+// ParseOwnership 校验可见范围；私有曲目只有所有者能看到，没有用户身份时不能上传
+func ParseOwnership(ownerID uint, visibility string) (Ownership, error) {
+	v, err := ParseVisibility(visibility)
+	if err != nil {
+		return Ownership{}, err
+	}
+	if v == models.VisibilityPrivate && ownerID == 0 {
+		return Ownership{}, &FieldError{"visibility", "需要以用户身份登录才能上传私有曲目"}
+	}
+	return Ownership{OwnerID: ownerID, Visibility: v}, nil
+}
+
+type UploadService struct {
+	music   *MusicService
+	artwork *ArtworkService
+}
+
+func NewUploadService() *UploadService {
+	return &UploadService{
+		music:   NewMusicService(),
+		artwork: NewArtworkService(),
+	}
+}
+
+// SaveCover 保存随上传提交的封面图片，返回封面 ID
+func (s *UploadService) SaveCover(ctx context.Context, data []byte) (string, error) {
+	return s.artwork.Save(ctx, &Artwork{Data: data, Source: "upload"})
+}
+
+// Ingest 走与批量导入相同的流程入库一个已保存到本地的上传文件，
+// path 的文件名应为客户端提交的原始文件名，以便按路径模板识别曲目信息
+func (s *UploadService) Ingest(path string, overrides UploadOverrides, cover string, own Ownership) UploadResult {
+	result := UploadResult{File: filepath.Base(path)}
+	if !isAudioFile(path) {
+		result.Status, result.Error = ImportFailed, "不支持的文件类型"
+		return result
+	}
+	templates, err := CompilePathTemplates(config.Config.Import.Templates)
+	if err != nil {
+		result.Status, result.Error = ImportFailed, err.Error()
+		return result
+	}
+	meta, err := ReadTrackMeta(path, filepath.Dir(path), templates)
+	if err != nil {
+		result.Status, result.Error = ImportFailed, "读取曲目信息失败: "+err.Error()
+		return result
+	}
+	for _, field := range UploadOverrideFields {
+		meta.Override(field, overrides[field])
+	}
+	result.Sources = meta.Sources
+
+	info := meta.MusicInfo()
+	info.Cover = cover
+	if own, err = ParseOwnership(own.OwnerID, own.Visibility); err != nil {
+		result.Status, result.Error = ImportFailed, err.Error()
+		return result
+	}
+	info.Visibility = own.Visibility
+	if own.OwnerID != 0 {
+		info.OwnerID = &own.OwnerID
+	}
+	err = s.music.CreateMusic(info, path)
+	var dup *DuplicateError
+	switch {
+	case errors.As(err, &dup):
+		result.Status, result.DuplicateOf, result.Error = ImportDuplicate, dup.ExistingID, dup.Error()
+	case err != nil:
+		result.Status, result.Error = ImportFailed, err.Error()
+	default:
+		result.Status, result.Track = ImportCreated, info
+	}
+	return result
+}
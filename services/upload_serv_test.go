@@ -0,0 +1,69 @@
+package services
+
+import (
+	"Music/models"
+	"Music/repositories"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseOwnership(t *testing.T) {
+	cases := []struct {
+		owner      uint
+		visibility string
+		want       string
+		ok         bool
+	}{
+		{1, "", models.VisibilityShared, true},
+		{1, " Private ", models.VisibilityPrivate, true},
+		{0, "shared", models.VisibilityShared, true},
+		{0, "", models.VisibilityShared, true},
+		{0, "private", "", false},
+		{1, "public", "", false},
+	}
+	for _, c := range cases {
+		own, err := ParseOwnership(c.owner, c.visibility)
+		var fe *FieldError
+		if c.ok {
+			if err != nil || own.Visibility != c.want || own.OwnerID != c.owner {
+				t.Errorf("ParseOwnership(%d, %q) = %+v, %v", c.owner, c.visibility, own, err)
+			}
+		} else if !errors.As(err, &fe) || fe.Field != "visibility" {
+			t.Errorf("ParseOwnership(%d, %q) err = %v, want visibility 字段错误", c.owner, c.visibility, err)
+		}
+	}
+}
+
+// 使用引导令牌时没有用户身份，不能留下谁也看不到的私有曲目或没有所有者的歌单
+func TestNoPrincipalCannotCreateOwnerlessPrivateData(t *testing.T) {
+	useTestDB(t)
+	admin := repositories.Viewer{All: true}
+
+	track := models.MusicInfo{Name: "a", Location: "file:///a", ObjectKey: "42", Visibility: models.VisibilityShared}
+	if err := models.DB.Create(&track).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := NewMusicService()
+	var fe *FieldError
+	if _, err := s.SetVisibility(admin, track.ID, "private"); !errors.As(err, &fe) {
+		t.Errorf("SetVisibility err = %v, want 字段错误", err)
+	}
+	private := models.VisibilityPrivate
+	filter := repositories.TrackFilter{IDs: []uint{track.ID}}
+	if _, err := s.BulkUpdate(context.Background(), filter, TrackUpdate{Visibility: &private}, false); !errors.As(err, &fe) {
+		t.Errorf("BulkUpdate err = %v, want 字段错误", err)
+	}
+	var got models.MusicInfo
+	if err := models.DB.First(&got, track.ID).Error; err != nil || got.Visibility != models.VisibilityShared {
+		t.Errorf("曲目 = %+v, %v, 应保持共享", got, err)
+	}
+
+	playlists := NewPlaylistService()
+	if _, err := playlists.Create(admin, "p", ""); !errors.Is(err, ErrPlaylistForbidden) {
+		t.Errorf("Create err = %v, want ErrPlaylistForbidden", err)
+	}
+	if n := countRows(t, &models.Playlist{}); n != 0 {
+		t.Errorf("歌单数 = %d, want 0", n)
+	}
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"Music/models"
+	"Music/repositories"
+	"Music/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 一致性问题类型
+const (
+	IssueOrphanObject     = "orphan_object"     // 存储中有音频对象但没有对应记录
+	IssueStaleStaging     = "stale_staging"     // 导入中途失败残留的暂存对象
+	IssueDanglingRow      = "dangling_row"      // 记录的 Location 为空或对象不存在
+	IssueSizeMismatch     = "size_mismatch"     // 对象大小与记录不一致
+	IssueChecksumMismatch = "checksum_mismatch" // 对象内容哈希与记录不一致
+	IssueOrphanArtwork    = "orphan_artwork"    // 没有曲目或专辑引用的封面
+)
+
+// 暂存对象超过该时长仍存在即视为残留；新写入的音频对象在该时长内没有记录也不视为孤儿，
+// 入库时先复制对象再写入记录，检查可能恰好发生在两者之间
+const staleStagingAge = time.Hour
+
+// VerifyOptions 一致性检查选项，修复选项均默认关闭
+type VerifyOptions struct {
+	Checksum      bool   // 下载对象重新计算 SHA-256（较慢）
+	DeleteOrphans bool   // 删除孤儿对象、残留暂存对象和无人引用的封面
+	SourceDir     string // 从该目录查找原文件重新上传
+	MarkBroken    bool   // 无法修复的记录标记为 broken
+}
+
+type VerifyIssue struct {
+	Kind        string `json:"kind"`
+	Key         string `json:"key,omitempty"`
+	MusicID     uint   `json:"music_id,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	Repair      string `json:"repair,omitempty"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+type VerifyReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Rows       int            `json:"rows"`
+	Objects    int            `json:"objects"`
+	Issues     []VerifyIssue  `json:"issues"`
+	Summary    map[string]int `json:"summary"`
+}
+
+// Text 生成给人看的摘要
+func (r *VerifyReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "检查了 %d 条记录、%d 个对象，耗时 %s\n", r.Rows, r.Objects, r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+	if len(r.Issues) == 0 {
+		b.WriteString("未发现问题\n")
+		return b.String()
+	}
+	kinds := make([]string, 0, len(r.Summary))
+	for k := range r.Summary {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		fmt.Fprintf(&b, "  %-18s %d\n", k, r.Summary[k])
+	}
+	repaired, failed := 0, 0
+	for _, issue := range r.Issues {
+		if issue.RepairError != "" {
+			failed++
+		} else if issue.Repair != "" {
+			repaired++
+		}
+	}
+	fmt.Fprintf(&b, "已修复 %d 个，修复失败 %d 个\n", repaired, failed)
+	return b.String()
+}
+
+type VerifyService struct {
+	repo   *repositories.MusicRepository
+	albums *repositories.AlbumRepository
+}
+
+func NewVerifyService() *VerifyService {
+	return &VerifyService{
+		repo:   &repositories.MusicRepository{},
+		albums: &repositories.AlbumRepository{},
+	}
+}
+
+// Verify 比对数据库记录与存储中的对象，按选项修复发现的问题
+func (s *VerifyService) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	report := &VerifyReport{StartedAt: time.Now(), Summary: map[string]int{}}
+	rows, err := s.repo.ListAll()
+	if err != nil {
+		return nil, fmt.Errorf("读取音乐记录失败: %v", err)
+	}
+	objects, err := storage.Store.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("列出存储对象失败: %v", err)
+	}
+	report.Rows, report.Objects = len(rows), len(objects)
+
+	var source *sourceIndex
+	if opts.SourceDir != "" {
+		source = newSourceIndex(opts.SourceDir)
+	}
+
+	byKey := make(map[string]storage.ObjectInfo, len(objects))
+	for _, o := range objects {
+		byKey[o.Key] = o
+	}
+	rowKeys := make(map[string]bool, len(rows))
+	for i := range rows {
+		m := &rows[i]
+		key := m.StorageKey()
+		rowKeys[key] = true
+		issue, ok := s.checkRow(ctx, m, byKey, opts)
+		if !ok {
+			continue
+		}
+		s.repairRow(ctx, m, &issue, source, opts)
+		report.add(issue)
+	}
+
+	for _, o := range objects {
+		// 只检查音频和暂存对象；封面与音频共用一个桶时由 verifyArtwork 检查，其他对象不归这里管理
+		if rowKeys[o.Key] || !isAudioLayoutKey(o.Key) {
+			continue
+		}
+		if time.Since(o.LastModified) < staleStagingAge {
+			// 可能是正在进行的导入
+			continue
+		}
+		issue := VerifyIssue{Kind: IssueOrphanObject, Key: o.Key, Detail: fmt.Sprintf("%d 字节", o.Size)}
+		if strings.HasPrefix(o.Key, StagingPrefix) {
+			issue.Kind = IssueStaleStaging
+		}
+		if opts.DeleteOrphans {
+			issue.Repair = "deleted"
+			if err := storage.Store.Delete(ctx, o.Key); err != nil {
+				issue.RepairError = err.Error()
+			}
+		}
+		report.add(issue)
+	}
+
+	if err := s.verifyArtwork(ctx, rows, report, opts); err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// isAudioLayoutKey key 是否属于音频的存储布局：audio/ 和 staging/ 下的对象，以及按 ID 存储的旧对象
+func isAudioLayoutKey(key string) bool {
+	if strings.HasPrefix(key, AudioPrefix) || strings.HasPrefix(key, StagingPrefix) {
+		return true
+	}
+	_, err := strconv.ParseUint(key, 10, 64)
+	return err == nil
+}
+
+// verifyArtwork 查找没有被任何曲目或专辑引用的封面（包括其缩略图）
+func (s *VerifyService) verifyArtwork(ctx context.Context, rows []models.MusicInfo, report *VerifyReport, opts VerifyOptions) error {
+	referenced := map[string]bool{}
+	for _, m := range rows {
+		if m.Cover != "" {
+			referenced[m.Cover] = true
+		}
+	}
+	covers, err := s.albums.Covers()
+	if err != nil {
+		return fmt.Errorf("读取专辑封面失败: %v", err)
+	}
+	for _, c := range covers {
+		referenced[c] = true
+	}
+	bucket := storage.Bucket("artwork")
+	objects, err := bucket.List(ctx, ArtworkPrefix)
+	if err != nil {
+		return fmt.Errorf("列出封面失败: %v", err)
+	}
+	for _, o := range objects {
+		id := strings.TrimPrefix(o.Key, ArtworkPrefix)
+		if len(id) > 64 {
+			id = id[:64]
+		}
+		if referenced[id] {
+			continue
+		}
+		issue := VerifyIssue{Kind: IssueOrphanArtwork, Key: o.Key, Detail: fmt.Sprintf("%d 字节", o.Size)}
+		if opts.DeleteOrphans {
+			issue.Repair = "deleted"
+			if err := bucket.Delete(ctx, o.Key); err != nil {
+				issue.RepairError = err.Error()
+			}
+		}
+		report.add(issue)
+	}
+	return nil
+}
+
+func (r *VerifyReport) add(issue VerifyIssue) {
+	r.Issues = append(r.Issues, issue)
+	r.Summary[issue.Kind]++
+}
+
+// checkRow 检查单条记录，ok 为 false 表示没有问题
+func (s *VerifyService) checkRow(ctx context.Context, m *models.MusicInfo, objects map[string]storage.ObjectInfo, opts VerifyOptions) (VerifyIssue, bool) {
+	key := m.StorageKey()
+	issue := VerifyIssue{Key: key, MusicID: m.ID}
+	obj, exists := objects[key]
+	switch {
+	case m.Location == "":
+		issue.Kind, issue.Detail = IssueDanglingRow, "Location 为空"
+	case !exists:
+		issue.Kind, issue.Detail = IssueDanglingRow, "对象不存在"
+	case m.Size > 0 && obj.Size != m.Size:
+		issue.Kind, issue.Detail = IssueSizeMismatch, fmt.Sprintf("记录 %d 字节，对象 %d 字节", m.Size, obj.Size)
+	case opts.Checksum && m.SHA256 != "":
+		sum, err := objectSHA256(ctx, key)
+		if err != nil {
+			issue.Kind, issue.Detail = IssueChecksumMismatch, "读取对象失败: "+err.Error()
+		} else if sum != m.SHA256 {
+			issue.Kind, issue.Detail = IssueChecksumMismatch, "对象哈希 "+sum
+		} else {
+			return issue, false
+		}
+	default:
+		return issue, false
+	}
+	return issue, true
+}
+
+// repairRow 优先从源目录重新上传，找不到原文件时按选项标记为 broken
+func (s *VerifyService) repairRow(ctx context.Context, m *models.MusicInfo, issue *VerifyIssue, source *sourceIndex, opts VerifyOptions) {
+	if source != nil {
+		path, err := source.find(m)
+		if err == nil {
+			issue.Repair = "reuploaded from " + path
+			if err := s.reupload(ctx, m, path); err != nil {
+				issue.RepairError = err.Error()
+			}
+			return
+		}
+		if !opts.MarkBroken {
+			issue.Repair, issue.RepairError = "reupload", err.Error()
+			return
+		}
+	}
+	if opts.MarkBroken && !m.Broken {
+		issue.Repair = "marked broken"
+		if err := s.repo.Update(m.ID, map[string]interface{}{"Broken": true}); err != nil {
+			issue.RepairError = err.Error()
+		}
+	}
+}
+
+func (s *VerifyService) reupload(ctx context.Context, m *models.MusicInfo, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	location, err := storage.Store.Put(ctx, m.StorageKey(), io.TeeReader(f, h), fi.Size(), storage.ContentType(path))
+	if err != nil {
+		return err
+	}
+	return s.repo.Update(m.ID, map[string]interface{}{
+		"Location": location,
+		"Size":     fi.Size(),
+		"SHA256":   hex.EncodeToString(h.Sum(nil)),
+		"Broken":   false,
+	})
+}
+
+func objectSHA256(ctx context.Context, key string) (string, error) {
+	obj, err := storage.Store.Get(ctx, key, "")
+	if err != nil {
+		return "", err
+	}
+	defer obj.Body.Close()
+	return hashReader(obj.Body)
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sourceIndex 源目录中的音频文件，哈希按需计算
+type sourceIndex struct {
+	dir    string
+	files  []sourceFile
+	loaded bool
+	err    error
+}
+
+type sourceFile struct {
+	path   string
+	size   int64
+	sha256 string
+}
+
+func newSourceIndex(dir string) *sourceIndex {
+	return &sourceIndex{dir: dir}
+}
+
+func (idx *sourceIndex) load() error {
+	if idx.loaded {
+		return idx.err
+	}
+	idx.loaded = true
+	idx.err = filepath.Walk(idx.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		idx.files = append(idx.files, sourceFile{path: path, size: info.Size()})
+		return nil
+	})
+	return idx.err
+}
+
+// find 按内容哈希匹配原文件；记录没有哈希时按文件名包含歌曲名匹配
+func (idx *sourceIndex) find(m *models.MusicInfo) (string, error) {
+	if err := idx.load(); err != nil {
+		return "", err
+	}
+	if m.SHA256 != "" {
+		for i := range idx.files {
+			f := &idx.files[i]
+			if m.Size > 0 && f.size != m.Size {
+				continue
+			}
+			if f.sha256 == "" {
+				file, err := os.Open(f.path)
+				if err != nil {
+					continue
+				}
+				f.sha256, _ = hashReader(file)
+				file.Close()
+			}
+			if f.sha256 == m.SHA256 {
+				return f.path, nil
+			}
+		}
+		return "", errors.New("源目录中没有哈希匹配的文件")
+	}
+	var matches []string
+	for _, f := range idx.files {
+		base := strings.TrimSuffix(filepath.Base(f.path), filepath.Ext(f.path))
+		if m.Name != "" && strings.Contains(base, m.Name) && (m.Album == "" || strings.Contains(f.path, m.Album)) {
+			matches = append(matches, f.path)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", errors.New("源目录中没有文件名匹配的文件")
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("源目录中有 %d 个文件名匹配的文件，无法确定", len(matches))
+	}
+}
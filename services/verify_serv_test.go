@@ -0,0 +1,154 @@
+package services
+
+import (
+	"Music/config"
+	"Music/migrations"
+	"Music/models"
+	"Music/storage"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestDB 使用临时目录中的 SQLite 并执行全部迁移
+func useTestDB(t *testing.T) {
+	t.Helper()
+	oldDB := config.Config.Database
+	t.Cleanup(func() { config.Config.Database = oldDB })
+	config.Config.Database = config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "music.db")}
+	models.Init()
+	if _, err := migrations.Up(models.DB, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if db, err := models.DB.DB(); err == nil {
+			db.Close()
+		}
+	})
+}
+
+// useStorageConfig 按 cfg 初始化全局存储；结束后换回没有命名桶的存储，避免影响其他测试
+func useStorageConfig(t *testing.T, cfg config.StorageConfig) {
+	t.Helper()
+	oldCfg, oldStore := config.Config.Storage, storage.Store
+	reset := config.StorageConfig{Driver: "local", Local: config.LocalStorageConfig{Root: t.TempDir(), Secret: "test"}}
+	t.Cleanup(func() {
+		config.Config.Storage = reset
+		if err := storage.Init(); err != nil {
+			t.Error(err)
+		}
+		config.Config.Storage, storage.Store = oldCfg, oldStore
+	})
+	config.Config.Storage = cfg
+	if err := storage.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func putObject(t *testing.T, s storage.Storage, key, data string) {
+	t.Helper()
+	if _, err := s.Put(context.Background(), key, strings.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backdate 把本地存储中的对象改为两小时前写入
+func backdate(t *testing.T, root, key string) {
+	t.Helper()
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(key)), old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyIgnoresNamedLocalBuckets(t *testing.T) {
+	useTestDB(t)
+	// 封面桶的目录位于默认桶的根目录下
+	root := t.TempDir()
+	useStorageConfig(t, config.StorageConfig{
+		Driver:  "local",
+		Local:   config.LocalStorageConfig{Root: root, Secret: "test"},
+		Buckets: map[string]string{"artwork": "music-artwork"},
+	})
+	ctx := context.Background()
+
+	cover, err := NewArtworkService().Save(ctx, &Artwork{Data: smallPNG(t, 8, 8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := "fake audio"
+	key := AudioObjectKey(strings.Repeat("a", 64), "a.mp3")
+	putObject(t, storage.Store, key, audio)
+	track := models.MusicInfo{Name: "a", Location: "file:///a", ObjectKey: key, Size: int64(len(audio)), Cover: cover}
+	if err := models.DB.Create(&track).Error; err != nil {
+		t.Fatal(err)
+	}
+	orphan := AudioObjectKey(strings.Repeat("b", 64), "b.mp3")
+	putObject(t, storage.Store, orphan, "orphan")
+	backdate(t, root, orphan)
+	backdate(t, root, "music-artwork/"+ArtworkKey(cover))
+
+	report, err := NewVerifyService().Verify(ctx, VerifyOptions{DeleteOrphans: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Objects != 2 || len(report.Issues) != 1 || report.Issues[0].Key != orphan {
+		t.Fatalf("report = %+v", report)
+	}
+	if _, err := storage.Bucket("artwork").Stat(ctx, ArtworkKey(cover)); err != nil {
+		t.Errorf("封面桶中的封面不应被删除: %v", err)
+	}
+	if _, err := storage.Store.Stat(ctx, orphan); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("孤儿对象应被删除: %v", err)
+	}
+}
+
+func TestVerifyOnlyCleansAudioLayout(t *testing.T) {
+	useTestDB(t)
+	root := t.TempDir()
+	useStorageConfig(t, config.StorageConfig{Driver: "local", Local: config.LocalStorageConfig{Root: root, Secret: "test"}})
+	ctx := context.Background()
+
+	oldAudio := AudioObjectKey(strings.Repeat("a", 64), "a.mp3")
+	newAudio := AudioObjectKey(strings.Repeat("b", 64), "b.mp3")
+	oldStaging, newStaging := StagingPrefix+"old", StagingPrefix+"new"
+	legacy := "42"
+	foreign := []string{"backups/db.tar", "notes.txt", "4x2"}
+	for _, key := range append([]string{oldAudio, newAudio, oldStaging, newStaging, legacy}, foreign...) {
+		putObject(t, storage.Store, key, "data")
+		if key != newAudio && key != newStaging {
+			backdate(t, root, key)
+		}
+	}
+
+	report, err := NewVerifyService().Verify(ctx, VerifyOptions{DeleteOrphans: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, issue := range report.Issues {
+		got[issue.Key] = issue.Kind
+	}
+	want := map[string]string{oldAudio: IssueOrphanObject, legacy: IssueOrphanObject, oldStaging: IssueStaleStaging}
+	if len(got) != len(want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+	for key, kind := range want {
+		if got[key] != kind {
+			t.Errorf("%s: kind = %q, want %q", key, got[key], kind)
+		}
+		if _, err := storage.Store.Stat(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s 应被删除: %v", key, err)
+		}
+	}
+	// 刚写入的对象可能属于正在进行的导入，其他前缀的对象不归 verify 管理
+	for _, key := range append([]string{newAudio, newStaging}, foreign...) {
+		if _, err := storage.Store.Stat(ctx, key); err != nil {
+			t.Errorf("%s 不应被删除: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"Music/config"
+	"Music/my_utils"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("local", func(bucket string) (Storage, error) {
+		l, err := NewLocalStorage(config.Config.Storage.Local, bucket)
+		if err != nil {
+			return nil, err
+		}
+		l.excludeBuckets(config.Config.Storage.Buckets)
+		return l, nil
+	})
+}
+
+// LocalStorage 把对象保存在本地目录，便于在笔记本和测试中脱离云服务运行
+type LocalStorage struct {
+	bucket  string
+	base    string // 配置的根目录，各个桶的目录都在其下
+	root    string
+	baseURL string
+	secret  []byte
+	// 根目录下属于其他存储桶的子目录（斜杠分隔），不属于这个桶
+	nested []string
+}
+
+// NewLocalStorage 创建本地存储，bucket 非空时对象保存在根目录下的同名子目录
+func NewLocalStorage(cfg config.LocalStorageConfig, bucket string) (*LocalStorage, error) {
+	root := cfg.Root
+	if root == "" {
+		root = "data/objects"
+	}
+	base, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	root = filepath.Join(base, bucket)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %v", err)
+	}
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		// 未配置签名密钥时随机生成，重启后旧的签名地址失效
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		my_utils.Warn("未配置 storage.local.secret，签名地址将在重启后失效")
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "http://localhost:8080/music/v1/object/"
+	}
+	return &LocalStorage{bucket: bucket, base: base, root: root, baseURL: baseURL, secret: secret}, nil
+}
+
+// path 把对象 key 映射为根目录下的文件路径，拒绝越出根目录的 key
+func (l *LocalStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" {
+		return "", fmt.Errorf("非法的对象 key: %q", key)
+	}
+	if l.isNested(clean[1:]) {
+		return "", fmt.Errorf("对象 key %q 属于其他存储桶", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
+
+// isNested key 是否落在其他存储桶的目录中
+func (l *LocalStorage) isNested(key string) bool {
+	for _, dir := range l.nested {
+		if key == dir || strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeBuckets 记录位于根目录下的其他存储桶：默认桶的根目录包含各个命名桶的子目录，
+// List 不应把它们的对象当作自己的
+func (l *LocalStorage) excludeBuckets(buckets map[string]string) {
+	for _, bucket := range buckets {
+		rel, err := filepath.Rel(l.root, filepath.Join(l.base, bucket))
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			l.nested = append(l.nested, filepath.ToSlash(rel))
+		}
+	}
+}
+
+func (l *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	// 先写临时文件再重命名，避免读到写了一半的对象
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && n != size {
+		return "", fmt.Errorf("写入长度不一致: 期望 %d, 实际 %d", size, n)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(p), nil
+}
+
+func (l *LocalStorage) Get(ctx context.Context, key string, rangeHeader string) (*Object, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	info, err := l.statFile(key, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	start, end, partial, err := ParseRange(rangeHeader, info.Size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	body := struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, start, end-start+1), f}
+	return &Object{Body: body, Info: *info, Start: start, End: end, Partial: partial}, nil
+}
+
+func (l *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return l.statFile(key, f)
+}
+
+func (l *LocalStorage) statFile(key string, f *os.File) (*ObjectInfo, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, ErrNotFound
+	}
+	contentType := ContentType(key)
+	if path.Ext(key) == "" {
+		// 没有扩展名时按文件头嗅探
+		buf := make([]byte, 512)
+		n, _ := f.ReadAt(buf, 0)
+		contentType = http.DetectContentType(buf[:n])
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  contentType,
+		ETag:         fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) (string, error) {
+	src, err := l.path(srcKey)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	defer f.Close()
+	return l.Put(ctx, dstKey, f, -1, "")
+}
+
+func (l *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if l.isNested(key) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         fi.Size(),
+			ETag:         fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()),
+			LastModified: fi.ModTime(),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+// PresignURL 生成指向 /music/v1/object/ 的 HMAC 签名地址
+func (l *LocalStorage) PresignURL(ctx context.Context, key string, expire time.Duration) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	q := url.Values{}
+	if l.bucket != "" {
+		q.Set("bucket", l.bucket)
+	}
+	q.Set("expires", expires)
+	q.Set("sig", l.sign(key, expires))
+	return strings.TrimSuffix(l.baseURL, "/") + "/" + key + "?" + q.Encode(), nil
+}
+
+// VerifySignature 校验 PresignURL 生成的签名及有效期
+func (l *LocalStorage) VerifySignature(key, expires, sig string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(l.sign(key, expires)))
+}
+
+func (l *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(l.bucket + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"Music/config"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T, bucket string) *LocalStorage {
+	t.Helper()
+	l, err := NewLocalStorage(config.LocalStorageConfig{
+		Root:    t.TempDir(),
+		BaseURL: "http://example.test/music/v1/object/",
+		Secret:  "test-secret",
+	}, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func readAll(t *testing.T, obj *Object) string {
+	t.Helper()
+	defer obj.Body.Close()
+	b, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t, "")
+	data := "0123456789abcdefghij"
+
+	if _, err := l.Put(ctx, "music/a.mp3", strings.NewReader(data), int64(len(data)), "audio/mpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Put(ctx, "music/b.flac", strings.NewReader("flac"), -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Put(ctx, "other/c.mp3", strings.NewReader("c"), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Put(ctx, "music/short.mp3", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Error("长度不一致时 Put 应失败")
+	}
+	if _, err := l.Stat(ctx, "music/short.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("写入失败后不应留下对象, err = %v", err)
+	}
+
+	info, err := l.Stat(ctx, "music/a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) || info.ContentType != "audio/mpeg" || info.ETag == "" {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	obj, err := l.Get(ctx, "music/a.mp3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Partial || obj.ContentLength() != int64(len(data)) {
+		t.Errorf("完整读取 Partial = %v, ContentLength = %d", obj.Partial, obj.ContentLength())
+	}
+	if got := readAll(t, obj); got != data {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+
+	obj, err = l.Get(ctx, "music/a.mp3", "bytes=5-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !obj.Partial || obj.ContentRange() != "bytes 5-9/20" {
+		t.Errorf("Range 读取 Partial = %v, ContentRange = %q", obj.Partial, obj.ContentRange())
+	}
+	if got := readAll(t, obj); got != "56789" {
+		t.Errorf("Range 读取 = %q", got)
+	}
+
+	obj, err = l.Get(ctx, "music/a.mp3", "bytes=-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, obj); got != "hij" {
+		t.Errorf("后缀 Range 读取 = %q", got)
+	}
+
+	if _, err := l.Get(ctx, "music/a.mp3", "bytes=100-"); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("越界 Range err = %v", err)
+	}
+	if _, err := l.Get(ctx, "music/missing.mp3", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("不存在的对象 Get err = %v", err)
+	}
+	if _, err := l.Stat(ctx, "music"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("目录 Stat err = %v", err)
+	}
+
+	if _, err := l.Copy(ctx, "music/a.mp3", "music/copy.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Copy(ctx, "music/missing.mp3", "music/x.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("复制不存在的对象 err = %v", err)
+	}
+
+	objects, err := l.List(ctx, "music/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	sort.Strings(keys)
+	if want := "music/a.mp3,music/b.flac,music/copy.mp3"; strings.Join(keys, ",") != want {
+		t.Errorf("List = %v, want %s", keys, want)
+	}
+
+	if err := l.Delete(ctx, "music/a.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "music/a.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("删除后 Stat err = %v", err)
+	}
+	if err := l.Delete(ctx, "music/a.mp3"); err != nil {
+		t.Errorf("重复删除应忽略不存在的对象, err = %v", err)
+	}
+}
+
+func TestLocalStorageRejectsEscapingKeys(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t, "")
+	for _, key := range []string{"", "/", "."} {
+		if _, err := l.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) 应失败", key)
+		}
+	}
+	// .. 被限制在根目录内
+	if _, err := l.Put(ctx, "../../escape.mp3", strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "escape.mp3"); err != nil {
+		t.Errorf("越界的 key 应落在根目录下, err = %v", err)
+	}
+}
+
+func TestLocalStoragePresign(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t, "music-artwork")
+
+	raw, err := l.PresignURL(ctx, "ab/cd.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/music/v1/object/ab/cd.jpg" {
+		t.Errorf("签名地址路径 = %q", u.Path)
+	}
+	q := u.Query()
+	if q.Get("bucket") != "music-artwork" {
+		t.Errorf("签名地址 bucket = %q", q.Get("bucket"))
+	}
+	expires, sig := q.Get("expires"), q.Get("sig")
+	if !l.VerifySignature("ab/cd.jpg", expires, sig) {
+		t.Error("签名校验失败")
+	}
+	if l.VerifySignature("ab/other.jpg", expires, sig) {
+		t.Error("换了 key 的签名不应通过")
+	}
+	if l.VerifySignature("ab/cd.jpg", expires, sig+"00") {
+		t.Error("篡改的签名不应通过")
+	}
+	if l.VerifySignature("ab/cd.jpg", "not-a-number", sig) {
+		t.Error("无效的 expires 不应通过")
+	}
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	if l.VerifySignature("ab/cd.jpg", later, sig) {
+		t.Error("延长有效期后的签名不应通过")
+	}
+
+	// 其他桶的签名不能通用
+	other := newTestLocal(t, "music")
+	other.secret = l.secret
+	if other.VerifySignature("ab/cd.jpg", expires, sig) {
+		t.Error("其他桶不应接受该签名")
+	}
+
+	expired, err := l.PresignURL(ctx, "ab/cd.jpg", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(expired)
+	if l.VerifySignature("ab/cd.jpg", u.Query().Get("expires"), u.Query().Get("sig")) {
+		t.Error("过期的签名不应通过")
+	}
+
+	if _, err := l.PresignURL(ctx, "", time.Minute); err == nil {
+		t.Error("空 key 不应生成签名地址")
+	}
+}
+
+func TestPresignURLResolvesNamedBucket(t *testing.T) {
+	oldCfg, oldStore, oldBuckets, oldByName := config.Config.Storage, Store, buckets, bucketsByName
+	t.Cleanup(func() {
+		config.Config.Storage, Store, buckets, bucketsByName = oldCfg, oldStore, oldBuckets, oldByName
+	})
+	config.Config.Storage = config.StorageConfig{
+		Driver:  "local",
+		Local:   config.LocalStorageConfig{Root: t.TempDir(), Secret: "test-secret"},
+		Buckets: map[string]string{"artwork": "music-artwork-1320864532"},
+	}
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"artwork", "audio"} {
+		raw, err := Bucket(name).PresignURL(context.Background(), "ab/cd.jpg", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(raw)
+		q := u.Query()
+		s, ok := BucketByName(q.Get("bucket"))
+		if !ok || s != Bucket(name) {
+			t.Errorf("%s: 签名地址中的 bucket=%q 找不到原来的存储桶", name, q.Get("bucket"))
+			continue
+		}
+		if !s.(*LocalStorage).VerifySignature("ab/cd.jpg", q.Get("expires"), q.Get("sig")) {
+			t.Errorf("%s: 签名校验失败", name)
+		}
+	}
+	if _, ok := BucketByName("artwork"); ok {
+		t.Error("BucketByName 不应接受逻辑名称")
+	}
+}
+
+func TestLocalDefaultBucketExcludesNamedBuckets(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	cfg := config.LocalStorageConfig{Root: root, Secret: "test-secret"}
+	buckets := map[string]string{"artwork": "music-artwork", "outside": "../elsewhere"}
+	store, err := NewLocalStorage(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.excludeBuckets(buckets)
+	artwork, err := NewLocalStorage(cfg, "music-artwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artwork.excludeBuckets(buckets)
+
+	if _, err := artwork.Put(ctx, "artwork/ab", strings.NewReader("img"), 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(ctx, "audio/a.mp3", strings.NewReader("mp3"), 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	// 与桶目录同名前缀但不在桶目录中的 key 仍属于默认桶
+	if _, err := store.Put(ctx, "music-artwork-old/x", strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	sort.Strings(keys)
+	if want := "audio/a.mp3,music-artwork-old/x"; strings.Join(keys, ",") != want {
+		t.Errorf("默认桶 List = %v, want %s", keys, want)
+	}
+	if objects, err := artwork.List(ctx, ""); err != nil || len(objects) != 1 || objects[0].Key != "artwork/ab" {
+		t.Errorf("封面桶 List = %v, %v", objects, err)
+	}
+	for _, key := range []string{"music-artwork/artwork/ab", "music-artwork"} {
+		if _, err := store.Get(ctx, key, ""); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("默认桶不应读取其他桶的对象 %q, err = %v", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("默认桶不应删除其他桶的对象 %q", key)
+		}
+	}
+	if _, err := artwork.Stat(ctx, "artwork/ab"); err != nil {
+		t.Errorf("封面应保留: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"Music/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("对象不存在")
+
+// ErrInvalidRange Range 请求头无法满足
+var ErrInvalidRange = errors.New("无效的 Range 请求")
+
+// ObjectInfo 对象的元信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Object 一次（可能带 Range 的）读取结果
+type Object struct {
+	Body io.ReadCloser
+	Info ObjectInfo
+	// 本次返回的字节区间，Partial 为 false 时为整个对象
+	Start, End int64
+	Partial    bool
+}
+
+// ContentLength 本次响应体长度
+func (o *Object) ContentLength() int64 {
+	return o.End - o.Start + 1
+}
+
+// ContentRange 生成 Content-Range 响应头
+func (o *Object) ContentRange() string {
+	return fmt.Sprintf("bytes %d-%d/%d", o.Start, o.End, o.Info.Size)
+}
+
+// Storage 音频等二进制对象的存储后端
+type Storage interface {
+	// Put 写入对象，返回对象的访问地址
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	// Get 读取对象，rangeHeader 为 HTTP Range 请求头，可为空
+	Get(ctx context.Context, key string, rangeHeader string) (*Object, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Copy 在同一个桶内复制对象，返回目标对象的访问地址
+	Copy(ctx context.Context, srcKey, dstKey string) (string, error)
+	// List 列出指定前缀下的全部对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PresignURL 生成限时访问地址
+	PresignURL(ctx context.Context, key string, expire time.Duration) (string, error)
+}
+
+// Factory 根据全局配置创建存储后端，bucket 为实际的桶名，空字符串表示驱动的默认桶
+type Factory func(bucket string) (Storage, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register 注册存储驱动，通常在驱动包的 init 中调用
+func Register(driver string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, dup := factories[driver]; dup {
+		panic("storage: 重复注册驱动 " + driver)
+	}
+	factories[driver] = f
+}
+
+// Drivers 已注册的驱动名
+func Drivers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store 全局存储后端（默认桶，存放音频），由 Init 根据配置初始化
+var Store Storage
+
+// 按逻辑名称（如 artwork）区分的其他存储桶
+var buckets = map[string]Storage{}
+
+// 按实际桶名索引的全部存储桶，默认桶的键为空字符串；签名地址中记录的是实际桶名
+var bucketsByName = map[string]Storage{}
+
+// Bucket 返回逻辑名称对应的存储桶，未在 storage.buckets 中单独配置时与默认桶共用
+func Bucket(name string) Storage {
+	if s, ok := buckets[name]; ok {
+		return s
+	}
+	return Store
+}
+
+// BucketByName 按实际桶名查找存储桶，空字符串为默认桶
+func BucketByName(bucket string) (Storage, bool) {
+	s, ok := bucketsByName[bucket]
+	return s, ok
+}
+
+// Init 按 config.Config.Storage.Driver 初始化全局存储后端，未配置时沿用腾讯云 COS
+func Init() error {
+	driver := config.Config.Storage.Driver
+	if driver == "" {
+		driver = "cos"
+	}
+	factoriesMu.RLock()
+	f, ok := factories[driver]
+	factoriesMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("未知的存储驱动 %q，可选: %s", driver, strings.Join(Drivers(), ", "))
+	}
+	s, err := f("")
+	if err != nil {
+		return fmt.Errorf("初始化存储驱动 %s 失败: %v", driver, err)
+	}
+	named := map[string]Storage{}
+	byName := map[string]Storage{"": s}
+	for name, bucket := range config.Config.Storage.Buckets {
+		b, err := f(bucket)
+		if err != nil {
+			return fmt.Errorf("初始化存储桶 %s(%s) 失败: %v", name, bucket, err)
+		}
+		named[name], byName[bucket] = b, b
+	}
+	Store, buckets, bucketsByName = s, named, byName
+	return nil
+}
+
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+}
+
+// ContentType 按文件扩展名推断 Content-Type，系统 mime 表缺少常见音频类型时使用内置表
+func ContentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := audioTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// ParseRange 解析单区间的 Range 请求头（bytes=start-end / bytes=start- / bytes=-suffix）
+// 返回闭区间 [start, end]；header 为空时 ok 为 false
+func ParseRange(header string, size int64) (start, end int64, ok bool, err error) {
+	if header == "" {
+		return 0, size - 1, false, nil
+	}
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, ErrInvalidRange
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false, ErrInvalidRange
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+	switch {
+	case first == "":
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		start, end = size-n, size-1
+	default:
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 || start >= size {
+			return 0, 0, false, ErrInvalidRange
+		}
+		end = size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return 0, 0, false, ErrInvalidRange
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+	}
+	return start, end, true, nil
+}
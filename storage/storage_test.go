@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	const size = 1000
+	tests := []struct {
+		header     string
+		start, end int64
+		partial    bool
+		err        error
+	}{
+		{"", 0, size - 1, false, nil},
+		{"bytes=0-99", 0, 99, true, nil},
+		{"bytes=100-199", 100, 199, true, nil},
+		{" bytes=10-10 ", 10, 10, true, nil},
+		{"bytes=900-", 900, size - 1, true, nil},
+		{"bytes=0-", 0, size - 1, true, nil},
+		{"bytes=990-5000", 990, size - 1, true, nil},
+		{"bytes=-100", 900, size - 1, true, nil},
+		{"bytes=-5000", 0, size - 1, true, nil},
+		{"bytes=1000-", 0, 0, false, ErrInvalidRange},
+		{"bytes=5000-6000", 0, 0, false, ErrInvalidRange},
+		{"bytes=-0", 0, 0, false, ErrInvalidRange},
+		{"bytes=200-100", 0, 0, false, ErrInvalidRange},
+		{"bytes=0-99,200-299", 0, 0, false, ErrInvalidRange},
+		{"items=0-99", 0, 0, false, ErrInvalidRange},
+		{"bytes=abc-", 0, 0, false, ErrInvalidRange},
+		{"bytes=0-abc", 0, 0, false, ErrInvalidRange},
+		{"bytes=-abc", 0, 0, false, ErrInvalidRange},
+		{"bytes=-", 0, 0, false, ErrInvalidRange},
+		{"bytes=100", 0, 0, false, ErrInvalidRange},
+		{"bytes=-1-5", 0, 0, false, ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		start, end, partial, err := ParseRange(tt.header, size)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseRange(%q) err = %v, want %v", tt.header, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if start != tt.start || end != tt.end || partial != tt.partial {
+			t.Errorf("ParseRange(%q) = %d, %d, %v, want %d, %d, %v",
+				tt.header, start, end, partial, tt.start, tt.end, tt.partial)
+		}
+	}
+}
+
+func TestParseRangeEmptyObject(t *testing.T) {
+	if _, _, _, err := ParseRange("bytes=0-", 0); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("空对象的 Range 应无法满足, err = %v", err)
+	}
+	if _, _, partial, err := ParseRange("", 0); err != nil || partial {
+		t.Errorf("空对象不带 Range 应返回整个对象, partial = %v, err = %v", partial, err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := map[string]string{
+		"a/b.mp3":  "audio/mpeg",
+		"b.FLAC":   "audio/flac",
+		"c.m4a":    "audio/mp4",
+		"d.opus":   "audio/ogg",
+		"e.json":   "application/json",
+		"no-ext":   "application/octet-stream",
+		"f.nosuch": "application/octet-stream",
+	}
+	for name, want := range tests {
+		if got := ContentType(name); got != want {
+			t.Errorf("ContentType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -2,74 +2,209 @@ package tengcent_cos
 
 import (
 	"Music/config"
+	"Music/storage"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/tencentyun/cos-go-sdk-v5"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+func init() {
+	storage.Register("cos", func(bucket string) (storage.Storage, error) {
+		return Client(bucket)
+	})
+}
+
+const (
+	defaultEndpoint        = "https://{bucket}.cos.{region}.myqcloud.com"
+	defaultServiceEndpoint = "https://cos.{region}.myqcloud.com"
+)
+
 type CosClient struct {
 	client *cos.Client
 }
 
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]*CosClient{}
+)
+
+// InitClient 返回默认存储桶（tencent_cos.bucket）的共享客户端
 func InitClient() (*CosClient, error) {
-	// 将 examplebucket-1250000000 和 COS_REGION 修改为用户真实的信息
+	return Client("")
+}
+
+// Client 返回指定存储桶的共享客户端，同一个桶只创建一次；bucket 为空时使用 tencent_cos.bucket
+func Client(bucket string) (*CosClient, error) {
+	cfg := config.Config.TencentCOS
+	if bucket == "" {
+		bucket = cfg.Bucket
+	}
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[bucket]; ok {
+		return c, nil
+	}
+	c, err := newClient(cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	clients[bucket] = c
+	return c, nil
+}
+
+func newClient(cfg config.TencentCOSConfig, bucket string) (*CosClient, error) {
 	// 存储桶名称，由 bucketname-appid 组成，appid 必须填入，可以在 COS 控制台查看存储桶名称。https://console.cloud.tencent.com/cos5/bucket
 	// COS_REGION 可以在控制台查看，https://console.cloud.tencent.com/cos5/bucket, 关于地域的详情见 https://cloud.tencent.com/document/product/436/6224
-	u, _ := url.Parse("https://music-1320864532.cos.ap-guangzhou.myqcloud.com")
+	if bucket == "" {
+		return nil, errors.New("tencent_cos.bucket 不能为空")
+	}
+	if cfg.Region == "" && (cfg.Endpoint == "" || cfg.ServiceEndpoint == "") {
+		return nil, errors.New("tencent_cos.region 不能为空")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	serviceEndpoint := cfg.ServiceEndpoint
+	if serviceEndpoint == "" {
+		serviceEndpoint = defaultServiceEndpoint
+	}
+	u, err := url.Parse(expandEndpoint(endpoint, bucket, cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("tencent_cos.endpoint 无效: %v", err)
+	}
 	// 用于 Get Service 查询，默认全地域 service.cos.myqcloud.com
-	su, _ := url.Parse("https://cos.ap-guangzhou.myqcloud.com")
+	su, err := url.Parse(expandEndpoint(serviceEndpoint, bucket, cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("tencent_cos.service_endpoint 无效: %v", err)
+	}
 	b := &cos.BaseURL{BucketURL: u, ServiceURL: su}
 	// 1.永久密钥
 	client := cos.NewClient(b, &http.Client{
 		Timeout: 10 * time.Minute,
 		Transport: &cos.AuthorizationTransport{
-			SecretID:  config.Config.TencentCOS.SecretID,  // 用户的 SecretId，建议使用子账号密钥，授权遵循最小权限指引，降低使用风险。子账号密钥获取可参考 https://cloud.tencent.com/document/product/598/37140
-			SecretKey: config.Config.TencentCOS.SecretKey, // 用户的 SecretKey，建议使用子账号密钥，授权遵循最小权限指引，降低使用风险。子账号密钥获取可参考 https://cloud.tencent.com/document/product/598/37140
+			SecretID:  cfg.SecretID,  // 用户的 SecretId，建议使用子账号密钥，授权遵循最小权限指引，降低使用风险。子账号密钥获取可参考 https://cloud.tencent.com/document/product/598/37140
+			SecretKey: cfg.SecretKey, // 用户的 SecretKey，建议使用子账号密钥，授权遵循最小权限指引，降低使用风险。子账号密钥获取可参考 https://cloud.tencent.com/document/product/598/37140
 		},
 	})
-	//s, _, err := client.Service.Get(context.Background())
-	//if err != nil {
-	//	panic(err)
-	//}
-	//for _, b := range s.Buckets {
-	//	fmt.Printf("%#v\n", b)
-	//}
+	if cfg.Endpoint != "" {
+		// 本地模拟服务通常不返回 x-cos-hash-crc64ecma
+		client.Conf.EnableCRC = false
+	}
 	return &CosClient{
 		client: client,
 	}, nil
 }
 
-func (cosClient *CosClient) Upload(name string, filepath string) string {
-	res, _, err := cosClient.client.Object.Upload(context.Background(), name, filepath, nil)
-	if err != nil {
-		fmt.Println("error")
-		panic(err)
-	}
-	return res.Location
+// expandEndpoint 替换 endpoint 模板中的 {bucket} 与 {region}
+func expandEndpoint(tmpl, bucket, region string) string {
+	return strings.NewReplacer("{bucket}", bucket, "{region}", region).Replace(tmpl)
 }
-func (cosClient *CosClient) DownloadStream(key string) (io.ReadCloser, error) {
-	resp, err := cosClient.client.Object.Get(context.Background(), key, nil)
+
+// Put 上传对象，返回对象地址
+func (c *CosClient) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	opt := &cos.ObjectPutOptions{
+		ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{ContentType: contentType},
+	}
+	if size >= 0 {
+		opt.ContentLength = size
+	}
+	_, err := c.client.Object.Put(ctx, key, r, opt)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return resp.Body, nil
+	return c.client.BaseURL.BucketURL.String() + "/" + key, nil
 }
-func (c *CosClient) DownloadStreamWithRange(key string, rangeHeader string) (*cos.Response, error) {
+
+// Get 读取对象，支持 Range
+func (c *CosClient) Get(ctx context.Context, key string, rangeHeader string) (*storage.Object, error) {
 	opt := &cos.ObjectGetOptions{}
 	if rangeHeader != "" {
 		opt.Range = rangeHeader
 	}
-	return c.client.Object.Get(context.Background(), key, opt)
+	resp, err := c.client.Object.Get(ctx, key, opt)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	info := objectInfo(key, resp.Header)
+	obj := &storage.Object{Body: resp.Body, Info: info, Start: 0, End: info.Size - 1}
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes start-end/total
+		var start, end, total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("无法解析 Content-Range: %v", err)
+		}
+		obj.Info.Size = total
+		obj.Start, obj.End, obj.Partial = start, end, true
+	}
+	return obj, nil
+}
+
+func (c *CosClient) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	resp, err := c.client.Object.Head(ctx, key, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	info := objectInfo(key, resp.Header)
+	return &info, nil
+}
+
+func (c *CosClient) Delete(ctx context.Context, key string) error {
+	_, err := c.client.Object.Delete(ctx, key)
+	if err != nil && !cos.IsNotFoundError(err) {
+		return err
+	}
+	return nil
 }
 
-func (c *CosClient) GetPresignedURL(key string, expire time.Duration) (string, error) {
+// Copy 桶内复制对象
+func (c *CosClient) Copy(ctx context.Context, srcKey, dstKey string) (string, error) {
+	sourceURL := c.client.BaseURL.BucketURL.Host + "/" + srcKey
+	_, _, err := c.client.Object.Copy(ctx, dstKey, sourceURL, nil)
+	if err != nil {
+		return "", convertError(err)
+	}
+	return c.client.BaseURL.BucketURL.String() + "/" + dstKey, nil
+}
+
+func (c *CosClient) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	opt := &cos.BucketGetOptions{Prefix: prefix, MaxKeys: 1000}
+	for {
+		res, _, err := c.client.Bucket.Get(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			modified, _ := time.Parse(time.RFC3339, o.LastModified)
+			objects = append(objects, storage.ObjectInfo{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         o.ETag,
+				LastModified: modified,
+			})
+		}
+		if !res.IsTruncated {
+			return objects, nil
+		}
+		opt.Marker = res.NextMarker
+	}
+}
+
+// PresignURL 生成限时下载地址
+func (c *CosClient) PresignURL(ctx context.Context, key string, expire time.Duration) (string, error) {
 	// 构造签名 URL
 	presignedURL, err := c.client.Object.GetPresignedURL(
-		context.Background(),
+		ctx,
 		http.MethodGet,
 		key,
 		config.Config.TencentCOS.SecretID,
@@ -85,3 +220,26 @@ func (c *CosClient) GetPresignedURL(key string, expire time.Duration) (string, e
 	}
 	return presignedURL.String(), nil
 }
+
+func objectInfo(key string, h http.Header) storage.ObjectInfo {
+	size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	modified, _ := http.ParseTime(h.Get("Last-Modified"))
+	return storage.ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ContentType:  h.Get("Content-Type"),
+		ETag:         h.Get("ETag"),
+		LastModified: modified,
+	}
+}
+
+// convertError 把 COS 的 404/416 转换为 storage 包的哨兵错误
+func convertError(err error) error {
+	if cos.IsNotFoundError(err) {
+		return storage.ErrNotFound
+	}
+	if e, ok := err.(*cos.ErrorResponse); ok && e.Response != nil && e.Response.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return storage.ErrInvalidRange
+	}
+	return err
+}